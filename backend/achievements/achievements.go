@@ -0,0 +1,178 @@
+// Package achievements awards badges to players. Each rule names an event,
+// a metric and a threshold; when the event fires for a player, every rule
+// they have not yet unlocked is checked and awarded at most once.
+package achievements
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+type Engine struct {
+	db    *gorm.DB
+	rules []Rule
+}
+
+func New(db *gorm.DB, rules []Rule) *Engine {
+	return &Engine{
+		db:    db,
+		rules: rules,
+	}
+}
+
+// Rules returns the rules achievements are awarded by.
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Unlocked returns the achievements a user holds, oldest first.
+func (e *Engine) Unlocked(ctx context.Context, userID string) ([]models.Achievement, error) {
+	var unlocked []models.Achievement
+	err := e.db.WithContext(ctx).Where("user_id = ?", userID).Order("unlocked_at, type").Find(&unlocked).Error
+	return unlocked, err
+}
+
+// RaceFinished evaluates the race rules for a stored result and returns the
+// achievements it unlocked. Practice drills and guests earn nothing. Errors
+// are logged.
+func (e *Engine) RaceFinished(ctx context.Context, result models.GameResult) []models.Achievement {
+	if result.Mode == models.ModePractice {
+		return nil
+	}
+	return e.evaluate(ctx, EventRace, result.UserID, &result)
+}
+
+// TournamentWon evaluates the tournament rules for the winner of an
+// elimination session and returns the achievements it unlocked.
+func (e *Engine) TournamentWon(ctx context.Context, userID string) []models.Achievement {
+	return e.evaluate(ctx, EventTournamentWin, userID, nil)
+}
+
+// Grant awards an achievement that no rule describes, such as a season
+// reward, and returns it, or nil if the user already holds it.
+func (e *Engine) Grant(ctx context.Context, userID, achievementType, name, description string) (*models.Achievement, error) {
+	return e.award(e.db.WithContext(ctx), userID, Rule{Type: achievementType, Name: name, Description: description})
+}
+
+func (e *Engine) evaluate(ctx context.Context, event, userID string, result *models.GameResult) []models.Achievement {
+	var pending []Rule
+	for _, rule := range e.rules {
+		if rule.Event == event {
+			pending = append(pending, rule)
+		}
+	}
+	if len(pending) == 0 || userID == "" {
+		return nil
+	}
+
+	db := e.db.WithContext(ctx)
+	var user models.User
+	if err := db.Select("id").First(&user, "id = ?", userID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error loading user %s for achievements: %v", userID, err)
+		}
+		return nil
+	}
+
+	var held []string
+	if err := db.Model(&models.Achievement{}).Where("user_id = ?", userID).Pluck("type", &held).Error; err != nil {
+		log.Printf("Error loading achievements of %s: %v", userID, err)
+		return nil
+	}
+	has := make(map[string]bool, len(held))
+	for _, t := range held {
+		has[t] = true
+	}
+
+	var unlocked []models.Achievement
+	values := make(map[string]float64)
+	for _, rule := range pending {
+		if has[rule.Type] {
+			continue
+		}
+
+		value, ok := values[rule.Metric]
+		if !ok {
+			var err error
+			if value, err = e.metric(db, rule.Metric, userID, result); err != nil {
+				log.Printf("Error computing %s of %s: %v", rule.Metric, userID, err)
+				continue
+			}
+			values[rule.Metric] = value
+		}
+		if value < rule.Threshold {
+			continue
+		}
+
+		achievement, err := e.award(db, userID, rule)
+		if err != nil {
+			log.Printf("Error awarding %s to %s: %v", rule.Type, userID, err)
+			continue
+		}
+		if achievement != nil {
+			unlocked = append(unlocked, *achievement)
+		}
+	}
+	return unlocked
+}
+
+// metric computes a player's value of a metric. result is the race that
+// fired the event, if any.
+func (e *Engine) metric(db *gorm.DB, metric, userID string, result *models.GameResult) (float64, error) {
+	switch metric {
+	case MetricWPM:
+		if result == nil || !result.Finished {
+			return 0, nil
+		}
+		return float64(result.WPM), nil
+	case MetricAccuracy:
+		if result == nil || !result.Finished {
+			return 0, nil
+		}
+		return result.Accuracy, nil
+	case MetricTournamentWins:
+		var n int64
+		err := db.Model(&models.Placement{}).Where("user_id = ? AND placement = 1", userID).Count(&n).Error
+		return float64(n), err
+	}
+
+	races := db.Model(&models.GameResult{}).Where("user_id = ? AND mode <> ?", userID, models.ModePractice)
+	switch metric {
+	case MetricWins:
+		// Daily challenge attempts are solo and always placed first
+		races = races.Where("position = 1 AND mode <> ?", models.ModeDaily)
+	case MetricStreak:
+		lastMissed := db.Model(&models.GameResult{}).Select("MAX(created_at)").
+			Where("user_id = ? AND mode <> ? AND NOT finished", userID, models.ModePractice)
+		races = races.Where("created_at > COALESCE((?), '-infinity')", lastMissed)
+	}
+	var n int64
+	err := races.Count(&n).Error
+	return float64(n), err
+}
+
+// award stores an achievement and returns it, or nil if the user already
+// held it, as when the same event is evaluated twice at once.
+func (e *Engine) award(db *gorm.DB, userID string, rule Rule) (*models.Achievement, error) {
+	achievement := models.Achievement{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		Type:        rule.Type,
+		Name:        rule.Name,
+		Description: rule.Description,
+		UnlockedAt:  time.Now(),
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&achievement)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &achievement, nil
+}
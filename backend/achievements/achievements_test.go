@@ -0,0 +1,104 @@
+package achievements
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+// testUser connects to the Postgres database named by TEST_DATABASE_DSN,
+// or skips the test if the variable is not set, and stores a user whose
+// rows are removed when the test ends.
+func testUser(t *testing.T) (*gorm.DB, models.User) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{ID: uuid.New().String(), Username: "badges-" + uuid.New().String()[:8]}
+	if err := conn.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Where("user_id = ?", user.ID).Delete(&models.Achievement{})
+		conn.Where("user_id = ?", user.ID).Delete(&models.GameResult{})
+		conn.Delete(&user)
+	})
+	return conn, user
+}
+
+func TestGrantOnce(t *testing.T) {
+	conn, user := testUser(t)
+	ctx := context.Background()
+	e := New(conn, nil)
+
+	first, err := e.Grant(ctx, user.ID, "season_1_top", "Season 1", "Finished season 1 in the top ten")
+	if err != nil || first == nil {
+		t.Fatalf("first Grant = %v, %v", first, err)
+	}
+	again, err := e.Grant(ctx, user.ID, "season_1_top", "Season 1", "Finished season 1 in the top ten")
+	if err != nil || again != nil {
+		t.Errorf("second Grant = %v, %v, want nothing awarded", again, err)
+	}
+	unlocked, err := e.Unlocked(ctx, user.ID)
+	if err != nil || len(unlocked) != 1 {
+		t.Errorf("Unlocked = %v, %v, want one achievement", unlocked, err)
+	}
+}
+
+func TestStreak(t *testing.T) {
+	conn, user := testUser(t)
+	ctx := context.Background()
+	e := New(conn, []Rule{{Type: "streak_3", Name: "Three in a Row", Event: EventRace, Metric: MetricStreak, Threshold: 3}})
+
+	start := time.Now().Add(-time.Hour)
+	race := func(n int, mode models.GameMode, finished bool) models.GameResult {
+		result := models.GameResult{
+			ID: uuid.New().String(), GameID: uuid.New().String(), UserID: user.ID,
+			Mode: mode, Finished: finished, Position: 2, CreatedAt: start.Add(time.Duration(n) * time.Minute),
+		}
+		if err := conn.Create(&result).Error; err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	steps := []struct {
+		mode     models.GameMode
+		finished bool
+		unlocks  bool
+	}{
+		{models.ModeStandard, true, false},
+		{models.ModeStandard, true, false},
+		// An unfinished race breaks the streak
+		{models.ModeStandard, false, false},
+		{models.ModeStandard, true, false},
+		// Practice neither counts nor breaks it
+		{models.ModePractice, false, false},
+		{models.ModeStandard, true, false},
+		{models.ModeTime, true, true},
+		{models.ModeStandard, true, false},
+	}
+	for i, step := range steps {
+		unlocked := e.RaceFinished(ctx, race(i, step.mode, step.finished))
+		if got := len(unlocked) == 1; got != step.unlocks {
+			t.Errorf("race %d unlocked %v, want unlocked %v", i, unlocked, step.unlocks)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package achievements
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Events are the moments at which rules are evaluated.
+const (
+	// EventRace fires for each player when a race's results are stored.
+	EventRace = "race"
+	// EventTournamentWin fires when a player wins an elimination session,
+	// the tournament format games are played in.
+	EventTournamentWin = "tournament_win"
+)
+
+// Metrics are the values a rule compares with its threshold. Speed and
+// accuracy are those of the race that fired the event; the others are
+// counted over the player's stored history.
+const (
+	// MetricWPM is the race's words per minute. Unfinished races do not
+	// count.
+	MetricWPM = "wpm"
+	// MetricAccuracy is the race's accuracy in percent. Unfinished races
+	// do not count.
+	MetricAccuracy = "accuracy"
+	// MetricRaces is the number of races played.
+	MetricRaces = "races"
+	// MetricWins is the number of races finished first.
+	MetricWins = "wins"
+	// MetricStreak is the number of races finished in a row, up to the
+	// latest.
+	MetricStreak = "streak"
+	// MetricTournamentWins is the number of elimination sessions won.
+	MetricTournamentWins = "tournament_wins"
+)
+
+// eventMetrics lists the metrics each event can evaluate.
+var eventMetrics = map[string][]string{
+	EventRace:          {MetricWPM, MetricAccuracy, MetricRaces, MetricWins, MetricStreak},
+	EventTournamentWin: {MetricTournamentWins},
+}
+
+// Rule awards an achievement when a metric reaches a threshold at an event.
+type Rule struct {
+	// Type identifies the achievement. Renaming it awards the achievement
+	// again to everyone who qualifies.
+	Type        string  `json:"type"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Event       string  `json:"event"`
+	Metric      string  `json:"metric"`
+	Threshold   float64 `json:"threshold"`
+}
+
+// DefaultRules are used when no rules file is configured.
+var DefaultRules = []Rule{
+	{Type: "first_win", Name: "First Victory", Description: "Win a race", Event: EventRace, Metric: MetricWins, Threshold: 1},
+	{Type: "wpm_100", Name: "Triple Digits", Description: "Finish a race at 100 WPM or more", Event: EventRace, Metric: MetricWPM, Threshold: 100},
+	{Type: "perfect_accuracy", Name: "Flawless", Description: "Finish a race with 100% accuracy", Event: EventRace, Metric: MetricAccuracy, Threshold: 100},
+	{Type: "streak_50", Name: "Marathoner", Description: "Finish 50 races in a row", Event: EventRace, Metric: MetricStreak, Threshold: 50},
+	{Type: "tournament_win", Name: "Champion", Description: "Win an elimination tournament", Event: EventTournamentWin, Metric: MetricTournamentWins, Threshold: 1},
+}
+
+// LoadRules reads rules from a JSON file holding an array of rules, or
+// returns DefaultRules if path is empty.
+func LoadRules(path string) ([]Rule, error) {
+	if path == "" {
+		return DefaultRules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateRules(rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// validateRules reports every invalid rule at once.
+func validateRules(rules []Rule) error {
+	var errs []error
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Type == "" {
+			errs = append(errs, fmt.Errorf("rule %d: type is required", i))
+		} else if seen[rule.Type] {
+			errs = append(errs, fmt.Errorf("rule %d: duplicate type %q", i, rule.Type))
+		}
+		seen[rule.Type] = true
+
+		if rule.Name == "" {
+			errs = append(errs, fmt.Errorf("rule %q: name is required", rule.Type))
+		}
+		metrics, ok := eventMetrics[rule.Event]
+		if !ok {
+			errs = append(errs, fmt.Errorf("rule %q: unknown event %q", rule.Type, rule.Event))
+		} else if !contains(metrics, rule.Metric) {
+			errs = append(errs, fmt.Errorf("rule %q: metric %q is not available at event %q", rule.Type, rule.Metric, rule.Event))
+		}
+		if rule.Threshold <= 0 {
+			errs = append(errs, fmt.Errorf("rule %q: threshold must be positive", rule.Type))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package achievements
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	valid := Rule{Type: "wpm_50", Name: "Fifty", Event: EventRace, Metric: MetricWPM, Threshold: 50}
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  []string
+	}{
+		{"defaults", DefaultRules, nil},
+		{"valid", []Rule{valid}, nil},
+		{"no type", []Rule{{Name: "x", Event: EventRace, Metric: MetricWPM, Threshold: 1}}, []string{"rule 0: type is required"}},
+		{"duplicate type", []Rule{valid, valid}, []string{`rule 1: duplicate type "wpm_50"`}},
+		{"no name", []Rule{{Type: "a", Event: EventRace, Metric: MetricWPM, Threshold: 1}}, []string{`rule "a": name is required`}},
+		{"unknown event", []Rule{{Type: "a", Name: "A", Event: "login", Metric: MetricWPM, Threshold: 1}}, []string{`unknown event "login"`}},
+		{"metric of another event", []Rule{{Type: "a", Name: "A", Event: EventTournamentWin, Metric: MetricWPM, Threshold: 1}}, []string{`metric "wpm" is not available at event "tournament_win"`}},
+		{"zero threshold", []Rule{{Type: "a", Name: "A", Event: EventRace, Metric: MetricWins}}, []string{"threshold must be positive"}},
+		{"every error", []Rule{{Type: "a", Event: "login"}}, []string{"name is required", "unknown event", "threshold must be positive"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRules(tt.rules)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("validateRules = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("validateRules accepted invalid rules")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validateRules error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules("")
+	if err != nil || !reflect.DeepEqual(rules, DefaultRules) {
+		t.Errorf("LoadRules without a path = %v, %v, want the defaults", rules, err)
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := write("rules.json", `[{"type": "races_10", "name": "Regular", "event": "race", "metric": "races", "threshold": 10}]`)
+	rules, err = LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{Type: "races_10", Name: "Regular", Event: EventRace, Metric: MetricRaces, Threshold: 10}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("LoadRules = %+v, want %+v", rules, want)
+	}
+
+	if _, err := LoadRules(write("broken.json", `{"type": "races_10"}`)); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("LoadRules of a non-array = %v, want an error naming the file", err)
+	}
+	if _, err := LoadRules(write("invalid.json", `[{"type": "x", "name": "X", "event": "race", "metric": "rating", "threshold": 1}]`)); err == nil {
+		t.Error("LoadRules accepted an unknown metric")
+	}
+	if _, err := LoadRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadRules of a missing file succeeded")
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a key tokens are signed or verified with, identified by the
+// kid header.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// sign is nil for keys that are only kept to verify tokens issued
+	// before a rotation.
+	sign   interface{}
+	verify interface{}
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at the JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// hmacKey builds an HS256 key from a shared secret.
+func hmacKey(id string, secret []byte) *SigningKey {
+	if id == "" {
+		id = fingerprint(secret)
+	}
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// loadKey reads a key for the given algorithm from a file. HS256 files hold
+// the raw secret; EdDSA and RS256 files hold a PEM private key, or a PEM
+// public key for verification-only keys.
+func loadKey(id, algorithm, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "HS256" {
+		return hmacKey(id, []byte(strings.TrimRight(string(data), "\r\n"))), nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var priv crypto.PrivateKey
+	var pub crypto.PublicKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &SigningKey{ID: id}
+	switch k := priv.(type) {
+	case ed25519.PrivateKey:
+		key.sign, pub = k, k.Public()
+	case *rsa.PrivateKey:
+		key.sign, pub = k, &k.PublicKey
+	}
+
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.verify = k
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+		key.verify = k
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, pub)
+	}
+	if key.Method.Alg() != algorithm {
+		return nil, fmt.Errorf("%s: key is for %s, not %s", path, key.Method.Alg(), algorithm)
+	}
+
+	if key.ID == "" {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		key.ID = fingerprint(der)
+	}
+	return key, nil
+}
+
+// JWK returns the public half of the key. HMAC keys have no public half and
+// return false.
+func (k *SigningKey) JWK() (JWK, bool) {
+	switch pub := k.verify.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// PublicKey decodes the verification key described by the JWK.
+func (j JWK) PublicKey() (interface{}, error) {
+	switch j.Kty {
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, errors.New("invalid RSA modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+}
+
+func fingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
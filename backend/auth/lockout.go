@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// LoginLockout locks accounts after repeated wrong passwords. The lock grows
+// exponentially with every further failure, which makes guessing slow
+// without locking out a user who mistypes a few times.
+type LoginLockout struct {
+	db          *gorm.DB
+	maxFailures int
+	base        time.Duration
+	max         time.Duration
+}
+
+// NewLoginLockout locks an account for base after maxFailures failures,
+// doubling up to max. maxFailures of zero disables locking.
+func NewLoginLockout(db *gorm.DB, maxFailures int, base, max time.Duration) *LoginLockout {
+	return &LoginLockout{
+		db:          db,
+		maxFailures: maxFailures,
+		base:        base,
+		max:         max,
+	}
+}
+
+// Locked returns how much longer the account is locked.
+func (l *LoginLockout) Locked(user *models.User, now time.Time) (time.Duration, bool) {
+	if user.LoginLockedUntil == nil || !now.Before(*user.LoginLockedUntil) {
+		return 0, false
+	}
+	return user.LoginLockedUntil.Sub(now), true
+}
+
+// Failure records a wrong password and returns the lock it causes, if any.
+func (l *LoginLockout) Failure(user *models.User, now time.Time) (time.Duration, error) {
+	if l.maxFailures <= 0 {
+		return 0, nil
+	}
+
+	failures := user.LoginFailures + 1
+	updates := map[string]interface{}{"login_failures": gorm.Expr("login_failures + 1")}
+
+	var lock time.Duration
+	if failures >= l.maxFailures {
+		lock = l.base
+		for i := l.maxFailures; i < failures && lock < l.max; i++ {
+			lock *= 2
+		}
+		if lock > l.max {
+			lock = l.max
+		}
+		updates["login_locked_until"] = now.Add(lock)
+	}
+
+	err := l.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+	return lock, err
+}
+
+// Success clears the failure count after a correct password.
+func (l *LoginLockout) Success(user *models.User) error {
+	if user.LoginFailures == 0 && user.LoginLockedUntil == nil {
+		return nil
+	}
+	return l.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"login_failures":     0,
+		"login_locked_until": nil,
+	}).Error
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxMFAFailures wrong codes in a row lock two-factor login for
+	// mfaLockout, which keeps six-digit codes out of brute-force reach.
+	maxMFAFailures = 5
+	mfaLockout     = 15 * time.Minute
+)
+
+var (
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFALocked         = errors.New("too many invalid two-factor codes")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+// MFA manages TOTP two-factor authentication and the recovery codes that
+// back it up.
+type MFA struct {
+	db     *gorm.DB
+	issuer string
+}
+
+func NewMFA(db *gorm.DB, issuer string) *MFA {
+	return &MFA{
+		db:     db,
+		issuer: issuer,
+	}
+}
+
+// Enroll stores a new pending secret for the user and returns it with its
+// otpauth URI. The secret only takes effect once confirmed with Enable.
+func (m *MFA) Enroll(user *models.User) (secret, uri string, err error) {
+	if user.TwoFactorEnabled() {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err = GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	err = m.db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_secret", secret).Error
+	if err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(m.issuer, user.Username, secret), nil
+}
+
+// Enable turns on two-factor login once the user proves their authenticator
+// works, and returns a fresh set of recovery codes.
+func (m *MFA) Enable(user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := MatchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"totp_enabled_at":  time.Now(),
+			"totp_last_step":   step,
+			"mfa_failures":     0,
+			"mfa_locked_until": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code for a user with two-factor login
+// enabled. Each TOTP code and recovery code is accepted only once.
+func (m *MFA) Verify(user *models.User, code string) error {
+	if !user.TwoFactorEnabled() {
+		return ErrMFANotEnrolled
+	}
+	now := time.Now()
+	if user.MFALockedUntil != nil && now.Before(*user.MFALockedUntil) {
+		return ErrMFALocked
+	}
+
+	code = strings.TrimSpace(code)
+	ok, err := m.useTOTP(user, code, now)
+	if err == nil && !ok {
+		ok, err = m.useRecoveryCode(user.ID, code, now)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return m.recordFailure(user, now)
+	}
+	return m.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"mfa_failures":     0,
+		"mfa_locked_until": nil,
+	}).Error
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes.
+func (m *MFA) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	var codes []string
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func (m *MFA) RemainingRecoveryCodes(userID string) (int64, error) {
+	var count int64
+	err := m.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// Disable removes the user's secret and recovery codes.
+func (m *MFA) Disable(userID string) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":      "",
+			"totp_enabled_at":  nil,
+			"totp_last_step":   0,
+			"mfa_failures":     0,
+			"mfa_locked_until": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// useTOTP accepts a code for a time step later than the last one used. The
+// conditional update makes concurrent logins with the same code race safely.
+func (m *MFA) useTOTP(user *models.User, code string, now time.Time) (bool, error) {
+	step, ok := MatchTOTP(user.TOTPSecret, code, now)
+	if !ok {
+		return false, nil
+	}
+	result := m.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (m *MFA) useRecoveryCode(userID, code string, now time.Time) (bool, error) {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	result := m.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", now)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (m *MFA) recordFailure(user *models.User, now time.Time) error {
+	updates := map[string]interface{}{
+		"mfa_failures": gorm.Expr("mfa_failures + 1"),
+	}
+	if user.MFAFailures+1 >= maxMFAFailures {
+		updates["mfa_failures"] = 0
+		updates["mfa_locked_until"] = now.Add(mfaLockout)
+	}
+	if err := m.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	return ErrInvalidMFACode
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hashToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// randomRecoveryCode returns a code such as "k7q2m-xp4da".
+func randomRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be
+// typed however they were written down.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
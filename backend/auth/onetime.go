@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+// OneTimeTokens issues single-use, expiring tokens for flows such as email
+// verification and password reset. Only SHA-256 hashes are stored.
+type OneTimeTokens struct {
+	db *gorm.DB
+}
+
+func NewOneTimeTokens(db *gorm.DB) *OneTimeTokens {
+	return &OneTimeTokens{
+		db: db,
+	}
+}
+
+// Issue creates a token for the user and invalidates any earlier unused
+// token with the same purpose, so only the latest email link works.
+func (t *OneTimeTokens) Issue(userID string, purpose models.UserTokenPurpose, email, ip string, ttl time.Duration) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = t.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(raw),
+			Email:     email,
+			IP:        ip,
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Consume marks the token used and returns it. A token can be consumed only
+// once and only before it expires.
+func (t *OneTimeTokens) Consume(raw string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var token models.UserToken
+	err := t.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND purpose = ?", hashToken(raw), purpose).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidOneTimeToken
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+			return ErrInvalidOneTimeToken
+		}
+		token.UsedAt = &now
+		return tx.Model(&token).Update("used_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CountSince returns how many tokens with the purpose were issued since the
+// given time, either to userID or from ip. Empty filters are ignored.
+func (t *OneTimeTokens) CountSince(purpose models.UserTokenPurpose, userID, ip string, since time.Time) (int64, error) {
+	query := t.db.Model(&models.UserToken{}).Where("purpose = ? AND created_at > ?", purpose, since)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,228 @@
+// Package auth manages login sessions and the tokens that represent them.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated token is
+	// presented again. The whole token family is revoked, since either the
+	// client or an attacker holds a stolen copy.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// Metadata describes the device a session was created from.
+type Metadata struct {
+	UserAgent string
+	IP        string
+}
+
+// Session is an active login, represented by the latest token of a family.
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// SessionStore issues opaque refresh tokens and keeps their SHA-256 hashes
+// in Postgres. Every refresh rotates the token within its family.
+type SessionStore struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewSessionStore(db *gorm.DB, ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// Issue starts a new session for the user and returns its first refresh
+// token.
+func (s *SessionStore) Issue(userID string, meta Metadata) (string, *models.RefreshToken, error) {
+	return s.create(s.db, userID, uuid.New().String(), meta)
+}
+
+// Rotate exchanges a refresh token for a new one in the same family.
+func (s *SessionStore) Rotate(raw string, meta Metadata) (string, *models.RefreshToken, error) {
+	var token string
+	var record *models.RefreshToken
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(raw)).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil || current.ReplacedByID != "" {
+			// Returning nil commits the family revocation
+			reused = true
+			return revokeFamily(tx, current.FamilyID, now)
+		}
+		if !now.Before(current.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		token, record, err = s.create(tx, current.UserID, current.FamilyID, meta)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&current).Update("replaced_by_id", record.ID).Error
+	})
+
+	if err != nil {
+		return "", nil, err
+	}
+	if reused {
+		return "", nil, ErrRefreshTokenReused
+	}
+	return token, record, nil
+}
+
+// Revoke ends the session the refresh token belongs to.
+func (s *SessionStore) Revoke(raw string) error {
+	var current models.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(raw)).First(&current).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return revokeFamily(s.db, current.FamilyID, time.Now())
+}
+
+// RevokeSession ends one of the user's sessions by ID.
+func (s *SessionStore) RevokeSession(userID, sessionID string) error {
+	result := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, sessionID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of the user.
+func (s *SessionStore) RevokeAll(userID string) error {
+	return s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// List returns the user's active sessions, most recently used first.
+// currentID marks the session the caller is using.
+func (s *SessionStore) List(userID, currentID string) ([]Session, error) {
+	var tokens []models.RefreshToken
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND replaced_by_id = '' AND expires_at > ?", userID, time.Now()).
+		Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var families []struct {
+		FamilyID  string
+		StartedAt time.Time
+	}
+	err = s.db.Model(&models.RefreshToken{}).
+		Select("family_id, MIN(created_at) AS started_at").
+		Where("user_id = ?", userID).
+		Group("family_id").
+		Scan(&families).Error
+	if err != nil {
+		return nil, err
+	}
+	started := make(map[string]time.Time, len(families))
+	for _, f := range families {
+		started[f.FamilyID] = f.StartedAt
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, Session{
+			ID:         t.FamilyID,
+			UserAgent:  t.UserAgent,
+			IP:         t.IP,
+			CreatedAt:  started[t.FamilyID],
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			Current:    t.FamilyID == currentID,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *SessionStore) create(tx *gorm.DB, userID, familyID string, meta Metadata) (string, *models.RefreshToken, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	record := &models.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		UserAgent: meta.UserAgent,
+		IP:        meta.IP,
+		ExpiresAt: now.Add(s.ttl),
+		CreatedAt: now,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, record, nil
+}
+
+func revokeFamily(tx *gorm.DB, familyID string, now time.Time) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+// testDB connects to the Postgres database named by TEST_DATABASE_DSN and
+// migrates it, or skips the test if the variable is not set. Tests work on
+// rows of their own users, so the database may be shared.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestSessionStoreRotate(t *testing.T) {
+	conn := testDB(t)
+	store := NewSessionStore(conn, time.Hour)
+	userID := uuid.New().String()
+	t.Cleanup(func() { conn.Where("user_id = ?", userID).Delete(&models.RefreshToken{}) })
+
+	first, issued, err := store.Issue(userID, Metadata{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, rotated, err := store.Rotate(first, Metadata{UserAgent: "test", IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if second == first {
+		t.Error("Rotate returned the same token")
+	}
+	if rotated.FamilyID != issued.FamilyID || rotated.UserID != userID {
+		t.Errorf("rotated token %+v left the family of %+v", rotated, issued)
+	}
+
+	third, _, err := store.Rotate(second, Metadata{})
+	if err != nil {
+		t.Fatalf("Rotate of the latest token: %v", err)
+	}
+
+	// Presenting a rotated token again revokes the whole family
+	if _, _, err := store.Rotate(first, Metadata{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Rotate of a used token = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := store.Rotate(third, Metadata{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Rotate after reuse = %v, want the family revoked", err)
+	}
+	var live int64
+	conn.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", issued.FamilyID).Count(&live)
+	if live != 0 {
+		t.Errorf("%d tokens of the family are still live", live)
+	}
+
+	// Other sessions of the user are untouched
+	other, _, err := store.Issue(userID, Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Rotate(other, Metadata{}); err != nil {
+		t.Errorf("Rotate of another session: %v", err)
+	}
+}
+
+func TestSessionStoreRotateRejects(t *testing.T) {
+	conn := testDB(t)
+	userID := uuid.New().String()
+	t.Cleanup(func() { conn.Where("user_id = ?", userID).Delete(&models.RefreshToken{}) })
+
+	if _, _, err := NewSessionStore(conn, time.Hour).Rotate("unknown", Metadata{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate of an unknown token = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	expired := NewSessionStore(conn, -time.Minute)
+	raw, _, err := expired.Issue(userID, Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := expired.Rotate(raw, Metadata{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate of an expired token = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	store := NewSessionStore(conn, time.Hour)
+	raw, _, err = store.Issue(userID, Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Rotate(raw, Metadata{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Rotate of a revoked token = %v, want ErrRefreshTokenReused", err)
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"typerace/config"
+	"typerace/models"
+)
+
+type TokenType string
+
+const (
+	// TokenAccess authorizes API requests.
+	TokenAccess TokenType = "access"
+	// TokenMFAChallenge proves the password was checked and lets the
+	// client complete a two-factor login.
+	TokenMFAChallenge TokenType = "mfa_challenge"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are the typed claims of every token the server issues. The subject
+// is the user ID.
+type Claims struct {
+	Username  string    `json:"username"`
+	SessionID string    `json:"sid,omitempty"`
+	Type      TokenType `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the ID of the user the token was issued to.
+func (c *Claims) UserID() string {
+	return c.Subject
+}
+
+// TokenService issues and verifies all tokens. New tokens are signed with the
+// active key; retired keys are kept so tokens issued before a rotation stay
+// valid until they expire.
+type TokenService struct {
+	issuer    string
+	audience  string
+	accessTTL time.Duration
+	active    *SigningKey
+	keys      map[string]*SigningKey
+}
+
+func NewTokenService(cfg config.JWTConfig) (*TokenService, error) {
+	s := &TokenService{
+		issuer:    cfg.Issuer,
+		audience:  cfg.Audience,
+		accessTTL: cfg.AccessTTL,
+		keys:      make(map[string]*SigningKey),
+	}
+
+	var err error
+	if cfg.PrivateKeyFile != "" {
+		s.active, err = loadKey(cfg.KeyID, cfg.Algorithm, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if s.active.sign == nil {
+			return nil, fmt.Errorf("%s: a private key is required to sign tokens", cfg.PrivateKeyFile)
+		}
+	} else {
+		if cfg.Algorithm != "HS256" {
+			return nil, fmt.Errorf("jwt.private_key_file is required for %s", cfg.Algorithm)
+		}
+		s.active = hmacKey(cfg.KeyID, []byte(cfg.Secret))
+	}
+	s.keys[s.active.ID] = s.active
+
+	// Retired keys are listed as kid=path
+	for _, entry := range cfg.PreviousKeys {
+		id, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("jwt.previous_keys: %q is not kid=path", entry)
+		}
+		key, err := loadKey(id, cfg.Algorithm, path)
+		if err != nil {
+			return nil, err
+		}
+		key.sign = nil
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// AccessTTL is how long access tokens are valid for.
+func (s *TokenService) AccessTTL() time.Duration {
+	return s.accessTTL
+}
+
+// IssueAccess creates an access token for the user's session.
+func (s *TokenService) IssueAccess(user *models.User, sessionID string) (string, error) {
+	return s.Issue(user, TokenAccess, sessionID, s.accessTTL)
+}
+
+// Issue creates a token of the given type.
+func (s *TokenService) Issue(user *models.User, typ TokenType, sessionID string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Username:  user.Username,
+		SessionID: sessionID,
+		Type:      typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.sign)
+}
+
+// Parse verifies a token and checks that it is of the expected type. Any
+// failure is reported as ErrInvalidToken wrapping the cause.
+func (s *TokenService) Parse(raw string, expected TokenType) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verify, nil
+	},
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Type != expected {
+		return nil, fmt.Errorf("%w: expected %s token, got %q", ErrInvalidToken, expected, claims.Type)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys tokens may be signed with. HMAC keys are never
+// published.
+func (s *TokenService) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		if jwk, ok := key.JWK(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"typerace/config"
+	"typerace/models"
+)
+
+var testUser = &models.User{ID: "user-1", Username: "ada"}
+
+func testJWTConfig() config.JWTConfig {
+	return config.JWTConfig{
+		Issuer:     "typerace",
+		Audience:   "typerace-api",
+		Algorithm:  "HS256",
+		Secret:     "0123456789abcdef0123456789abcdef",
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+	}
+}
+
+func newTokenService(t *testing.T, cfg config.JWTConfig) *TokenService {
+	t.Helper()
+	s, err := NewTokenService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeKeyFile writes data to a file in a temporary directory and returns
+// its path.
+func writeKeyFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeEd25519Key writes a new Ed25519 key pair as PEM files and returns
+// the paths of the private and public halves.
+func writeEd25519Key(t *testing.T) (private, public string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private = writeKeyFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))
+	public = writeKeyFile(t, "key.pub.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	return private, public
+}
+
+// kid returns the key ID a token was signed with.
+func kid(t *testing.T, raw string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(raw, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := token.Header["kid"].(string)
+	return id
+}
+
+func TestTokenServiceIssueParse(t *testing.T) {
+	s := newTokenService(t, testJWTConfig())
+	raw, err := s.IssueAccess(testUser, "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := s.Parse(raw, TokenAccess)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.UserID() != "user-1" || claims.Username != "ada" || claims.SessionID != "session-1" {
+		t.Errorf("Parse = %+v, want the issued claims", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != 15*time.Minute {
+		t.Errorf("access token lives %s, want 15m", ttl)
+	}
+
+	if _, err := s.Parse(raw, TokenMFAChallenge); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse as an MFA challenge = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenServiceRejects(t *testing.T) {
+	s := newTokenService(t, testJWTConfig())
+	valid, err := s.IssueAccess(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.Issue(testUser, TokenAccess, "", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherIssuer := testJWTConfig()
+	otherIssuer.Issuer = "elsewhere"
+	otherAudience := testJWTConfig()
+	otherAudience.Audience = "elsewhere"
+	otherSecret := testJWTConfig()
+	otherSecret.Secret = "fedcba9876543210fedcba9876543210"
+
+	tests := []struct {
+		name    string
+		service *TokenService
+		raw     string
+	}{
+		{"expired", s, expired},
+		{"tampered", s, valid[:len(valid)-2] + "xx"},
+		{"issuer", newTokenService(t, otherIssuer), valid},
+		{"audience", newTokenService(t, otherAudience), valid},
+		{"secret", newTokenService(t, otherSecret), valid},
+		{"garbage", s, "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.service.Parse(tt.raw, TokenAccess); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Parse = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestTokenServiceHMACRollover(t *testing.T) {
+	oldCfg := testJWTConfig()
+	oldCfg.KeyID = "2024"
+	old := newTokenService(t, oldCfg)
+	issuedBefore, err := old.IssueAccess(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCfg := testJWTConfig()
+	newCfg.KeyID = "2025"
+	newCfg.Secret = "fedcba9876543210fedcba9876543210"
+	newCfg.PreviousKeys = []string{"2024=" + writeKeyFile(t, "2024.key", []byte(oldCfg.Secret+"\n"))}
+	rotated := newTokenService(t, newCfg)
+
+	if _, err := rotated.Parse(issuedBefore, TokenAccess); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+	issuedAfter, err := rotated.IssueAccess(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kid(t, issuedAfter); got != "2025" {
+		t.Errorf("new tokens are signed with kid %q, want 2025", got)
+	}
+	if _, err := old.Parse(issuedAfter, TokenAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("old service parsed a token of the new key: %v", err)
+	}
+	if keys := rotated.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS published HMAC keys: %+v", keys)
+	}
+}
+
+func TestTokenServiceEdDSARollover(t *testing.T) {
+	oldPrivate, oldPublic := writeEd25519Key(t)
+	newPrivate, _ := writeEd25519Key(t)
+
+	oldCfg := testJWTConfig()
+	oldCfg.Algorithm, oldCfg.PrivateKeyFile, oldCfg.KeyID = "EdDSA", oldPrivate, "old"
+	old := newTokenService(t, oldCfg)
+	issuedBefore, err := old.IssueAccess(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the public half of a retired key needs to be kept
+	newCfg := testJWTConfig()
+	newCfg.Algorithm, newCfg.PrivateKeyFile, newCfg.KeyID = "EdDSA", newPrivate, "new"
+	newCfg.PreviousKeys = []string{"old=" + oldPublic}
+	rotated := newTokenService(t, newCfg)
+
+	if _, err := rotated.Parse(issuedBefore, TokenAccess); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+	issuedAfter, err := rotated.IssueAccess(testUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kid(t, issuedAfter); got != "new" {
+		t.Errorf("new tokens are signed with kid %q, want new", got)
+	}
+
+	var kids []string
+	for _, jwk := range rotated.JWKS().Keys {
+		kids = append(kids, jwk.Kid)
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.X == "" {
+			t.Errorf("JWKS key %+v is not an Ed25519 public key", jwk)
+		}
+	}
+	sort.Strings(kids)
+	if len(kids) != 2 || kids[0] != "new" || kids[1] != "old" {
+		t.Errorf("JWKS kids = %v, want [new old]", kids)
+	}
+
+	// An HMAC token keyed with a published public key must not verify
+	jwk, ok := rotated.keys["old"].JWK()
+	if !ok {
+		t.Fatal("old key has no JWK")
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Type:             TokenAccess,
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "typerace", Audience: jwt.ClaimStrings{"typerace-api"}, Subject: "admin", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	})
+	forged.Header["kid"] = "old"
+	raw, err := forged.SignedString([]byte(jwk.X))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Parse(raw, TokenAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse of an HS256 token under an EdDSA kid = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestNewTokenServiceErrors(t *testing.T) {
+	_, public := writeEd25519Key(t)
+	tests := []struct {
+		name string
+		edit func(*config.JWTConfig)
+	}{
+		{"previous key without kid", func(c *config.JWTConfig) { c.PreviousKeys = []string{"/no/kid"} }},
+		{"missing previous key", func(c *config.JWTConfig) { c.PreviousKeys = []string{"old=/does/not/exist"} }},
+		{"verification-only active key", func(c *config.JWTConfig) { c.Algorithm, c.PrivateKeyFile = "EdDSA", public }},
+		{"key for another algorithm", func(c *config.JWTConfig) { c.Algorithm, c.PrivateKeyFile = "RS256", public }},
+		{"asymmetric algorithm without a key", func(c *config.JWTConfig) { c.Algorithm = "EdDSA" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testJWTConfig()
+			tt.edit(&cfg)
+			if _, err := NewTokenService(cfg); err == nil {
+				t.Error("NewTokenService succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"typerace/models"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 6238 appendix B, SHA-1 rows, keeping the last six of the eight
+	// digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+		step, ok := MatchTOTP(rfc6238Secret, tt.want, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("MatchTOTP at %d = %d, %v, want step %d", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"current step", rfc6238Secret, totpCode(key, current), true},
+		{"one step behind", rfc6238Secret, totpCode(key, current-1), true},
+		{"one step ahead", rfc6238Secret, totpCode(key, current+1), true},
+		{"two steps behind", rfc6238Secret, totpCode(key, current-2), false},
+		{"two steps ahead", rfc6238Secret, totpCode(key, current+2), false},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", totpCode(key, current), true},
+		{"short code", rfc6238Secret, totpCode(key, current)[1:], false},
+		{"invalid secret", "not base32!", totpCode(key, current), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := MatchTOTP(tt.secret, tt.code, now); ok != tt.want {
+				t.Errorf("MatchTOTP = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := totpEncoding.DecodeString(secret); err != nil || len(key) != 20 {
+		t.Errorf("secret %q is not 20 bytes of base32", secret)
+	}
+
+	u, err := url.Parse(TOTPURI("Type Race", "ada@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Type Race:ada@example.com" {
+		t.Errorf("URI %s does not name the totp account", u)
+	}
+	q := u.Query()
+	if q.Get("secret") != secret || q.Get("issuer") != "Type Race" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("URI parameters %v", q)
+	}
+}
+
+func TestMFAVerifyRejectsReplay(t *testing.T) {
+	conn := testDB(t)
+	user := &models.User{ID: uuid.New().String(), Username: "totp-" + uuid.New().String()[:8], TOTPSecret: rfc6238Secret}
+	if err := conn.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{})
+		conn.Delete(user)
+	})
+
+	// Keep clear of a step boundary so step-1 stays within the skew
+	if time.Now().Unix()%totpPeriod >= totpPeriod-2 {
+		time.Sleep(3 * time.Second)
+	}
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	step := time.Now().Unix() / totpPeriod
+	mfa := NewMFA(conn, "typerace")
+	if _, err := mfa.Enable(user, totpCode(key, step-1)); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+
+	verify := func(code string) error {
+		var current models.User
+		if err := conn.First(&current, "id = ?", user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return mfa.Verify(&current, code)
+	}
+	if err := verify(totpCode(key, step-1)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify with the code used to enable = %v, want ErrInvalidMFACode", err)
+	}
+	if err := verify(totpCode(key, step)); err != nil {
+		t.Errorf("Verify with the next code: %v", err)
+	}
+	if err := verify(totpCode(key, step)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify replaying a code = %v, want ErrInvalidMFACode", err)
+	}
+}
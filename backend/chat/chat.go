@@ -0,0 +1,259 @@
+// Package chat runs the lobby and in-race chat rooms. Recent messages are
+// kept in Redis; posting checks mutes and bans, enforces the length limit
+// and masks blocked words. Delivery to connected clients is up to the
+// caller.
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+// Lobby is the room every user can chat in.
+const Lobby = "lobby"
+
+// historyTTL is how long a room's history is kept after its last message.
+const historyTTL = 7 * 24 * time.Hour
+
+var (
+	ErrEmpty    = errors.New("message is empty")
+	ErrTooLong  = errors.New("message is too long")
+	ErrMuted    = errors.New("user is muted")
+	ErrNotFound = errors.New("message not found")
+	ErrReported = errors.New("message already reported")
+)
+
+// GameRoom names the chat room of a game.
+func GameRoom(gameID string) string {
+	return "game:" + gameID
+}
+
+// ValidRoom reports whether room names the lobby or a game's room.
+func ValidRoom(room string) bool {
+	if room == Lobby {
+		return true
+	}
+	gameID, ok := strings.CutPrefix(room, "game:")
+	return ok && gameID != ""
+}
+
+// Message is a chat message as stored and delivered.
+type Message struct {
+	ID        string    `json:"id"`
+	Room      string    `json:"room"`
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Service struct {
+	redis     *redis.Client
+	db        *gorm.DB
+	filter    *Filter
+	maxLength int
+	history   int
+}
+
+// New creates a Service that accepts messages of up to maxLength
+// characters and keeps the last history messages of each room.
+func New(client *redis.Client, db *gorm.DB, filter *Filter, maxLength, history int) *Service {
+	return &Service{
+		redis:     client,
+		db:        db,
+		filter:    filter,
+		maxLength: maxLength,
+		history:   history,
+	}
+}
+
+// Post stores a message from userID in room and returns it for delivery.
+// Muted and banned users cannot post.
+func (s *Service) Post(ctx context.Context, room, userID, text string) (*Message, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil, ErrEmpty
+	case utf8.RuneCountInString(text) > s.maxLength:
+		return nil, ErrTooLong
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Select("id", "username", "banned_at", "banned_until", "chat_muted_until").
+		First(&user, "id = ?", userID).Error
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if user.Banned(now) || (user.ChatMutedUntil != nil && now.Before(*user.ChatMutedUntil)) {
+		return nil, ErrMuted
+	}
+
+	message := &Message{
+		ID:        uuid.New().String(),
+		Room:      room,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Text:      s.filter.Clean(text),
+		CreatedAt: now,
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.LPush(ctx, roomKey(room), data)
+	pipe.LTrim(ctx, roomKey(room), 0, int64(s.history-1))
+	pipe.Expire(ctx, roomKey(room), historyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// History returns up to limit of a room's most recent messages, oldest
+// first, leaving out those from the users in hidden.
+func (s *Service) History(ctx context.Context, room string, limit int, hidden map[string]bool) ([]Message, error) {
+	raw, err := s.redis.LRange(ctx, roomKey(room), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, limit)
+	for _, data := range raw {
+		if len(messages) == limit {
+			break
+		}
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err != nil || hidden[m.UserID] {
+			continue
+		}
+		messages = append(messages, m)
+	}
+	// Stored newest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// Find returns a message in a room's history.
+func (s *Service) Find(ctx context.Context, room, id string) (*Message, error) {
+	m, _, err := s.find(ctx, room, id)
+	return m, err
+}
+
+// Delete removes a message from a room's history and returns it.
+func (s *Service) Delete(ctx context.Context, room, id string) (*Message, error) {
+	m, raw, err := s.find(ctx, room, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redis.LRem(ctx, roomKey(room), 1, raw).Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Mute stops a user posting until the given time.
+func (s *Service) Mute(ctx context.Context, userID string, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("chat_muted_until", until).Error
+}
+
+// Unmute lets a muted user post again.
+func (s *Service) Unmute(ctx context.Context, userID string) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("chat_muted_until", nil).Error
+}
+
+// Report files reporterID's report of a message for moderators. Each user
+// can report a message once.
+func (s *Service) Report(ctx context.Context, room, messageID, reporterID, reason string) (*models.ChatReport, error) {
+	m, err := s.Find(ctx, room, messageID)
+	if err != nil {
+		return nil, err
+	}
+	report := models.ChatReport{
+		ID:         uuid.New().String(),
+		Room:       room,
+		MessageID:  m.ID,
+		ReporterID: reporterID,
+		UserID:     m.UserID,
+		Username:   m.Username,
+		Text:       m.Text,
+		Reason:     strings.TrimSpace(reason),
+		CreatedAt:  time.Now(),
+	}
+	res := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrReported
+	}
+	return &report, nil
+}
+
+// Reports returns a page of reports, oldest first, and how many there
+// are. Only unresolved reports are listed unless resolved is set.
+func (s *Service) Reports(ctx context.Context, resolved bool, limit, offset int) ([]models.ChatReport, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.ChatReport{})
+	if !resolved {
+		query = query.Where("resolved_at IS NULL")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	reports := make([]models.ChatReport, 0, limit)
+	err := query.Order("created_at").Limit(limit).Offset(offset).Find(&reports).Error
+	return reports, total, err
+}
+
+// Resolve closes a report, returning ErrNotFound if it does not exist.
+func (s *Service) Resolve(ctx context.Context, id, resolvedBy string) (*models.ChatReport, error) {
+	var report models.ChatReport
+	db := s.db.WithContext(ctx)
+	if err := db.First(&report, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	now := time.Now()
+	report.ResolvedBy = resolvedBy
+	report.ResolvedAt = &now
+	err := db.Model(&report).Updates(map[string]interface{}{
+		"resolved_by": report.ResolvedBy,
+		"resolved_at": report.ResolvedAt,
+	}).Error
+	return &report, err
+}
+
+// find returns a message in a room's history with its stored form.
+func (s *Service) find(ctx context.Context, room, id string) (*Message, string, error) {
+	raw, err := s.redis.LRange(ctx, roomKey(room), 0, -1).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, data := range raw {
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err == nil && m.ID == id {
+			return &m, data, nil
+		}
+	}
+	return nil, "", ErrNotFound
+}
+
+func roomKey(room string) string {
+	return "chat:" + room
+}
@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidRoom(t *testing.T) {
+	tests := []struct {
+		room string
+		want bool
+	}{
+		{Lobby, true},
+		{GameRoom("abc"), true},
+		{"game:", false},
+		{"games:abc", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidRoom(tt.room); got != tt.want {
+			t.Errorf("ValidRoom(%q) = %v, want %v", tt.room, got, tt.want)
+		}
+	}
+}
+
+func TestPostRejects(t *testing.T) {
+	// Messages are checked before the user or Redis is touched
+	s := New(nil, nil, NewFilter(nil), 5, 10)
+	tests := []struct {
+		text string
+		want error
+	}{
+		{"", ErrEmpty},
+		{" \n\t ", ErrEmpty},
+		{"toolong", ErrTooLong},
+		{strings.Repeat("é", 6), ErrTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := s.Post(context.Background(), Lobby, "user", tt.text); !errors.Is(err, tt.want) {
+			t.Errorf("Post(%q) = %v, want %v", tt.text, err, tt.want)
+		}
+	}
+}
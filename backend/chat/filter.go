@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter masks blocked words in messages.
+type Filter struct {
+	re *regexp.Regexp
+}
+
+// NewFilter creates a Filter for whole, case-insensitive matches of words.
+func NewFilter(words []string) *Filter {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &Filter{}
+	}
+	// Longer words first, so a word is not hidden by a blocked prefix that
+	// is rejected for not ending at a word boundary
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return &Filter{
+		re: regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`),
+	}
+}
+
+// Clean replaces every blocked word in text with asterisks.
+func (f *Filter) Clean(text string) string {
+	if f.re == nil {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range f.re.FindAllStringIndex(text, -1) {
+		// \b only knows ASCII word characters, so boundaries are checked
+		// here for words in any script
+		before, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		after, _ := utf8.DecodeRuneInString(text[m[1]:])
+		if (m[0] > 0 && isWordRune(before)) || (m[1] < len(text) && isWordRune(after)) {
+			continue
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[m[0]:m[1]])))
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
@@ -0,0 +1,34 @@
+package chat
+
+import "testing"
+
+func TestFilterClean(t *testing.T) {
+	f := NewFilter([]string{"darn", " heck ", "", "café", "a.b", "darnit"})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"nothing to hide", "nothing to hide"},
+		{"darn", "****"},
+		{"Darn it, DARN!", "**** it, ****!"},
+		{"darned darning", "darned darning"},
+		{"what the heck", "what the ****"},
+		{"darn darn", "**** ****"},
+		{"darnit", "******"},
+		{"un café noir, CAFÉ!", "un **** noir, ****!"},
+		{"cafés", "cafés"},
+		{"décafé", "décafé"},
+		{"a.b but not axb", "*** but not axb"},
+		{"heck_no", "heck_no"},
+		{"heck2", "heck2"},
+	}
+	for _, tt := range tests {
+		if got := f.Clean(tt.text); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	if got := NewFilter(nil).Clean("darn"); got != "darn" {
+		t.Errorf("empty filter changed the text to %q", got)
+	}
+}
@@ -0,0 +1,538 @@
+// Package config loads the server configuration from defaults, an optional
+// YAML or TOML file, environment variables and command-line flags, in that
+// order of increasing precedence.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each field is tagged with its dotted key in the config file and its
+// environment variable. Flags are derived from the key, so database.host is
+// set with -database-host. Fields tagged secret can also be read from the
+// file named by the <ENV>_FILE variable or the <key>_file file key.
+type Config struct {
+	Server        ServerConfig
+	Database      DatabaseConfig
+	Redis         RedisConfig
+	JWT           JWTConfig
+	CORS          CORSConfig
+	Mail          MailConfig
+	OAuth         OAuthConfig
+	Admin         AdminConfig
+	Limits        RateLimitConfig
+	Leaderboard   LeaderboardConfig
+	Achievements  AchievementsConfig
+	Seasons       SeasonsConfig
+	Chat          ChatConfig
+	Notifications NotificationsConfig
+}
+
+type ServerConfig struct {
+	Addr string `key:"server.addr" env:"SERVER_ADDR"`
+	// PublicURL is the frontend address used in links sent to users.
+	PublicURL string `key:"server.public_url" env:"PUBLIC_URL"`
+	// TrustedProxies are the CIDRs of reverse proxies whose
+	// X-Forwarded-For headers are believed. Only loopback is trusted unless
+	// the proxies are listed.
+	TrustedProxies []string `key:"server.trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+type DatabaseConfig struct {
+	Host     string `key:"database.host" env:"DB_HOST"`
+	Port     int    `key:"database.port" env:"DB_PORT"`
+	User     string `key:"database.user" env:"DB_USER"`
+	Password string `key:"database.password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `key:"database.name" env:"DB_NAME"`
+	SSLMode  string `key:"database.sslmode" env:"DB_SSLMODE"`
+	// AutoMigrate applies pending migrations on startup. Disable it to
+	// run them with the migrate command instead.
+	AutoMigrate bool `key:"database.auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+type RedisConfig struct {
+	Addr     string `key:"redis.addr" env:"REDIS_ADDR"`
+	Password string `key:"redis.password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `key:"redis.db" env:"REDIS_DB"`
+}
+
+type JWTConfig struct {
+	Issuer   string `key:"jwt.issuer" env:"JWT_ISSUER"`
+	Audience string `key:"jwt.audience" env:"JWT_AUDIENCE"`
+	// Algorithm is HS256, EdDSA or RS256.
+	Algorithm string `key:"jwt.algorithm" env:"JWT_ALGORITHM"`
+	// Secret is the HS256 signing secret.
+	Secret string `key:"jwt.secret" env:"JWT_SECRET" secret:"true"`
+	// PrivateKeyFile is a PEM private key for EdDSA or RS256.
+	PrivateKeyFile string `key:"jwt.private_key_file" env:"JWT_PRIVATE_KEY_FILE"`
+	// KeyID is the kid of the active key, derived from the key if empty.
+	KeyID string `key:"jwt.key_id" env:"JWT_KEY_ID"`
+	// PreviousKeys are retired kid=path keys still accepted for
+	// verification.
+	PreviousKeys []string      `key:"jwt.previous_keys" env:"JWT_PREVIOUS_KEYS"`
+	AccessTTL    time.Duration `key:"jwt.access_ttl" env:"JWT_ACCESS_TTL"`
+	RefreshTTL   time.Duration `key:"jwt.refresh_ttl" env:"JWT_REFRESH_TTL"`
+}
+
+type MailConfig struct {
+	// Driver is "smtp", or "log" to print mail instead of sending it.
+	Driver       string `key:"mail.driver" env:"MAIL_DRIVER"`
+	From         string `key:"mail.from" env:"MAIL_FROM"`
+	SMTPHost     string `key:"mail.smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `key:"mail.smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `key:"mail.smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `key:"mail.smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	// OutboxDir is where the log driver also writes .eml files.
+	OutboxDir string `key:"mail.outbox_dir" env:"MAIL_OUTBOX_DIR"`
+}
+
+// OAuthConfig enables external login providers. A provider is enabled by
+// setting its client ID.
+type OAuthConfig struct {
+	GitHubClientID     string `key:"oauth.github.client_id" env:"OAUTH_GITHUB_CLIENT_ID"`
+	GitHubClientSecret string `key:"oauth.github.client_secret" env:"OAUTH_GITHUB_CLIENT_SECRET" secret:"true"`
+	GoogleClientID     string `key:"oauth.google.client_id" env:"OAUTH_GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string `key:"oauth.google.client_secret" env:"OAUTH_GOOGLE_CLIENT_SECRET" secret:"true"`
+	// OIDC configures a generic OpenID Connect provider, found through
+	// discovery at OIDCIssuer and served under OIDCName.
+	OIDCName         string   `key:"oauth.oidc.name" env:"OAUTH_OIDC_NAME"`
+	OIDCIssuer       string   `key:"oauth.oidc.issuer" env:"OAUTH_OIDC_ISSUER"`
+	OIDCClientID     string   `key:"oauth.oidc.client_id" env:"OAUTH_OIDC_CLIENT_ID"`
+	OIDCClientSecret string   `key:"oauth.oidc.client_secret" env:"OAUTH_OIDC_CLIENT_SECRET" secret:"true"`
+	OIDCScopes       []string `key:"oauth.oidc.scopes" env:"OAUTH_OIDC_SCOPES"`
+}
+
+type AdminConfig struct {
+	// BootstrapUsers are usernames given the admin role at startup, so a
+	// fresh deployment has someone who can assign roles.
+	BootstrapUsers []string `key:"admin.bootstrap_users" env:"ADMIN_BOOTSTRAP_USERS"`
+}
+
+// RateLimitConfig sets how many requests a minute each client may make.
+// Anonymous clients are counted by IP and logged-in clients by user. Zero
+// disables a limit.
+type RateLimitConfig struct {
+	API           int `key:"ratelimit.api" env:"RATELIMIT_API"`
+	Login         int `key:"ratelimit.login" env:"RATELIMIT_LOGIN"`
+	Register      int `key:"ratelimit.register" env:"RATELIMIT_REGISTER"`
+	CheckUsername int `key:"ratelimit.check_username" env:"RATELIMIT_CHECK_USERNAME"`
+	Progress      int `key:"ratelimit.progress" env:"RATELIMIT_PROGRESS"`
+	// WSMessages limits the messages each websocket connection may send.
+	WSMessages int `key:"ratelimit.ws_messages" env:"RATELIMIT_WS_MESSAGES"`
+	// Chat limits the chat messages each client may post.
+	Chat int `key:"ratelimit.chat" env:"RATELIMIT_CHAT"`
+	// Keystrokes limits the keystroke logs each user may upload.
+	Keystrokes int `key:"ratelimit.keystrokes" env:"RATELIMIT_KEYSTROKES"`
+	// Invitations limits the race invitations each user may send.
+	Invitations int `key:"ratelimit.invitations" env:"RATELIMIT_INVITATIONS"`
+	// FriendRequests limits the friend requests each user may send.
+	FriendRequests int `key:"ratelimit.friend_requests" env:"RATELIMIT_FRIEND_REQUESTS"`
+	// VerifyEmail limits the verification emails each user may request.
+	VerifyEmail int `key:"ratelimit.verify_email" env:"RATELIMIT_VERIFY_EMAIL"`
+	// After LoginMaxFailures wrong passwords in a row an account is locked
+	// for LoginLockout, doubling with every further failure up to
+	// LoginLockoutMax.
+	LoginMaxFailures int           `key:"ratelimit.login_max_failures" env:"RATELIMIT_LOGIN_MAX_FAILURES"`
+	LoginLockout     time.Duration `key:"ratelimit.login_lockout" env:"RATELIMIT_LOGIN_LOCKOUT"`
+	LoginLockoutMax  time.Duration `key:"ratelimit.login_lockout_max" env:"RATELIMIT_LOGIN_LOCKOUT_MAX"`
+}
+
+// LeaderboardConfig tunes the Redis leaderboards.
+type LeaderboardConfig struct {
+	// ReconcileInterval is how often the Redis rankings are rebuilt from
+	// the stored race results.
+	ReconcileInterval time.Duration `key:"leaderboard.reconcile_interval" env:"LEADERBOARD_RECONCILE_INTERVAL"`
+}
+
+// SeasonsConfig tunes season rollover. Seasons themselves are scheduled
+// through the admin API.
+type SeasonsConfig struct {
+	// RatingCarryover is the percentage of each rating's distance from the
+	// initial rating kept when a season ends.
+	RatingCarryover int `key:"seasons.rating_carryover" env:"SEASONS_RATING_CARRYOVER"`
+	// CheckInterval is how often ended seasons are looked for.
+	CheckInterval time.Duration `key:"seasons.check_interval" env:"SEASONS_CHECK_INTERVAL"`
+}
+
+// ChatConfig tunes the lobby and in-race chat.
+type ChatConfig struct {
+	// MaxLength is the longest message accepted, in characters.
+	MaxLength int `key:"chat.max_length" env:"CHAT_MAX_LENGTH"`
+	// History is how many recent messages each room keeps.
+	History int `key:"chat.history" env:"CHAT_HISTORY"`
+	// BlockedWords are masked out of messages, matching whole words
+	// regardless of case.
+	BlockedWords []string `key:"chat.blocked_words" env:"CHAT_BLOCKED_WORDS"`
+}
+
+// NotificationsConfig tunes the notification center.
+type NotificationsConfig struct {
+	// Retention is how long notifications are kept before they are
+	// deleted, read or not.
+	Retention time.Duration `key:"notifications.retention" env:"NOTIFICATIONS_RETENTION"`
+}
+
+type AchievementsConfig struct {
+	// RulesFile is a JSON file of achievement rules replacing the built-in
+	// ones.
+	RulesFile string `key:"achievements.rules_file" env:"ACHIEVEMENTS_RULES_FILE"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `key:"cors.allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+// minSecretLength is the shortest accepted HMAC signing secret, matching
+// the 256-bit output of HS256.
+const minSecretLength = 32
+
+// Default returns the configuration used before any source is applied.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:      ":8080",
+			PublicURL: "http://localhost:3000",
+			// Private ranges are not trusted by default, as clients on the
+			// same network, such as behind a container bridge, could then
+			// pick their own address
+			TrustedProxies: []string{"127.0.0.0/8", "::1/128"},
+		},
+		Database: DatabaseConfig{
+			Host:        "localhost",
+			Port:        5432,
+			User:        "postgres",
+			Name:        "typeracer",
+			SSLMode:     "disable",
+			AutoMigrate: true,
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		JWT: JWTConfig{
+			Issuer:     "typerace",
+			Audience:   "typerace-api",
+			Algorithm:  "HS256",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 7 * 24 * time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"http://localhost:3000"},
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "TypeRacer Elite <no-reply@localhost>",
+			SMTPPort: 587,
+		},
+		Limits: RateLimitConfig{
+			API:              600,
+			Login:            10,
+			Register:         5,
+			CheckUsername:    60,
+			Progress:         600,
+			WSMessages:       300,
+			Chat:             20,
+			Keystrokes:       30,
+			Invitations:      10,
+			FriendRequests:   10,
+			VerifyEmail:      3,
+			LoginMaxFailures: 5,
+			LoginLockout:     30 * time.Second,
+			LoginLockoutMax:  time.Hour,
+		},
+		Leaderboard: LeaderboardConfig{
+			ReconcileInterval: 10 * time.Minute,
+		},
+		Seasons: SeasonsConfig{
+			RatingCarryover: 50,
+			CheckInterval:   time.Minute,
+		},
+		Chat: ChatConfig{
+			MaxLength:    300,
+			History:      100,
+			BlockedWords: []string{"fuck", "shit", "cunt", "bitch", "asshole", "bastard"},
+		},
+		Notifications: NotificationsConfig{
+			Retention: 30 * 24 * time.Hour,
+		},
+		OAuth: OAuthConfig{
+			OIDCName:   "oidc",
+			OIDCScopes: []string{"openid", "email", "profile"},
+		},
+	}
+}
+
+// Load builds the configuration from all sources and validates it. args are
+// the command-line arguments without the program name. The config file is
+// named by the -config flag or the CONFIG_FILE environment variable.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := Parse(args)
+	return cfg, err
+}
+
+// Parse is Load for commands that take positional arguments after the
+// flags, which it returns.
+func Parse(args []string) (*Config, []string, error) {
+	cfg, rest, err := parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, rest, nil
+}
+
+// ParseDatabase is Parse for commands that only connect to the database. It
+// validates the database settings alone, so the rest of the configuration,
+// such as the JWT secret, need not be present.
+func ParseDatabase(args []string) (DatabaseConfig, []string, error) {
+	cfg, rest, err := parse(args)
+	if err != nil {
+		return DatabaseConfig{}, nil, err
+	}
+	if err := cfg.Database.Validate(); err != nil {
+		return DatabaseConfig{}, nil, err
+	}
+	return cfg.Database, rest, nil
+}
+
+// parse reads the configuration from all sources without validating it.
+func parse(args []string) (*Config, []string, error) {
+	cfg := Default()
+	fields := fieldsOf(cfg)
+
+	fs := flag.NewFlagSet("typerace", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flagValues := make(map[string]*string, len(fields))
+	for _, f := range fields {
+		flagValues[f.key] = fs.String(f.flagName(), "", fmt.Sprintf("%s (env %s)", f.key, f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := applyFile(fields, values); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(v); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+		if !f.secret {
+			continue
+		}
+		if path := os.Getenv(f.env + "_FILE"); path != "" {
+			if err := f.setFromFile(path); err != nil {
+				return nil, nil, fmt.Errorf("%s_FILE: %w", f.env, err)
+			}
+		}
+	}
+
+	var explicit []string
+	fs.Visit(func(fl *flag.Flag) { explicit = append(explicit, fl.Name) })
+	for _, f := range fields {
+		for _, name := range explicit {
+			if name != f.flagName() {
+				continue
+			}
+			if err := f.set(*flagValues[f.key]); err != nil {
+				return nil, nil, fmt.Errorf("-%s: %w", name, err)
+			}
+		}
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+// applyFile sets fields from parsed file values, resolving <key>_file
+// entries of secret fields.
+func applyFile(fields []field, values map[string]string) error {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.key] = true
+		if v, ok := values[f.key]; ok {
+			if err := f.set(v); err != nil {
+				return fmt.Errorf("%s: %w", f.key, err)
+			}
+		}
+		if !f.secret {
+			continue
+		}
+		known[f.key+"_file"] = true
+		if path, ok := values[f.key+"_file"]; ok && path != "" {
+			if err := f.setFromFile(path); err != nil {
+				return fmt.Errorf("%s_file: %w", f.key, err)
+			}
+		}
+	}
+
+	for key := range values {
+		if !known[key] {
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if err := c.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Redis.Addr == "" {
+		errs = append(errs, errors.New("redis.addr is required"))
+	}
+	switch c.JWT.Algorithm {
+	case "HS256":
+		if c.JWT.PrivateKeyFile == "" && len(c.JWT.Secret) < minSecretLength {
+			errs = append(errs, fmt.Errorf("jwt.secret must be at least %d bytes", minSecretLength))
+		}
+	case "EdDSA", "RS256":
+		if c.JWT.PrivateKeyFile == "" {
+			errs = append(errs, fmt.Errorf("jwt.private_key_file is required for %s", c.JWT.Algorithm))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jwt.algorithm %q must be HS256, EdDSA or RS256", c.JWT.Algorithm))
+	}
+	if c.JWT.Issuer == "" || c.JWT.Audience == "" {
+		errs = append(errs, errors.New("jwt.issuer and jwt.audience are required"))
+	}
+	if c.JWT.AccessTTL <= 0 {
+		errs = append(errs, errors.New("jwt.access_ttl must be positive"))
+	}
+	if c.JWT.RefreshTTL <= c.JWT.AccessTTL {
+		errs = append(errs, errors.New("jwt.refresh_ttl must be longer than jwt.access_ttl"))
+	}
+	if u, err := url.Parse(c.Server.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("server.public_url: %q is not an absolute URL", c.Server.PublicURL))
+	}
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host is required for the smtp driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver %q must be smtp or log", c.Mail.Driver))
+	}
+	if c.OAuth.GitHubClientID != "" && c.OAuth.GitHubClientSecret == "" {
+		errs = append(errs, errors.New("oauth.github.client_secret is required with oauth.github.client_id"))
+	}
+	if c.OAuth.GoogleClientID != "" && c.OAuth.GoogleClientSecret == "" {
+		errs = append(errs, errors.New("oauth.google.client_secret is required with oauth.google.client_id"))
+	}
+	if c.OAuth.OIDCClientID != "" {
+		if u, err := url.Parse(c.OAuth.OIDCIssuer); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("oauth.oidc.issuer: %q is not an absolute URL", c.OAuth.OIDCIssuer))
+		}
+		switch c.OAuth.OIDCName {
+		case "", "github", "google":
+			errs = append(errs, fmt.Errorf("oauth.oidc.name %q is empty or clashes with a preset", c.OAuth.OIDCName))
+		}
+	}
+	for _, cidr := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not a CIDR", cidr))
+		}
+	}
+	limits := []struct {
+		key string
+		n   int
+	}{
+		{"api", c.Limits.API}, {"login", c.Limits.Login}, {"register", c.Limits.Register},
+		{"check_username", c.Limits.CheckUsername}, {"progress", c.Limits.Progress}, {"ws_messages", c.Limits.WSMessages},
+		{"chat", c.Limits.Chat}, {"keystrokes", c.Limits.Keystrokes},
+		{"invitations", c.Limits.Invitations}, {"friend_requests", c.Limits.FriendRequests},
+		{"verify_email", c.Limits.VerifyEmail},
+	}
+	for _, l := range limits {
+		if l.n < 0 {
+			errs = append(errs, fmt.Errorf("ratelimit.%s cannot be negative", l.key))
+		}
+	}
+	if c.Limits.LoginMaxFailures > 0 && (c.Limits.LoginLockout <= 0 || c.Limits.LoginLockoutMax < c.Limits.LoginLockout) {
+		errs = append(errs, errors.New("ratelimit.login_lockout must be positive and at most ratelimit.login_lockout_max"))
+	}
+	if c.Leaderboard.ReconcileInterval < time.Minute {
+		errs = append(errs, errors.New("leaderboard.reconcile_interval must be at least 1m"))
+	}
+	if c.Seasons.RatingCarryover < 0 || c.Seasons.RatingCarryover > 100 {
+		errs = append(errs, fmt.Errorf("seasons.rating_carryover %d must be between 0 and 100", c.Seasons.RatingCarryover))
+	}
+	if c.Seasons.CheckInterval < time.Second {
+		errs = append(errs, errors.New("seasons.check_interval must be at least 1s"))
+	}
+	if c.Chat.MaxLength < 1 {
+		errs = append(errs, errors.New("chat.max_length must be positive"))
+	}
+	if c.Chat.History < 1 || c.Chat.History > 1000 {
+		errs = append(errs, fmt.Errorf("chat.history %d must be between 1 and 1000", c.Chat.History))
+	}
+	if c.Notifications.Retention < time.Hour {
+		errs = append(errs, errors.New("notifications.retention must be at least 1h"))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins: %q is not an origin", origin))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid database setting at once.
+func (c DatabaseConfig) Validate() error {
+	var errs []error
+	if c.Host == "" || c.User == "" || c.Name == "" {
+		errs = append(errs, errors.New("database.host, database.user and database.name are required"))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("database.port %d is out of range", c.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// DSN returns the PostgreSQL connection string for the database.
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		dsnValue(c.Host), dsnValue(c.User), dsnValue(c.Password), dsnValue(c.Name), strconv.Itoa(c.Port), dsnValue(c.SSLMode))
+}
+
+// dsnValue quotes a connection string value, escaping backslashes and
+// single quotes, so values may contain spaces and quotes.
+func dsnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// AllowsOrigin reports whether origin is in the allow list.
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// writeFile writes content to name in a temporary directory and returns its
+// path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	want := map[string]string{
+		"server.addr":             ":9000",
+		"server.trusted_proxies":  `["10.0.0.0/8", "192.168.0.0/16"]`,
+		"database.host":           "db",
+		"database.password":       "p#ss 'word'",
+		"database.port":           "5433",
+		"jwt.access_ttl":          "10m",
+		"oauth.github.client_id":  "abc",
+		"ratelimit.login_lockout": "30s",
+	}
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", `
+# Comments and blank lines are skipped
+server:
+  addr: ":9000"
+  trusted_proxies: ["10.0.0.0/8", "192.168.0.0/16"]
+
+database:
+  host: db # trailing comment
+  password: "p#ss 'word'"
+  port: 5433
+jwt:
+  access_ttl: 10m
+oauth:
+  github:
+    client_id: abc
+ratelimit:
+  login_lockout: 30s
+`},
+		{"config.toml", `
+# Comments and blank lines are skipped
+[server]
+addr = ":9000"
+trusted_proxies = ["10.0.0.0/8", "192.168.0.0/16"]
+
+[database]
+host = "db" # trailing comment
+password = "p#ss 'word'"
+port = 5433
+
+[jwt]
+access_ttl = "10m"
+
+[oauth.github]
+client_id = "abc"
+
+[ratelimit]
+login_lockout = "30s"
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFile(writeFile(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("readFile = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := readFile(writeFile(t, "config.json", "{}")); err == nil {
+		t.Error("readFile accepted a .json file")
+	}
+	if _, err := readFile(writeFile(t, "config.yaml", "server\n")); err == nil {
+		t.Error("readFile accepted a line without a key")
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	values, err := readFile("../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Secret files named by the example only exist in a deployment
+	for key := range values {
+		if strings.HasSuffix(key, "_file") {
+			values[key] = ""
+		}
+	}
+	if err := applyFile(fieldsOf(Default()), values); err != nil {
+		t.Errorf("config.example.yaml: %v", err)
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+database:
+  host: file-host
+  port: 6000
+  user: file-user
+redis:
+  addr: file-redis:6379
+jwt:
+  secret: `+testSecret+`
+  access_ttl: 5m
+`)
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_PORT", "7000")
+	t.Setenv("DB_USER", "env-user")
+	t.Setenv("JWT_ACCESS_TTL", "20m")
+
+	cfg, args, err := Parse([]string{"-config", path, "-database-port", "8000", "-jwt-access-ttl", "30m", "up", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"default", cfg.Server.Addr, Default().Server.Addr},
+		{"file", cfg.Database.Host, "file-host"},
+		{"file", cfg.Redis.Addr, "file-redis:6379"},
+		{"env over file", cfg.Database.User, "env-user"},
+		{"flag over env", cfg.Database.Port, 8000},
+		{"flag over env", cfg.JWT.AccessTTL, 30 * time.Minute},
+		{"positional arguments", args, []string{"up", "3"}},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestParseSecretFiles(t *testing.T) {
+	secret := writeFile(t, "jwt_secret", testSecret+"\n")
+	password := writeFile(t, "db_password", "from-file\r\n")
+	path := writeFile(t, "config.toml", `
+[jwt]
+secret_file = "`+secret+`"
+[database]
+password = "from-config"
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_PASSWORD_FILE", password)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWT.Secret != testSecret {
+		t.Errorf("jwt.secret = %q, want the contents of jwt.secret_file", cfg.JWT.Secret)
+	}
+	if cfg.Database.Password != "from-file" {
+		t.Errorf("database.password = %q, want the contents of DB_PASSWORD_FILE", cfg.Database.Password)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			name: "unknown key",
+			file: "jwt:\n  secret: " + testSecret + "\n  secert: x\n",
+			want: []string{`unknown key "jwt.secert"`},
+		},
+		{
+			name: "secret file on a plain key",
+			file: "jwt:\n  secret: " + testSecret + "\nserver:\n  addr_file: /tmp/addr\n",
+			want: []string{`unknown key "server.addr_file"`},
+		},
+		{
+			name: "bad integer",
+			env:  map[string]string{"JWT_SECRET": testSecret, "DB_PORT": "five"},
+			want: []string{"DB_PORT", `"five" is not an integer`},
+		},
+		{
+			name: "bad duration flag",
+			env:  map[string]string{"JWT_SECRET": testSecret},
+			args: []string{"-jwt-access-ttl", "soon"},
+			want: []string{"-jwt-access-ttl"},
+		},
+		{
+			name: "every invalid setting",
+			env:  map[string]string{"JWT_SECRET": "short", "MAIL_DRIVER": "pigeon", "RATELIMIT_CHAT": "-1"},
+			want: []string{"jwt.secret must be at least 32 bytes", `mail.driver "pigeon"`, "ratelimit.chat cannot be negative"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+			_, err := Load(args)
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDatabase(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JWT_SECRET", "short")
+	t.Setenv("MAIL_DRIVER", "pigeon")
+
+	db, args, err := ParseDatabase([]string{"-database-host", "migrate-host", "up"})
+	if err != nil {
+		t.Fatalf("ParseDatabase rejected settings it does not use: %v", err)
+	}
+	if db.Host != "migrate-host" || !reflect.DeepEqual(args, []string{"up"}) {
+		t.Errorf("ParseDatabase = %+v, %v", db, args)
+	}
+
+	t.Setenv("DB_PORT", "0")
+	if _, _, err := ParseDatabase([]string{"up"}); err == nil || !strings.Contains(err.Error(), "database.port") {
+		t.Errorf("ParseDatabase error = %v, want the database port rejected", err)
+	}
+}
+
+func TestDSN(t *testing.T) {
+	db := DatabaseConfig{
+		Host:     "db.internal",
+		Port:     5432,
+		User:     "race user",
+		Password: `it's a \secret`,
+		Name:     "typerace",
+		SSLMode:  "disable",
+	}
+	want := `host='db.internal' user='race user' password='it\'s a \\secret' dbname='typerace' port=5432 sslmode='disable'`
+	if got := db.DSN(); got != want {
+		t.Errorf("DSN = %s, want %s", got, want)
+	}
+}
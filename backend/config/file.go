@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFile parses a config file into dotted keys. The format is chosen by
+// extension: .yaml/.yml files use nested "key: value" mappings and .toml
+// files use [section] tables with "key = value" pairs. Only the scalar and
+// inline-list subset used by Config is supported.
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return parseYAML(bufio.NewScanner(f))
+	case ".toml":
+		return parseTOML(bufio.NewScanner(f))
+	}
+	return nil, fmt.Errorf("%s: unsupported config format, use .yaml, .yml or .toml", path)
+}
+
+func parseYAML(sc *bufio.Scanner) (map[string]string, error) {
+	type level struct {
+		indent int
+		key    string
+	}
+	values := make(map[string]string)
+	var stack []level
+
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		path := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			path = append(path, l.key)
+		}
+		path = append(path, strings.TrimSpace(key))
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			stack = append(stack, level{indent: indent, key: strings.TrimSpace(key)})
+			continue
+		}
+		values[strings.Join(path, ".")] = unquote(value)
+	}
+	return values, sc.Err()
+}
+
+func parseTOML(sc *bufio.Scanner) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && !strings.Contains(line, "=") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", n)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+		values[key] = unquote(strings.TrimSpace(value))
+	}
+	return values, sc.Err()
+}
+
+// stripComment removes a trailing # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
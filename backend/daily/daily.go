@@ -0,0 +1,304 @@
+// Package daily schedules the daily challenge: one passage per UTC day that
+// every player may race once for a ranking, and replay unranked. Passages
+// are picked deterministically from the date unless an organizer curated
+// the day.
+package daily
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+// dateLayout names a challenge by its UTC day.
+const dateLayout = "2006-01-02"
+
+// retryInterval is how soon scheduling is retried after a failure.
+const retryInterval = time.Hour
+
+var (
+	ErrNotFound   = errors.New("no daily challenge on that date")
+	ErrNoPassages = errors.New("no passages to choose a daily challenge from")
+)
+
+// Date returns the challenge date of the UTC day containing t.
+func Date(t time.Time) string {
+	return t.UTC().Format(dateLayout)
+}
+
+// ParseDate validates a challenge date.
+func ParseDate(date string) (time.Time, error) {
+	return time.Parse(dateLayout, date)
+}
+
+// Entry is a player's ranked attempt on a day's leaderboard.
+type Entry struct {
+	Rank       int       `json:"rank"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	WPM        int       `json:"wpm"`
+	Accuracy   float64   `json:"accuracy"`
+	GameID     string    `json:"gameId"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Streak is a run of consecutive days with a finished ranked attempt.
+type Streak struct {
+	// Current counts back from today, or from yesterday if today's
+	// challenge has not been finished yet.
+	Current int `json:"current"`
+	Best    int `json:"best"`
+	// LastDate is the most recent day finished, if any.
+	LastDate string `json:"lastDate,omitempty"`
+}
+
+type Scheduler struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Scheduler {
+	return &Scheduler{
+		db: db,
+	}
+}
+
+// Challenge returns the challenge of a date and its passage. Today's is
+// scheduled if the scheduler has not yet done so; earlier days return
+// ErrNotFound if they had none, and future days are not revealed.
+func (s *Scheduler) Challenge(ctx context.Context, date string, now time.Time) (*models.DailyChallenge, *models.Passage, error) {
+	var challenge *models.DailyChallenge
+	switch today := Date(now); {
+	case date > today:
+		return nil, nil, ErrNotFound
+	case date == today:
+		var err error
+		if challenge, err = s.schedule(ctx, date); err != nil {
+			return nil, nil, err
+		}
+	default:
+		challenge = &models.DailyChallenge{}
+		if err := s.db.WithContext(ctx).First(challenge, "date = ?", date).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrNotFound
+			}
+			return nil, nil, err
+		}
+	}
+
+	var passage models.Passage
+	if err := s.db.WithContext(ctx).First(&passage, "id = ?", challenge.PassageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, err
+	}
+	return challenge, &passage, nil
+}
+
+// Curate sets the passage of a future day, replacing any scheduled one.
+func (s *Scheduler) Curate(ctx context.Context, date, passageID, curatedBy string) (*models.DailyChallenge, error) {
+	challenge := models.DailyChallenge{
+		Date:      date,
+		PassageID: passageID,
+		Curated:   true,
+		CreatedBy: curatedBy,
+		CreatedAt: time.Now(),
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"passage_id", "curated", "created_by", "created_at"}),
+	}).Create(&challenge).Error
+	return &challenge, err
+}
+
+// Begin claims userID's ranked attempt at a date's challenge for gameID.
+// It reports false if the user already made their attempt, in which case
+// the game is a replay.
+func (s *Scheduler) Begin(ctx context.Context, date, userID, gameID string) (bool, error) {
+	attempt := models.DailyAttempt{
+		Date:      date,
+		UserID:    userID,
+		GameID:    gameID,
+		StartedAt: time.Now(),
+	}
+	res := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&attempt)
+	return res.RowsAffected == 1, res.Error
+}
+
+// Attempt returns userID's ranked attempt at a date's challenge, or nil.
+func (s *Scheduler) Attempt(ctx context.Context, date, userID string) (*models.DailyAttempt, error) {
+	var attempts []models.DailyAttempt
+	err := s.db.WithContext(ctx).Where("date = ? AND user_id = ?", date, userID).Limit(1).Find(&attempts).Error
+	if err != nil || len(attempts) == 0 {
+		return nil, err
+	}
+	return &attempts[0], nil
+}
+
+// Leaderboard ranks the finished ranked attempts of a date by speed, then
+// accuracy. Equal results share a rank and are listed by finish time.
+func (s *Scheduler) Leaderboard(ctx context.Context, date string, limit, offset int) ([]Entry, int64, error) {
+	db := s.db.WithContext(ctx)
+	var total int64
+	if err := db.Table("(?) AS finished", s.finished(db, date)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]Entry, 0, limit)
+	err := s.ranked(db, date).Order("rank, finished_at").Limit(limit).Offset(offset).Scan(&entries).Error
+	return entries, total, err
+}
+
+// Rank returns userID's entry on a date's leaderboard, or nil.
+func (s *Scheduler) Rank(ctx context.Context, date, userID string) (*Entry, error) {
+	var entries []Entry
+	if err := s.ranked(s.db.WithContext(ctx), date).Where("user_id = ?", userID).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// Streak returns userID's daily challenge streaks as of now.
+func (s *Scheduler) Streak(ctx context.Context, userID string, now time.Time) (Streak, error) {
+	var dates []string
+	err := s.db.WithContext(ctx).Table("daily_attempts a").
+		Joins("JOIN game_results gr ON gr.game_id = a.game_id AND gr.user_id = a.user_id").
+		Where("a.user_id = ? AND gr.finished", userID).
+		Order("a.date").Distinct().Pluck("a.date", &dates).Error
+	if err != nil {
+		return Streak{}, err
+	}
+	return streak(dates, now), nil
+}
+
+// streak measures the runs of consecutive days among dates, sorted
+// ascending.
+func streak(dates []string, now time.Time) Streak {
+	var st Streak
+	run := 0
+	var prev time.Time
+	for _, date := range dates {
+		day, err := ParseDate(date)
+		if err != nil {
+			continue
+		}
+		if run > 0 && day.Equal(prev.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > st.Best {
+			st.Best = run
+		}
+		prev = day
+		st.LastDate = date
+	}
+
+	// The run is still alive until a whole day is missed
+	if st.LastDate == Date(now) || st.LastDate == Date(now.AddDate(0, 0, -1)) {
+		st.Current = run
+	}
+	return st
+}
+
+// finished selects the finished ranked attempts of a date with their
+// results. Banned players are left out.
+func (s *Scheduler) finished(db *gorm.DB, date string) *gorm.DB {
+	return db.Table("daily_attempts a").
+		Select("a.user_id, u.username, gr.wpm, gr.accuracy, a.game_id, gr.created_at AS finished_at").
+		Joins("JOIN game_results gr ON gr.game_id = a.game_id AND gr.user_id = a.user_id").
+		Joins("JOIN users u ON u.id = a.user_id").
+		Where("u.banned_at IS NULL OR u.banned_until <= ?", time.Now()).
+		Where("a.date = ? AND gr.finished", date)
+}
+
+func (s *Scheduler) ranked(db *gorm.DB, date string) *gorm.DB {
+	return db.Table("(?) AS ranked", db.Table("(?) AS finished", s.finished(db, date)).
+		Select("*, RANK() OVER (ORDER BY wpm DESC, accuracy DESC) AS rank"))
+}
+
+// Run schedules today's and tomorrow's challenges at startup and again
+// after every UTC midnight until ctx is done, so each day's challenge is
+// ready before it begins.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		wait := time.Until(nextMidnight(now))
+		for _, day := range []time.Time{now, now.AddDate(0, 0, 1)} {
+			if _, err := s.schedule(ctx, Date(day)); err != nil {
+				log.Printf("Error scheduling daily challenge for %s: %v", Date(day), err)
+				wait = min(wait, retryInterval)
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func nextMidnight(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// schedule returns a date's challenge, picking its passage if it has none.
+// Replicas racing to schedule the same day agree on the first stored pick.
+func (s *Scheduler) schedule(ctx context.Context, date string) (*models.DailyChallenge, error) {
+	db := s.db.WithContext(ctx)
+	var challenge models.DailyChallenge
+	err := db.First(&challenge, "date = ?", date).Error
+	if err == nil {
+		return &challenge, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	passageID, err := s.pick(db, date)
+	if err != nil {
+		return nil, err
+	}
+	challenge = models.DailyChallenge{
+		Date:      date,
+		PassageID: passageID,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&challenge).Error; err != nil {
+		return nil, err
+	}
+	if err := db.First(&challenge, "date = ?", date).Error; err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// pick chooses a prose passage for a date from a hash of the date, so the
+// choice is the same on every replica.
+func (s *Scheduler) pick(db *gorm.DB, date string) (string, error) {
+	var ids []string
+	err := db.Model(&models.Passage{}).Where("type = ?", models.PassageProse).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", ErrNoPassages
+	}
+	h := fnv.New32a()
+	h.Write([]byte(date))
+	return ids[h.Sum32()%uint32(len(ids))], nil
+}
@@ -0,0 +1,83 @@
+package daily
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+func TestStreak(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		dates []string
+		want  Streak
+	}{
+		{"none", nil, Streak{}},
+		{"today", []string{"2024-03-10"}, Streak{Current: 1, Best: 1, LastDate: "2024-03-10"}},
+		{"until yesterday", []string{"2024-03-08", "2024-03-09"}, Streak{Current: 2, Best: 2, LastDate: "2024-03-09"}},
+		{"missed yesterday", []string{"2024-03-07", "2024-03-08"}, Streak{Current: 0, Best: 2, LastDate: "2024-03-08"}},
+		{"gap", []string{"2024-03-01", "2024-03-02", "2024-03-03", "2024-03-09", "2024-03-10"}, Streak{Current: 2, Best: 3, LastDate: "2024-03-10"}},
+		{"across months", []string{"2024-02-28", "2024-02-29", "2024-03-01"}, Streak{Current: 0, Best: 3, LastDate: "2024-03-01"}},
+		{"bad date skipped", []string{"2024-03-09", "someday", "2024-03-10"}, Streak{Current: 2, Best: 2, LastDate: "2024-03-10"}},
+	}
+	for _, tt := range tests {
+		if got := streak(tt.dates, now); got != tt.want {
+			t.Errorf("%s: streak = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	// Late evening west of UTC is already the next challenge day
+	at := time.Date(2024, 3, 10, 22, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+	if got := Date(at); got != "2024-03-11" {
+		t.Errorf("Date = %s, want the UTC day 2024-03-11", got)
+	}
+	if got := nextMidnight(at); !got.Equal(time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("nextMidnight = %s, want the end of the UTC day", got)
+	}
+	if _, err := ParseDate("2024-02-30"); err == nil {
+		t.Error("ParseDate accepted February 30")
+	}
+}
+
+// TestBeginOnce needs the Postgres database named by TEST_DATABASE_DSN.
+func TestBeginOnce(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New().String()
+	t.Cleanup(func() { conn.Where("user_id = ?", userID).Delete(&models.DailyAttempt{}) })
+
+	ctx := context.Background()
+	s := New(conn)
+	first := uuid.New().String()
+	if ranked, err := s.Begin(ctx, "2001-01-01", userID, first); err != nil || !ranked {
+		t.Fatalf("first Begin = %v, %v, want the ranked attempt", ranked, err)
+	}
+	if ranked, err := s.Begin(ctx, "2001-01-01", userID, uuid.New().String()); err != nil || ranked {
+		t.Errorf("second Begin = %v, %v, want a replay", ranked, err)
+	}
+	attempt, err := s.Attempt(ctx, "2001-01-01", userID)
+	if err != nil || attempt == nil || attempt.GameID != first {
+		t.Errorf("Attempt = %+v, %v, want the first game", attempt, err)
+	}
+}
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"log"
 
+	"typerace/config"
 	"typerace/models"
 
 	"gorm.io/driver/postgres"
@@ -14,22 +16,64 @@ type Database struct {
 	*gorm.DB
 }
 
-func InitDB() (*Database, error) {
-	dsn := "host=db user=postgres password=postgres dbname=typeracer port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func InitDB(cfg config.DatabaseConfig) (*Database, error) {
+	db, err := Open(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// Auto Migrate the schema
-	err = db.AutoMigrate(&models.User{}, &models.Game{}, &models.GameResult{})
-	if err != nil {
+	if cfg.AutoMigrate {
+		if err := Migrate(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := seedPassages(db); err != nil {
 		return nil, err
 	}
 
 	return &Database{db}, nil
 }
 
+// Open connects to the database without migrating or seeding it.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+}
+
+// Migrate applies pending schema migrations.
+func Migrate(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	migrator, err := NewMigrator(sqlDB)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	if applied > 0 {
+		log.Printf("Applied %d database migrations", applied)
+	}
+	return err
+}
+
+// PromoteAdmins gives the admin role to the named users. Usernames without
+// an account are skipped.
+func (db *Database) PromoteAdmins(usernames []string) error {
+	for _, username := range usernames {
+		result := db.Model(&models.User{}).
+			Where("LOWER(username) = LOWER(?) AND role <> ?", username, models.RoleAdmin).
+			Update("role", models.RoleAdmin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Promoted %s to admin", username)
+		}
+	}
+	return nil
+}
+
 func (db *Database) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
 	result := db.Where("username = ?", username).First(&user)
@@ -41,22 +85,3 @@ func (db *Database) GetUserByUsername(username string) (*models.User, error) {
 	}
 	return &user, nil
 }
-
-func autoMigrate(db *gorm.DB) error {
-	log.Println("Running database migrations...")
-
-	// Add models here
-	err := db.AutoMigrate(
-		&models.User{},
-		&models.Game{},
-		&models.Player{},
-	)
-
-	if err != nil {
-		log.Printf("Error during migration: %v", err)
-		return err
-	}
-
-	log.Println("Database migration completed successfully")
-	return nil
-}
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS tournaments;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS bigram_stats;
+DROP TABLE IF EXISTS key_stats;
+DROP TABLE IF EXISTS passages;
+DROP TABLE IF EXISTS placements;
+DROP TABLE IF EXISTS game_results;
+DROP TABLE IF EXISTS game_players;
+DROP TABLE IF EXISTS players;
+DROP TABLE IF EXISTS games;
+DROP TABLE IF EXISTS users;
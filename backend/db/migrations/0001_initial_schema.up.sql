@@ -0,0 +1,259 @@
+-- Baseline schema. Databases created by the old GORM AutoMigrate already
+-- have users, games, players, game_players and game_results, so everything
+-- is created only if missing and the columns added since are added to
+-- those tables.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                 text PRIMARY KEY,
+    username           text UNIQUE,
+    email              text UNIQUE,
+    email_verified_at  timestamptz,
+    password_hash      text,
+    avatar             text,
+    total_races        bigint DEFAULT 0,
+    average_wpm        numeric DEFAULT 0,
+    best_wpm           numeric DEFAULT 0,
+    rating             numeric DEFAULT 1500,
+    role               varchar(16) DEFAULT 'player',
+    banned_at          timestamptz,
+    banned_until       timestamptz,
+    ban_reason         text,
+    totp_secret        text,
+    totp_enabled_at    timestamptz,
+    totp_last_step     bigint,
+    mfa_failures       bigint DEFAULT 0,
+    mfa_locked_until   timestamptz,
+    login_failures     bigint DEFAULT 0,
+    login_locked_until timestamptz,
+    created_at         timestamptz,
+    updated_at         timestamptz
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at  timestamptz,
+    ADD COLUMN IF NOT EXISTS rating             numeric DEFAULT 1500,
+    ADD COLUMN IF NOT EXISTS role               varchar(16) DEFAULT 'player',
+    ADD COLUMN IF NOT EXISTS banned_at          timestamptz,
+    ADD COLUMN IF NOT EXISTS banned_until       timestamptz,
+    ADD COLUMN IF NOT EXISTS ban_reason         text,
+    ADD COLUMN IF NOT EXISTS totp_secret        text,
+    ADD COLUMN IF NOT EXISTS totp_enabled_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS totp_last_step     bigint,
+    ADD COLUMN IF NOT EXISTS mfa_failures       bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS mfa_locked_until   timestamptz,
+    ADD COLUMN IF NOT EXISTS login_failures     bigint DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS login_locked_until timestamptz;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username));
+
+CREATE TABLE IF NOT EXISTS games (
+    id            uuid PRIMARY KEY,
+    status        varchar(20) NOT NULL,
+    text          text NOT NULL,
+    replay_data   jsonb,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    category      text,
+    difficulty    text,
+    is_private    boolean,
+    password      text,
+    created_by    text,
+    tournament_id text,
+    mode          varchar(20) DEFAULT 'standard',
+    duration      bigint,
+    word_count    bigint,
+    started_at    timestamptz,
+    session_id    text,
+    round         bigint,
+    passage_id    text,
+    passage_type  varchar(20) DEFAULT 'prose',
+    code_language text,
+    language      varchar(16) DEFAULT 'en'
+);
+
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS mode          varchar(20) DEFAULT 'standard',
+    ADD COLUMN IF NOT EXISTS duration      bigint,
+    ADD COLUMN IF NOT EXISTS word_count    bigint,
+    ADD COLUMN IF NOT EXISTS started_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS session_id    text,
+    ADD COLUMN IF NOT EXISTS round         bigint,
+    ADD COLUMN IF NOT EXISTS passage_id    text,
+    ADD COLUMN IF NOT EXISTS passage_type  varchar(20) DEFAULT 'prose',
+    ADD COLUMN IF NOT EXISTS code_language text,
+    ADD COLUMN IF NOT EXISTS language      varchar(16) DEFAULT 'en';
+
+CREATE TABLE IF NOT EXISTS players (
+    id            uuid PRIMARY KEY,
+    user_id       uuid,
+    game_id       uuid,
+    name          text,
+    progress      numeric DEFAULT 0,
+    wpm           bigint DEFAULT 0,
+    accuracy      numeric DEFAULT 0,
+    avatar        text,
+    correct_words bigint,
+    finished_at   timestamptz
+);
+
+ALTER TABLE players
+    ADD COLUMN IF NOT EXISTS correct_words bigint,
+    ADD COLUMN IF NOT EXISTS finished_at   timestamptz;
+
+CREATE TABLE IF NOT EXISTS game_players (
+    game_id   uuid REFERENCES games (id),
+    player_id uuid REFERENCES players (id),
+    PRIMARY KEY (game_id, player_id)
+);
+
+CREATE TABLE IF NOT EXISTS game_results (
+    id          text PRIMARY KEY,
+    game_id     text,
+    user_id     text,
+    wpm         bigint,
+    accuracy    numeric,
+    position    bigint,
+    mode        text,
+    correct_wpm numeric,
+    created_at  timestamptz
+);
+
+ALTER TABLE game_results
+    ADD COLUMN IF NOT EXISTS mode        text,
+    ADD COLUMN IF NOT EXISTS correct_wpm numeric;
+
+CREATE TABLE IF NOT EXISTS placements (
+    id               text PRIMARY KEY,
+    session_id       text,
+    user_id          text,
+    name             text,
+    placement        bigint,
+    eliminated_round bigint,
+    created_at       timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_placements_session_id ON placements (session_id);
+CREATE INDEX IF NOT EXISTS idx_placements_user_id ON placements (user_id);
+
+CREATE TABLE IF NOT EXISTS passages (
+    id            text PRIMARY KEY,
+    type          varchar(20) NOT NULL DEFAULT 'prose',
+    code_language text,
+    language      varchar(16) NOT NULL DEFAULT 'en',
+    title         text,
+    source        text,
+    text          text NOT NULL,
+    created_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_passages_type ON passages (type);
+CREATE INDEX IF NOT EXISTS idx_passages_code_language ON passages (code_language);
+CREATE INDEX IF NOT EXISTS idx_passages_language ON passages (language);
+
+CREATE TABLE IF NOT EXISTS key_stats (
+    user_id          text,
+    key              text,
+    presses          bigint,
+    errors           bigint,
+    total_latency_ms bigint,
+    updated_at       timestamptz,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS bigram_stats (
+    user_id          text,
+    bigram           text,
+    presses          bigint,
+    errors           bigint,
+    total_latency_ms bigint,
+    updated_at       timestamptz,
+    PRIMARY KEY (user_id, bigram)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id             text PRIMARY KEY,
+    user_id        text NOT NULL,
+    family_id      text NOT NULL,
+    token_hash     text NOT NULL,
+    user_agent     text,
+    ip             text,
+    expires_at     timestamptz,
+    revoked_at     timestamptz,
+    replaced_by_id text,
+    created_at     timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    purpose    varchar(32) NOT NULL,
+    token_hash text NOT NULL,
+    email      text,
+    ip         text,
+    expires_at timestamptz,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_purpose ON user_tokens (purpose);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tokens_token_hash ON user_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_ip ON user_tokens (ip);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_created_at ON user_tokens (created_at);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    code_hash  text NOT NULL,
+    used_at    timestamptz,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recovery_codes_code_hash ON recovery_codes (code_hash);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    provider   varchar(32) NOT NULL,
+    subject    text NOT NULL,
+    email      text,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identity_subject ON user_identities (provider, subject);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id          text PRIMARY KEY,
+    actor_id    text NOT NULL,
+    actor_role  varchar(16),
+    action      varchar(64) NOT NULL,
+    target_type varchar(32),
+    target_id   text,
+    details     text,
+    ip          text,
+    created_at  timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_target_id ON audit_logs (target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at);
+
+CREATE TABLE IF NOT EXISTS tournaments (
+    id          text PRIMARY KEY,
+    name        text NOT NULL,
+    description text,
+    start_time  timestamptz,
+    end_time    timestamptz,
+    max_players bigint,
+    status      varchar(20) DEFAULT 'pending',
+    created_by  text,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
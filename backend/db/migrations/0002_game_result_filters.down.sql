@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_game_results_user_id;
+DROP INDEX IF EXISTS idx_game_results_created_at;
+
+ALTER TABLE game_results
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS difficulty,
+    DROP COLUMN IF EXISTS category;
@@ -0,0 +1,7 @@
+ALTER TABLE game_results
+    ADD COLUMN IF NOT EXISTS category   text,
+    ADD COLUMN IF NOT EXISTS difficulty text,
+    ADD COLUMN IF NOT EXISTS language   text;
+
+CREATE INDEX IF NOT EXISTS idx_game_results_created_at ON game_results (created_at);
+CREATE INDEX IF NOT EXISTS idx_game_results_user_id ON game_results (user_id);
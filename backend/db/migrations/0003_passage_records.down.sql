@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_game_results_passage_hash;
+
+ALTER TABLE game_results
+    DROP COLUMN IF EXISTS record,
+    DROP COLUMN IF EXISTS passage_id,
+    DROP COLUMN IF EXISTS passage_hash;
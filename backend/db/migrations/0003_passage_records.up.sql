@@ -0,0 +1,7 @@
+ALTER TABLE game_results
+    ADD COLUMN IF NOT EXISTS passage_hash text,
+    ADD COLUMN IF NOT EXISTS passage_id   text,
+    ADD COLUMN IF NOT EXISTS record       boolean NOT NULL DEFAULT false;
+
+CREATE INDEX IF NOT EXISTS idx_game_results_passage_hash ON game_results (passage_hash, wpm DESC)
+    WHERE passage_hash IS NOT NULL AND passage_hash <> '';
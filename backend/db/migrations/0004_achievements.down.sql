@@ -0,0 +1,4 @@
+ALTER TABLE game_results
+    DROP COLUMN IF EXISTS finished;
+
+DROP TABLE IF EXISTS achievements;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS achievements (
+    id          text PRIMARY KEY,
+    user_id     text NOT NULL,
+    type        text NOT NULL,
+    name        text,
+    description text,
+    unlocked_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_achievements_user_type ON achievements (user_id, type);
+
+-- Whether the player finished is unknown for older results; count them as
+-- finished so existing streaks are not broken.
+ALTER TABLE game_results
+    ADD COLUMN IF NOT EXISTS finished boolean NOT NULL DEFAULT true;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS seasons (
+    id          text PRIMARY KEY,
+    name        text NOT NULL,
+    starts_at   timestamptz NOT NULL,
+    ends_at     timestamptz NOT NULL,
+    archived_at timestamptz,
+    created_by  text,
+    created_at  timestamptz,
+    updated_at  timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_seasons_starts_at ON seasons (starts_at);
+
+CREATE TABLE IF NOT EXISTS season_standings (
+    season_id  text NOT NULL,
+    user_id    text NOT NULL,
+    username   text,
+    rank       bigint,
+    rating     numeric,
+    races      bigint,
+    wins       bigint,
+    avg_wpm    numeric,
+    best_wpm   bigint,
+    created_at timestamptz,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_season_standings_rank ON season_standings (season_id, rank);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_game_results_game_id;
+DROP TABLE IF EXISTS daily_attempts;
+DROP TABLE IF EXISTS daily_challenges;
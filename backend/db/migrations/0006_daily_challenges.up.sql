@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS daily_challenges (
+    date       varchar(10) PRIMARY KEY,
+    passage_id text NOT NULL,
+    curated    boolean NOT NULL DEFAULT false,
+    created_by text,
+    created_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS daily_attempts (
+    date       varchar(10) NOT NULL,
+    user_id    text NOT NULL,
+    game_id    text NOT NULL,
+    started_at timestamptz,
+    PRIMARY KEY (date, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_daily_attempts_user_id ON daily_attempts (user_id, date);
+CREATE INDEX IF NOT EXISTS idx_game_results_game_id ON game_results (game_id);
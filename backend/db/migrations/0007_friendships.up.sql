@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS friendships (
+    user_id    text NOT NULL,
+    friend_id  text NOT NULL,
+    status     varchar(16) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (user_id, friend_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_friendships_friend_id ON friendships (friend_id, status);
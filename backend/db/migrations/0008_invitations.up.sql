@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id            text PRIMARY KEY,
+    challenger_id text NOT NULL,
+    opponent_id   text NOT NULL,
+    game_id       text,
+    mode          varchar(20),
+    passage_id    text,
+    status        varchar(16) NOT NULL,
+    expires_at    timestamptz,
+    responded_at  timestamptz,
+    created_at    timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_challenger_id ON invitations (challenger_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_opponent_id ON invitations (opponent_id);
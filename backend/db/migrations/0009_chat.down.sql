@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS chat_reports;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS chat_muted_until;
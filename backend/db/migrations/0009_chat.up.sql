@@ -0,0 +1,19 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS chat_muted_until timestamptz;
+
+CREATE TABLE IF NOT EXISTS chat_reports (
+    id          text PRIMARY KEY,
+    room        text NOT NULL,
+    message_id  text NOT NULL,
+    reporter_id text NOT NULL,
+    user_id     text NOT NULL,
+    username    text,
+    text        text,
+    reason      text,
+    resolved_by text,
+    resolved_at timestamptz,
+    created_at  timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_reports_message_reporter ON chat_reports (message_id, reporter_id);
+CREATE INDEX IF NOT EXISTS idx_chat_reports_user_id ON chat_reports (user_id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    type       varchar(32) NOT NULL,
+    data       text,
+    read_at    timestamptz,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at);
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/models"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0010_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (c);")},
+		"m/0010_add_index.down.sql":    {Data: []byte("DROP INDEX i;")},
+		"m/0002_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c int);")},
+		"m/0002_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+	}
+	got, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 2, Name: "create_table", Up: "CREATE TABLE t (c int);", Down: "DROP TABLE t;"},
+		{Version: 10, Name: "add_index", Up: "CREATE INDEX i ON t (c);", Down: "DROP INDEX i;"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMigrations = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"bad name", []string{"0001_Init.up.sql", "0001_Init.down.sql"}, "name must be"},
+		{"no version", []string{"init.up.sql", "init.down.sql"}, "name must be"},
+		{"stray file", []string{"0001_init.up.sql", "0001_init.down.sql", "README.md"}, "name must be"},
+		{"missing down", []string{"0001_init.up.sql"}, "needs both"},
+		{"missing up", []string{"0001_init.down.sql"}, "needs both"},
+		{"two names", []string{"0001_init.up.sql", "0001_setup.down.sql"}, "two names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			}
+			_, err := loadMigrations(fsys, ".")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadMigrations = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := NewMigrator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, migration := range m.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s breaks the version sequence at %d", migration.Version, migration.Name, i+1)
+		}
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("migration %d_%s has an empty script", migration.Version, migration.Name)
+		}
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	up, down, err := CreateMigration(dir, "Create Users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0001_create_users.up.sql" || filepath.Base(down) != "0001_create_users.down.sql" {
+		t.Errorf("first migration = %s, %s", up, down)
+	}
+
+	up, _, err = CreateMigration(dir, "add_email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(up) != "0002_add_email.up.sql" {
+		t.Errorf("second migration = %s, want version 2", up)
+	}
+	migrations, err := loadMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		t.Fatalf("created migrations do not load: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Errorf("loaded %d migrations, want 2", len(migrations))
+	}
+
+	if _, _, err := CreateMigration(dir, "drop-users!"); err == nil {
+		t.Error("CreateMigration accepted a name with punctuation")
+	}
+}
+
+// TestMigratorStatus needs the Postgres database named by
+// TEST_DATABASE_DSN. It only applies pending migrations, so the database may
+// be shared.
+func TestMigratorStatus(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	gormDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := gormDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	m, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if applied, err := m.Up(ctx); err != nil || applied != 0 {
+		t.Errorf("second Up = %d, %v, want nothing to apply", applied, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d_%s is not applied", s.Version, s.Name)
+		}
+	}
+}
+
+// The tables as the GORM AutoMigrate that preceded migrations created them.
+type (
+	baselineUser struct {
+		ID           string `gorm:"primaryKey"`
+		Username     string `gorm:"unique"`
+		Email        string `gorm:"unique;default:null"`
+		PasswordHash string
+		Avatar       string
+		TotalRaces   int     `gorm:"default:0"`
+		AverageWPM   float64 `gorm:"default:0"`
+		BestWPM      float64 `gorm:"default:0"`
+		CreatedAt    time.Time
+		UpdatedAt    time.Time
+	}
+	baselineGame struct {
+		ID           uuid.UUID        `gorm:"type:uuid;primary_key;"`
+		Status       string           `gorm:"type:varchar(20);not null"`
+		Text         string           `gorm:"not null"`
+		Players      []baselinePlayer `gorm:"many2many:game_players;joinForeignKey:GameID;joinReferences:PlayerID"`
+		ReplayData   []byte           `gorm:"type:jsonb"`
+		CreatedAt    time.Time
+		UpdatedAt    time.Time
+		Category     string
+		Difficulty   string
+		IsPrivate    bool
+		Password     string
+		CreatedBy    string
+		TournamentID string
+	}
+	baselinePlayer struct {
+		ID       uuid.UUID `gorm:"type:uuid;primary_key;"`
+		UserID   uuid.UUID `gorm:"type:uuid;"`
+		GameID   uuid.UUID `gorm:"type:uuid;"`
+		Name     string
+		Progress float64 `gorm:"default:0"`
+		WPM      int     `gorm:"default:0"`
+		Accuracy float64 `gorm:"default:0"`
+		Avatar   string
+	}
+	baselineGameResult struct {
+		ID        string `gorm:"primaryKey"`
+		GameID    string
+		UserID    string
+		WPM       int
+		Accuracy  float64
+		Position  int
+		CreatedAt time.Time
+	}
+)
+
+func (baselineUser) TableName() string       { return "users" }
+func (baselineGame) TableName() string       { return "games" }
+func (baselinePlayer) TableName() string     { return "players" }
+func (baselineGameResult) TableName() string { return "game_results" }
+
+// TestMigrateAutoMigratedDatabase needs the Postgres database named by
+// TEST_DATABASE_DSN. It builds the AutoMigrate schema in a schema of its own
+// and checks the migrations bring it up to date with the models.
+func TestMigrateAutoMigratedDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "automigrated_" + strings.ReplaceAll(uuid.New().String()[:8], "-", "")
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// Every connection of the pool must see only the new schema
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&search_path=" + schema
+		} else {
+			dsn += "?search_path=" + schema
+		}
+	} else {
+		dsn += " search_path=" + schema
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AutoMigrate(&baselineUser{}, &baselineGame{}, &baselinePlayer{}, &baselineGameResult{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(conn); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	for _, model := range []any{
+		&models.User{}, &models.Game{}, &models.Player{}, &models.GameResult{},
+	} {
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !conn.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s has no column %s", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+
+	user := models.User{ID: uuid.New().String(), Username: "automigrated"}
+	if err := conn.Create(&user).Error; err != nil {
+		t.Fatalf("create a user: %v", err)
+	}
+	var role string
+	if err := conn.Raw("SELECT role FROM users WHERE id = ?", user.ID).Scan(&role).Error; err != nil || role == "" {
+		t.Errorf("new user has role %q, %v, want the default", role, err)
+	}
+}
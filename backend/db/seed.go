@@ -0,0 +1,102 @@
+package db
+
+import (
+	"time"
+
+	"typerace/models"
+
+	"gorm.io/gorm"
+)
+
+// defaultPassages are inserted on startup when missing so that a fresh
+// database can host prose and code races.
+var defaultPassages = []models.Passage{
+	{
+		ID:    "prose-quick-fox",
+		Type:  models.PassageProse,
+		Title: "Pangram",
+		Text:  "The quick brown fox jumps over the lazy dog while the five boxing wizards jump quickly.",
+	},
+	{
+		ID:       "prose-fr-hugo",
+		Type:     models.PassageProse,
+		Language: "fr",
+		Title:    "Les Misérables",
+		Text:     "Il n’y a ni mauvaises herbes ni mauvais hommes. Il n’y a que de mauvais cultivateurs.",
+	},
+	{
+		ID:       "prose-ja-basho",
+		Type:     models.PassageProse,
+		Language: "ja",
+		Title:    "古池",
+		Text:     "古池や蛙飛び込む水の音。静かな夏の午後に、小さな音が響いた。",
+	},
+	{
+		ID:       "prose-zh-analects",
+		Type:     models.PassageProse,
+		Language: "zh",
+		Title:    "论语",
+		Text:     "学而时习之，不亦说乎？有朋自远方来，不亦乐乎？",
+	},
+	{
+		ID:       "prose-hi-proverb",
+		Type:     models.PassageProse,
+		Language: "hi",
+		Title:    "कहावत",
+		Text:     "जहाँ चाह वहाँ राह। धीरे धीरे रे मना, धीरे सब कुछ होय।",
+	},
+	{
+		ID:       "prose-en-emoji",
+		Type:     models.PassageProse,
+		Language: "en",
+		Title:    "Emoji",
+		Text:     "Race day 🏁 is here: the team 👩‍💻👨‍💻 cheers, the flag 🇯🇵 waves, and everyone types fast! 👍🏽",
+	},
+	{
+		ID:           "code-go-http-handler",
+		Type:         models.PassageCode,
+		CodeLanguage: "go",
+		Title:        "HTTP handler",
+		Text: "func hello(w http.ResponseWriter, r *http.Request) {\n" +
+			"\tname := r.URL.Query().Get(\"name\")\n" +
+			"\tif name == \"\" {\n" +
+			"\t\tname = \"world\"\n" +
+			"\t}\n" +
+			"\tfmt.Fprintf(w, \"hello, %s\\n\", name)\n" +
+			"}",
+	},
+	{
+		ID:           "code-python-fib",
+		Type:         models.PassageCode,
+		CodeLanguage: "python",
+		Title:        "Fibonacci generator",
+		Text: "def fib(limit):\n" +
+			"    a, b = 0, 1\n" +
+			"    while a < limit:\n" +
+			"        yield a\n" +
+			"        a, b = b, a + b",
+	},
+	{
+		ID:           "code-javascript-debounce",
+		Type:         models.PassageCode,
+		CodeLanguage: "javascript",
+		Title:        "Debounce",
+		Text: "function debounce(fn, wait) {\n" +
+			"  let timer;\n" +
+			"  return (...args) => {\n" +
+			"    clearTimeout(timer);\n" +
+			"    timer = setTimeout(() => fn(...args), wait);\n" +
+			"  };\n" +
+			"}",
+	},
+}
+
+func seedPassages(db *gorm.DB) error {
+	for _, passage := range defaultPassages {
+		passage.CreatedAt = time.Now()
+		if err := db.Where("id = ?", passage.ID).FirstOrCreate(&passage).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"typerace/auth"
+	"typerace/mailer"
+	"typerace/middleware"
+	"typerace/models"
+)
+
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+	// resetWindow, maxResetsPerUser and maxResetsPerIP bound how many
+	// password reset emails can be requested.
+	resetWindow      = time.Hour
+	maxResetsPerUser = 3
+	maxResetsPerIP   = 10
+	// maxVerificationsPerUser bounds the verification emails a user can
+	// request within resetWindow.
+	maxVerificationsPerUser = 5
+	mailTimeout             = 10 * time.Second
+)
+
+// AccountHandler serves the email verification and password reset flows
+type AccountHandler struct {
+	db        *gorm.DB
+	mailer    mailer.Mailer
+	tokens    *auth.OneTimeTokens
+	sessions  *auth.SessionStore
+	publicURL string
+}
+
+func NewAccountHandler(db *gorm.DB, m mailer.Mailer, sessions *auth.SessionStore, publicURL string) *AccountHandler {
+	return &AccountHandler{
+		db:        db,
+		mailer:    m,
+		tokens:    auth.NewOneTimeTokens(db),
+		sessions:  sessions,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// RequestEmailVerification sends a verification link to the calling user's
+// email address, optionally setting a new address first
+func (h *AccountHandler) RequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		email = user.Email
+	}
+	// Keep only the address, so a display name is neither stored nor
+	// put in the To header
+	addr, err := mail.ParseAddress(email)
+	if err != nil {
+		http.Error(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+	email = addr.Address
+	if strings.EqualFold(email, user.Email) && user.EmailVerifiedAt != nil {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.User{}).Where("LOWER(email) = LOWER(?) AND id <> ?", email, user.ID).Count(&count)
+	if count > 0 {
+		http.Error(w, "Email already registered", http.StatusConflict)
+		return
+	}
+
+	since := time.Now().Add(-resetWindow)
+	if count, err := h.tokens.CountSince(models.PurposeVerifyEmail, user.ID, "", since); err != nil || count >= maxVerificationsPerUser {
+		w.Header().Set("Retry-After", fmt.Sprint(int(resetWindow.Seconds())))
+		http.Error(w, "Too many verification requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	token, err := h.tokens.Issue(user.ID, models.PurposeVerifyEmail, email, middleware.ClientIP(r), verifyEmailTTL)
+	if err != nil {
+		log.Printf("Failed to issue verification token for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.send(r.Context(), mailer.Message{
+		To:      email,
+		Subject: "Verify your TypeRacer Elite email",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link within 24 hours:\n\n%s\n",
+			user.Username, h.link("/verify-email", token)),
+	})
+	if err != nil {
+		log.Printf("Failed to send verification email to %s: %v", email, err)
+		http.Error(w, "Failed to send verification email", http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// ConfirmEmail marks the address a verification token was sent to as the
+// user's verified email
+func (h *AccountHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.tokens.Consume(req.Token, models.PurposeVerifyEmail)
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to consume verification token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	err = h.db.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+		"email":             token.Email,
+		"email_verified_at": now,
+		"updated_at":        now,
+	}).Error
+	if err != nil {
+		log.Printf("Failed to verify email for %s: %v", token.UserID, err)
+		http.Error(w, "Email already registered", http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ForgotPassword emails a password reset link. It responds the same way
+// whether or not the account exists, so it cannot be used to discover
+// registered addresses.
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	since := time.Now().Add(-resetWindow)
+	if count, err := h.tokens.CountSince(models.PurposePasswordReset, "", ip, since); err == nil && count >= maxResetsPerIP {
+		w.Header().Set("Retry-After", fmt.Sprint(int(resetWindow.Seconds())))
+		http.Error(w, "Too many reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	accepted := map[string]string{"message": "If the address is registered, a reset link has been sent"}
+
+	// Only verified addresses can receive reset links
+	var user models.User
+	err := h.db.Where("LOWER(email) = LOWER(?) AND email_verified_at IS NOT NULL", strings.TrimSpace(req.Email)).First(&user).Error
+	if err != nil {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(accepted)
+		return
+	}
+
+	if count, err := h.tokens.CountSince(models.PurposePasswordReset, user.ID, "", since); err != nil || count >= maxResetsPerUser {
+		log.Printf("Password reset for %s suppressed by rate limit", user.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(accepted)
+		return
+	}
+
+	token, err := h.tokens.Issue(user.ID, models.PurposePasswordReset, user.Email, ip, passwordResetTTL)
+	if err != nil {
+		log.Printf("Failed to issue reset token for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.send(r.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your TypeRacer Elite password",
+		Body: fmt.Sprintf("Hi %s,\n\nReset your password by opening this link within an hour:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, h.link("/reset-password", token)),
+	})
+	if err != nil {
+		log.Printf("Failed to send reset email to %s: %v", user.Email, err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(accepted)
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out of every session
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < 6 {
+		http.Error(w, "Password must be at least 6 characters long", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := h.tokens.Consume(req.Token, models.PurposePasswordReset)
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to consume reset token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+		"password_hash": string(hashedPassword),
+		"updated_at":    time.Now(),
+	}).Error
+	if err != nil {
+		log.Printf("Failed to reset password for %s: %v", token.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.sessions.RevokeAll(token.UserID); err != nil {
+		log.Printf("Failed to revoke sessions after password reset for %s: %v", token.UserID, err)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
+
+func (h *AccountHandler) send(ctx context.Context, msg mailer.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+	defer cancel()
+	return h.mailer.Send(ctx, msg)
+}
+
+func (h *AccountHandler) link(path, token string) string {
+	return h.publicURL + path + "?token=" + url.QueryEscape(token)
+}
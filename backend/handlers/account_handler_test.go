@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/auth"
+	"typerace/db"
+	"typerace/mailer"
+	"typerace/middleware"
+	"typerace/models"
+)
+
+// testDB connects to the Postgres database named by TEST_DATABASE_DSN and
+// migrates it, or skips the test if the variable is not set. Tests work on
+// rows of their own users, so the database may be shared.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// testUser stores a user of the test's own and removes it with its tokens
+// when the test ends.
+func testUser(t *testing.T, conn *gorm.DB, user models.User) *models.User {
+	t.Helper()
+	user.ID = uuid.New().String()
+	if user.Username == "" {
+		user.Username = "test-" + user.ID[:8]
+	}
+	if err := conn.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Where("user_id = ?", user.ID).Delete(&models.UserToken{})
+		conn.Delete(&user)
+	})
+	return &user
+}
+
+// post calls handler with a JSON body, as userID when it is set.
+func post(handler http.HandlerFunc, userID, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	if userID != "" {
+		r = r.WithContext(middleware.WithIdentity(r.Context(), middleware.Identity{UserID: userID}))
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// mailedToken returns the token in the link of the latest mail.
+func mailedToken(t *testing.T, m *mailer.LogMailer) string {
+	t.Helper()
+	sent := m.Sent()
+	if len(sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	for _, field := range strings.Fields(sent[len(sent)-1].Body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatal("mail has no token link")
+	return ""
+}
+
+func TestEmailVerification(t *testing.T) {
+	conn := testDB(t)
+	m := mailer.NewLogMailer("test@localhost", "")
+	h := NewAccountHandler(conn, m, auth.NewSessionStore(conn, time.Hour), "http://localhost:3000")
+	user := testUser(t, conn, models.User{})
+	address := user.ID[:8] + "@example.com"
+
+	w := post(h.RequestEmailVerification, user.ID, `{"email": "Bob <`+address+`>"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("RequestEmailVerification = %d %s", w.Code, w.Body)
+	}
+	if to := m.Sent()[0].To; to != address {
+		t.Errorf("mail sent to %q, want only the address %q", to, address)
+	}
+	token := mailedToken(t, m)
+
+	if w := post(h.ConfirmEmail, "", `{"token": "`+token+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("ConfirmEmail = %d %s", w.Code, w.Body)
+	}
+	var verified models.User
+	conn.First(&verified, "id = ?", user.ID)
+	if verified.Email != address || verified.EmailVerifiedAt == nil {
+		t.Errorf("user has email %q verified at %v", verified.Email, verified.EmailVerifiedAt)
+	}
+	if w := post(h.ConfirmEmail, "", `{"token": "`+token+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("ConfirmEmail with a used token = %d, want 400", w.Code)
+	}
+
+	expired, err := h.tokens.Issue(user.ID, models.PurposeVerifyEmail, "other-"+address, "", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := post(h.ConfirmEmail, "", `{"token": "`+expired+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("ConfirmEmail with an expired token = %d, want 400", w.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	conn := testDB(t)
+	m := mailer.NewLogMailer("test@localhost", "")
+	h := NewAccountHandler(conn, m, auth.NewSessionStore(conn, time.Hour), "http://localhost:3000")
+	now := time.Now()
+	user := testUser(t, conn, models.User{Email: uuid.New().String()[:8] + "@example.com", EmailVerifiedAt: &now})
+
+	if w := post(h.ForgotPassword, "", `{"email": "`+user.Email+`"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("ForgotPassword = %d %s", w.Code, w.Body)
+	}
+	token := mailedToken(t, m)
+
+	if w := post(h.ResetPassword, "", `{"token": "`+token+`", "password": "new-password"}`); w.Code != http.StatusOK {
+		t.Fatalf("ResetPassword = %d %s", w.Code, w.Body)
+	}
+	if w := post(h.ResetPassword, "", `{"token": "`+token+`", "password": "another-password"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("ResetPassword with a used token = %d, want 400", w.Code)
+	}
+
+	expired, err := h.tokens.Issue(user.ID, models.PurposePasswordReset, user.Email, "", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := post(h.ResetPassword, "", `{"token": "`+expired+`", "password": "another-password"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("ResetPassword with an expired token = %d, want 400", w.Code)
+	}
+}
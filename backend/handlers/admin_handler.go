@@ -0,0 +1,874 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"typerace/auth"
+	"typerace/chat"
+	"typerace/daily"
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/websocket"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// AdminHandler serves the admin API. Routes are guarded by
+// middleware.Authorizer; every change is written to the audit log.
+type AdminHandler struct {
+	db       *gorm.DB
+	games    *GameHandler
+	sessions *auth.SessionStore
+	mfa      *auth.MFA
+	daily    *daily.Scheduler
+	chat     *chat.Service
+}
+
+func NewAdminHandler(db *gorm.DB, games *GameHandler, sessions *auth.SessionStore, mfa *auth.MFA, scheduler *daily.Scheduler, chatService *chat.Service) *AdminHandler {
+	return &AdminHandler{
+		db:       db,
+		games:    games,
+		sessions: sessions,
+		mfa:      mfa,
+		daily:    scheduler,
+		chat:     chatService,
+	}
+}
+
+// ListUsers searches users by username or email, optionally filtered by
+// role or ban status
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.User{})
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", like, like)
+	}
+	if role := r.URL.Query().Get("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if banned, err := strconv.ParseBool(r.URL.Query().Get("banned")); err == nil {
+		active := "banned_at IS NOT NULL AND (banned_until IS NULL OR banned_until > ?)"
+		if banned {
+			query = query.Where(active, time.Now())
+		} else {
+			query = query.Not(active, time.Now())
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Failed to count users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	limit, offset := pagination(r, defaultAdminPageSize, maxAdminPageSize)
+	var users []models.User
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		log.Printf("Failed to list users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+		"total": total,
+	})
+}
+
+// BanUser suspends an account, for a number of hours or indefinitely, and
+// ends all of its sessions
+func (h *AdminHandler) BanUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+		// Hours is the length of the ban; zero bans indefinitely.
+		Hours int `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" || req.Hours < 0 {
+		http.Error(w, "A reason and a non-negative duration are required", http.StatusBadRequest)
+		return
+	}
+
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"banned_at":    now,
+		"banned_until": nil,
+		"ban_reason":   req.Reason,
+	}
+	if req.Hours > 0 {
+		updates["banned_until"] = now.Add(time.Duration(req.Hours) * time.Hour)
+	}
+	if err := h.db.Model(target).Updates(updates).Error; err != nil {
+		log.Printf("Failed to ban user %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := h.sessions.RevokeAll(target.ID); err != nil {
+		log.Printf("Failed to revoke sessions of banned user %s: %v", target.ID, err)
+	}
+	h.games.boards.Remove(r.Context(), target.ID)
+
+	h.audit(r, "user.ban", "user", target.ID, map[string]interface{}{
+		"username": target.Username,
+		"reason":   req.Reason,
+		"hours":    req.Hours,
+	})
+	json.NewEncoder(w).Encode(target)
+}
+
+// UnbanUser lifts a ban
+func (h *AdminHandler) UnbanUser(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.db.Model(target).Updates(map[string]interface{}{
+		"banned_at":    nil,
+		"banned_until": nil,
+		"ban_reason":   "",
+	}).Error
+	if err != nil {
+		log.Printf("Failed to unban user %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "user.unban", "user", target.ID, map[string]interface{}{"username": target.Username})
+	json.NewEncoder(w).Encode(target)
+}
+
+// SetRole changes a user's role
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role models.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	previous := target.Role
+	if err := h.db.Model(target).Update("role", req.Role).Error; err != nil {
+		log.Printf("Failed to set role of %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "user.role", "user", target.ID, map[string]interface{}{
+		"username": target.Username,
+		"from":     previous,
+		"to":       req.Role,
+	})
+	json.NewEncoder(w).Encode(target)
+}
+
+// ResetTwoFactor removes two-factor authentication from an account, for
+// users who have lost both their authenticator and recovery codes
+func (h *AdminHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.mfa.Disable(target.ID); err != nil {
+		log.Printf("Failed to reset two-factor authentication for %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "user.reset_2fa", "user", target.ID, map[string]interface{}{"username": target.Username})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EndGame force-ends a running game
+func (h *AdminHandler) EndGame(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["id"]
+	game, exists := h.games.getGame(gameID)
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	previous := game.Status
+	h.games.finishGame(game)
+
+	h.audit(r, "game.end", "game", gameID, map[string]interface{}{"status": previous})
+	json.NewEncoder(w).Encode(game)
+}
+
+// DeleteResult removes a recorded race result, such as one set by cheating
+func (h *AdminHandler) DeleteResult(w http.ResponseWriter, r *http.Request) {
+	var result models.GameResult
+	if err := h.db.First(&result, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Result not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&result).Error; err != nil {
+			return err
+		}
+		// Hand the passage record to the next fastest result
+		if result.Record && result.PassageHash != "" {
+			return h.games.boards.ReflagPassageRecord(tx, result.PassageHash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to delete result %s: %v", result.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.games.boards.Rebuild(r.Context())
+
+	h.audit(r, "result.delete", "result", result.ID, result)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPassages returns stored passages, optionally filtered by type and
+// language
+func (h *AdminHandler) ListPassages(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.Passage{})
+	if t := r.URL.Query().Get("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	if lang := r.URL.Query().Get("language"); lang != "" {
+		query = query.Where("language = ?", lang)
+	}
+
+	limit, offset := pagination(r, defaultAdminPageSize, maxAdminPageSize)
+	var passages []models.Passage
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&passages).Error; err != nil {
+		log.Printf("Failed to list passages: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(passages)
+}
+
+// CreatePassage adds a passage to the race pool
+func (h *AdminHandler) CreatePassage(w http.ResponseWriter, r *http.Request) {
+	var passage models.Passage
+	if err := json.NewDecoder(r.Body).Decode(&passage); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validPassage(w, &passage) {
+		return
+	}
+
+	passage.ID = uuid.New().String()
+	passage.CreatedAt = time.Now()
+	if err := h.db.Create(&passage).Error; err != nil {
+		log.Printf("Failed to create passage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "passage.create", "passage", passage.ID, map[string]interface{}{"title": passage.Title})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(passage)
+}
+
+// UpdatePassage replaces a passage's text and metadata
+func (h *AdminHandler) UpdatePassage(w http.ResponseWriter, r *http.Request) {
+	var existing models.Passage
+	if err := h.db.First(&existing, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Passage not found", http.StatusNotFound)
+		return
+	}
+
+	var passage models.Passage
+	if err := json.NewDecoder(r.Body).Decode(&passage); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validPassage(w, &passage) {
+		return
+	}
+
+	passage.ID = existing.ID
+	passage.CreatedAt = existing.CreatedAt
+	if err := h.db.Save(&passage).Error; err != nil {
+		log.Printf("Failed to update passage %s: %v", passage.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "passage.update", "passage", passage.ID, map[string]interface{}{"title": passage.Title})
+	json.NewEncoder(w).Encode(passage)
+}
+
+// DeletePassage removes a passage from the race pool
+func (h *AdminHandler) DeletePassage(w http.ResponseWriter, r *http.Request) {
+	var passage models.Passage
+	if err := h.db.First(&passage, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Passage not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.db.Delete(&passage).Error; err != nil {
+		log.Printf("Failed to delete passage %s: %v", passage.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "passage.delete", "passage", passage.ID, map[string]interface{}{"title": passage.Title})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTournaments returns all tournaments, newest first
+func (h *AdminHandler) ListTournaments(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.Tournament{})
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	limit, offset := pagination(r, defaultAdminPageSize, maxAdminPageSize)
+	var tournaments []models.Tournament
+	if err := query.Order("start_time DESC").Limit(limit).Offset(offset).Find(&tournaments).Error; err != nil {
+		log.Printf("Failed to list tournaments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tournaments)
+}
+
+// CreateTournament schedules a tournament
+func (h *AdminHandler) CreateTournament(w http.ResponseWriter, r *http.Request) {
+	var tournament models.Tournament
+	if err := json.NewDecoder(r.Body).Decode(&tournament); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if tournament.Status == "" {
+		tournament.Status = models.TournamentPending
+	}
+	if !validTournament(w, &tournament) {
+		return
+	}
+
+	now := time.Now()
+	tournament.ID = uuid.New().String()
+	tournament.CreatedBy = middleware.UserID(r)
+	tournament.CreatedAt = now
+	tournament.UpdatedAt = now
+	if err := h.db.Create(&tournament).Error; err != nil {
+		log.Printf("Failed to create tournament: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "tournament.create", "tournament", tournament.ID, map[string]interface{}{"name": tournament.Name})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tournament)
+}
+
+// UpdateTournament changes a tournament's details or status
+func (h *AdminHandler) UpdateTournament(w http.ResponseWriter, r *http.Request) {
+	var existing models.Tournament
+	if err := h.db.First(&existing, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Tournament not found", http.StatusNotFound)
+		return
+	}
+
+	var tournament models.Tournament
+	if err := json.NewDecoder(r.Body).Decode(&tournament); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if tournament.Status == "" {
+		tournament.Status = existing.Status
+	}
+	if !validTournament(w, &tournament) {
+		return
+	}
+
+	tournament.ID = existing.ID
+	tournament.CreatedBy = existing.CreatedBy
+	tournament.CreatedAt = existing.CreatedAt
+	tournament.UpdatedAt = time.Now()
+	if err := h.db.Save(&tournament).Error; err != nil {
+		log.Printf("Failed to update tournament %s: %v", tournament.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "tournament.update", "tournament", tournament.ID, map[string]interface{}{
+		"name":   tournament.Name,
+		"status": tournament.Status,
+	})
+	json.NewEncoder(w).Encode(tournament)
+}
+
+// DeleteTournament cancels a tournament
+func (h *AdminHandler) DeleteTournament(w http.ResponseWriter, r *http.Request) {
+	var tournament models.Tournament
+	if err := h.db.First(&tournament, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Tournament not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.db.Delete(&tournament).Error; err != nil {
+		log.Printf("Failed to delete tournament %s: %v", tournament.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "tournament.delete", "tournament", tournament.ID, map[string]interface{}{"name": tournament.Name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateSeason schedules a season
+func (h *AdminHandler) CreateSeason(w http.ResponseWriter, r *http.Request) {
+	var season models.Season
+	if err := json.NewDecoder(r.Body).Decode(&season); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	season.ID = uuid.New().String()
+	if !h.validSeason(w, &season) {
+		return
+	}
+
+	now := time.Now()
+	season.ArchivedAt = nil
+	season.CreatedBy = middleware.UserID(r)
+	season.CreatedAt = now
+	season.UpdatedAt = now
+	if err := h.db.Create(&season).Error; err != nil {
+		log.Printf("Failed to create season: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "season.create", "season", season.ID, map[string]interface{}{
+		"name":     season.Name,
+		"startsAt": season.StartsAt,
+		"endsAt":   season.EndsAt,
+	})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(season)
+}
+
+// UpdateSeason renames or reschedules a season that has not been archived
+func (h *AdminHandler) UpdateSeason(w http.ResponseWriter, r *http.Request) {
+	var existing models.Season
+	if err := h.db.First(&existing, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+	if existing.ArchivedAt != nil {
+		http.Error(w, "Season has already been archived", http.StatusConflict)
+		return
+	}
+
+	var season models.Season
+	if err := json.NewDecoder(r.Body).Decode(&season); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	season.ID = existing.ID
+	if !h.validSeason(w, &season) {
+		return
+	}
+
+	season.ArchivedAt = nil
+	season.CreatedBy = existing.CreatedBy
+	season.CreatedAt = existing.CreatedAt
+	season.UpdatedAt = time.Now()
+	if err := h.db.Save(&season).Error; err != nil {
+		log.Printf("Failed to update season %s: %v", season.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "season.update", "season", season.ID, map[string]interface{}{
+		"name":     season.Name,
+		"startsAt": season.StartsAt,
+		"endsAt":   season.EndsAt,
+	})
+	json.NewEncoder(w).Encode(season)
+}
+
+// DeleteSeason cancels a season that has not been archived
+func (h *AdminHandler) DeleteSeason(w http.ResponseWriter, r *http.Request) {
+	var season models.Season
+	if err := h.db.First(&season, "id = ?", mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return
+	}
+	if season.ArchivedAt != nil {
+		http.Error(w, "Season has already been archived", http.StatusConflict)
+		return
+	}
+
+	if err := h.db.Delete(&season).Error; err != nil {
+		log.Printf("Failed to delete season %s: %v", season.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "season.delete", "season", season.ID, map[string]interface{}{"name": season.Name})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CurateDaily sets the passage of a future day's challenge. Days that have
+// begun keep their passage so every attempt races the same text.
+func (h *AdminHandler) CurateDaily(w http.ResponseWriter, r *http.Request) {
+	date := mux.Vars(r)["date"]
+	if _, err := daily.ParseDate(date); err != nil {
+		http.Error(w, "Date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if date <= daily.Date(time.Now()) {
+		http.Error(w, "Only future days can be curated", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		PassageID string `json:"passageId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var passage models.Passage
+	if err := h.db.First(&passage, "id = ?", req.PassageID).Error; err != nil {
+		http.Error(w, "Passage not found", http.StatusNotFound)
+		return
+	}
+
+	actor, _ := middleware.IdentityFrom(r.Context())
+	challenge, err := h.daily.Curate(r.Context(), date, passage.ID, actor.UserID)
+	if err != nil {
+		log.Printf("Failed to curate daily challenge for %s: %v", date, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "daily.curate", "daily", date, map[string]interface{}{"passageId": passage.ID, "title": passage.Title})
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// DeleteChatMessage removes a message from a chat room's history and from
+// connected clients
+func (h *AdminHandler) DeleteChatMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	room := vars["room"]
+	if !chat.ValidRoom(room) {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	message, err := h.chat.Delete(r.Context(), room, vars["id"])
+	if errors.Is(err, chat.ErrNotFound) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete chat message %s: %v", vars["id"], err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	deliverChat(h.games.Hub, room, websocket.Message{
+		Type: "chat_deleted",
+		Data: map[string]interface{}{
+			"room": room,
+			"id":   message.ID,
+		},
+	}, nil)
+	h.audit(r, "chat.delete", "chat_message", message.ID, map[string]interface{}{
+		"room":   room,
+		"userId": message.UserID,
+		"text":   message.Text,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MuteUser stops a user posting chat messages for a number of minutes
+func (h *AdminHandler) MuteUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason  string `json:"reason"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" || req.Minutes <= 0 {
+		http.Error(w, "A reason and a positive duration are required", http.StatusBadRequest)
+		return
+	}
+
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	if err := h.chat.Mute(r.Context(), target.ID, until); err != nil {
+		log.Printf("Failed to mute user %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	target.ChatMutedUntil = &until
+
+	h.audit(r, "user.mute", "user", target.ID, map[string]interface{}{
+		"username": target.Username,
+		"reason":   req.Reason,
+		"minutes":  req.Minutes,
+	})
+	json.NewEncoder(w).Encode(target)
+}
+
+// UnmuteUser lets a muted user chat again
+func (h *AdminHandler) UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	_, target, ok := h.actorAndTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.chat.Unmute(r.Context(), target.ID); err != nil {
+		log.Printf("Failed to unmute user %s: %v", target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	target.ChatMutedUntil = nil
+
+	h.audit(r, "user.unmute", "user", target.ID, map[string]interface{}{"username": target.Username})
+	json.NewEncoder(w).Encode(target)
+}
+
+// ListChatReports returns open chat reports, oldest first, or all of them
+// with ?resolved=true
+func (h *AdminHandler) ListChatReports(w http.ResponseWriter, r *http.Request) {
+	resolved, _ := strconv.ParseBool(r.URL.Query().Get("resolved"))
+	limit, offset := pagination(r, defaultAdminPageSize, maxAdminPageSize)
+	reports, total, err := h.chat.Reports(r.Context(), resolved, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list chat reports: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reports": reports,
+		"total":   total,
+	})
+}
+
+// ResolveChatReport closes a chat report
+func (h *AdminHandler) ResolveChatReport(w http.ResponseWriter, r *http.Request) {
+	report, err := h.chat.Resolve(r.Context(), mux.Vars(r)["id"], middleware.UserID(r))
+	if errors.Is(err, chat.ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to resolve chat report %s: %v", mux.Vars(r)["id"], err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, "chat.report.resolve", "chat_report", report.ID, map[string]interface{}{"messageId": report.MessageID})
+	json.NewEncoder(w).Encode(report)
+}
+
+// validSeason checks a season's fields and that it does not overlap
+// another season, writing an error response if it is invalid
+func (h *AdminHandler) validSeason(w http.ResponseWriter, s *models.Season) bool {
+	switch {
+	case strings.TrimSpace(s.Name) == "":
+		http.Error(w, "Season name is required", http.StatusBadRequest)
+		return false
+	case s.StartsAt.IsZero() || s.EndsAt.IsZero():
+		http.Error(w, "startsAt and endsAt are required", http.StatusBadRequest)
+		return false
+	case !s.EndsAt.After(s.StartsAt):
+		http.Error(w, "Season must end after it starts", http.StatusBadRequest)
+		return false
+	case !s.EndsAt.After(time.Now()):
+		http.Error(w, "Season must end in the future", http.StatusBadRequest)
+		return false
+	}
+
+	var clash models.Season
+	err := h.db.Where("id <> ? AND starts_at < ? AND ends_at > ?", s.ID, s.EndsAt, s.StartsAt).First(&clash).Error
+	switch {
+	case err == nil:
+		http.Error(w, "Season overlaps "+clash.Name, http.StatusConflict)
+		return false
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		log.Printf("Failed to check season overlap: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// ListAuditLog returns audit entries, newest first, filtered by actor,
+// action or target
+func (h *AdminHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.AuditLog{})
+	for param, column := range map[string]string{"actor": "actor_id", "action": "action", "target": "target_id"} {
+		if v := r.URL.Query().Get(param); v != "" {
+			query = query.Where(column+" = ?", v)
+		}
+	}
+
+	limit, offset := pagination(r, defaultAdminPageSize, maxAdminPageSize)
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		log.Printf("Failed to list audit log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// actorAndTarget loads the calling admin and the user named in the path,
+// and checks that the caller outranks the target. Admins may act on anyone
+// but themselves.
+func (h *AdminHandler) actorAndTarget(w http.ResponseWriter, r *http.Request) (*models.User, *models.User, bool) {
+	var actor, target models.User
+	if err := h.db.First(&actor, "id = ?", middleware.UserID(r)).Error; err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+	err := h.db.First(&target, "id = ?", mux.Vars(r)["id"]).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to load user: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if actor.ID == target.ID {
+		http.Error(w, "You cannot change your own account here", http.StatusForbidden)
+		return nil, nil, false
+	}
+	if actor.Role != models.RoleAdmin && actor.Role.Rank() <= target.Role.Rank() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return &actor, &target, true
+}
+
+// audit writes an audit log entry for the calling user. Failures are logged
+// rather than failing the already completed action.
+func (h *AdminHandler) audit(r *http.Request, action, targetType, targetID string, details interface{}) {
+	actor, _ := middleware.IdentityFrom(r.Context())
+	entry := models.AuditLog{
+		ID:         uuid.New().String(),
+		ActorID:    actor.UserID,
+		ActorRole:  actor.Role,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         middleware.ClientIP(r),
+		CreatedAt:  time.Now(),
+	}
+	if details != nil {
+		if data, err := json.Marshal(details); err == nil {
+			entry.Details = string(data)
+		}
+	}
+
+	if err := h.db.Create(&entry).Error; err != nil {
+		log.Printf("Failed to write audit log for %s by %s: %v", action, entry.ActorID, err)
+	}
+}
+
+func validPassage(w http.ResponseWriter, p *models.Passage) bool {
+	if strings.TrimSpace(p.Text) == "" {
+		http.Error(w, "Passage text is required", http.StatusBadRequest)
+		return false
+	}
+	if p.Type == "" {
+		p.Type = models.PassageProse
+	}
+	if !p.Type.Valid() {
+		http.Error(w, "Invalid passage type", http.StatusBadRequest)
+		return false
+	}
+	if p.Type == models.PassageCode && p.CodeLanguage == "" {
+		http.Error(w, "Code passages need a codeLanguage", http.StatusBadRequest)
+		return false
+	}
+	if p.Language == "" {
+		p.Language = "en"
+	}
+	return true
+}
+
+func validTournament(w http.ResponseWriter, t *models.Tournament) bool {
+	switch {
+	case strings.TrimSpace(t.Name) == "":
+		http.Error(w, "Tournament name is required", http.StatusBadRequest)
+	case !t.Status.Valid():
+		http.Error(w, "Invalid tournament status", http.StatusBadRequest)
+	case !t.EndTime.IsZero() && t.EndTime.Before(t.StartTime):
+		http.Error(w, "Tournament must end after it starts", http.StatusBadRequest)
+	case t.MaxPlayers < 0:
+		http.Error(w, "maxPlayers cannot be negative", http.StatusBadRequest)
+	default:
+		return true
+	}
+	return false
+}
+
+// pagination reads the limit and offset query parameters
+func pagination(r *http.Request, defaultLimit, maxLimit int) (int, int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
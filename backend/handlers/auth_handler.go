@@ -2,27 +2,44 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"typerace/models"
+	"typerace/auth"
 	"typerace/db"
+	"typerace/middleware"
+	"typerace/models"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// mfaChallengeTTL is how long a user has to enter their two-factor code
+// after their password was accepted.
+const mfaChallengeTTL = 5 * time.Minute
+
 type AuthHandler struct {
-	db *db.Database
+	db       *db.Database
+	tokens   *auth.TokenService
+	sessions *auth.SessionStore
+	mfa      *auth.MFA
+	lockout  *auth.LoginLockout
 }
 
-func NewAuthHandler(db *db.Database) *AuthHandler {
+func NewAuthHandler(db *db.Database, tokens *auth.TokenService, sessions *auth.SessionStore, mfa *auth.MFA, lockout *auth.LoginLockout) *AuthHandler {
 	return &AuthHandler{
-		db: db,
+		db:       db,
+		tokens:   tokens,
+		sessions: sessions,
+		mfa:      mfa,
+		lockout:  lockout,
 	}
 }
 
@@ -36,9 +53,25 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 }
 
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	// Code is a TOTP code or a recovery code.
+	Code string `json:"code"`
+}
+
+// MFAChallenge is returned by Login instead of tokens when the account has
+// two-factor authentication enabled
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfaRequired"`
+	ChallengeToken string `json:"challengeToken"`
+	ExpiresIn      int    `json:"expiresIn"`
+}
+
 type TokenPair struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"`
 }
 
 type User struct {
@@ -46,47 +79,88 @@ type User struct {
 	Username string `json:"username"`
 }
 
-type LoginResponse struct {
+// AuthResponse is returned by every endpoint that issues tokens
+type AuthResponse struct {
+	Message string    `json:"message,omitempty"`
+	User    User      `json:"user"`
+	Tokens  TokenPair `json:"tokens"`
+	// Token duplicates Tokens.AccessToken for clients of the original
+	// login response
 	Token string `json:"token"`
-	User  User   `json:"user"`
 }
 
-func generateTokenPair(user *models.User, secret string) (*TokenPair, error) {
-	// Access token - short lived (15 minutes)
-	accessToken := jwt.New(jwt.SigningMethodHS256)
-	accessClaims := accessToken.Claims.(jwt.MapClaims)
-	accessClaims["user_id"] = user.ID
-	accessClaims["username"] = user.Username
-	accessClaims["exp"] = time.Now().Add(time.Minute * 15).Unix()
+// startSession opens a new session for the user and writes its tokens
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User, message string) {
+	if rejectBanned(w, user) {
+		return
+	}
+	refreshToken, session, err := h.sessions.Issue(user.ID, requestMetadata(r))
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.writeTokens(w, user, refreshToken, session.FamilyID, message)
+}
 
-	accessTokenString, err := accessToken.SignedString([]byte(secret))
+// writeTokens issues an access token for the session, sets it as the token
+// cookie and writes the AuthResponse
+func (h *AuthHandler) writeTokens(w http.ResponseWriter, user *models.User, refreshToken, sessionID, message string) {
+	accessToken, err := h.tokens.IssueAccess(user, sessionID)
 	if err != nil {
-		return nil, err
+		log.Printf("Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	// Refresh token - long lived (7 days)
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshClaims := refreshToken.Claims.(jwt.MapClaims)
-	refreshClaims["user_id"] = user.ID
-	refreshClaims["exp"] = time.Now().Add(time.Hour * 24 * 7).Unix()
+	ttl := h.tokens.AccessTTL()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    accessToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(ttl.Seconds()),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	response := AuthResponse{
+		Message: message,
+		User: User{
+			ID:       user.ID,
+			Username: user.Username,
+		},
+		Tokens: TokenPair{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(ttl.Seconds()),
+		},
+		Token: accessToken,
+	}
 
-	refreshTokenString, err := refreshToken.SignedString([]byte(secret))
-	if err != nil {
-		return nil, err
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode token response: %v", err)
 	}
+}
+
+// JWKS publishes the public keys access tokens are signed with
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.tokens.JWKS())
+}
 
-	return &TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-	}, nil
+func requestMetadata(r *http.Request) auth.Metadata {
+	return auth.Metadata{
+		UserAgent: r.UserAgent(),
+		IP:        middleware.ClientIP(r),
+	}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 	// Handle preflight
 	if r.Method == "OPTIONS" {
@@ -149,29 +223,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate tokens
-	tokens, err := generateTokenPair(user, "your-secret-key") // Use env variable in production
-	if err != nil {
-		log.Printf("Failed to generate tokens: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	// Return success response
-	response := map[string]interface{}{
-		"message": "Registration successful",
-		"user": map[string]interface{}{
-			"id":       user.ID,
-			"username": user.Username,
-		},
-		"tokens": tokens,
-	}
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	// Generate tokens and return success response
+	h.startSession(w, r, user, "Registration successful")
 
 	log.Printf("Successfully registered user: %s", user.Username)
 }
@@ -196,59 +249,102 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse locked accounts before checking the password, so guesses made
+	// during a lock learn nothing
+	now := time.Now()
+	if wait, locked := h.lockout.Locked(user, now); locked {
+		log.Printf("Login refused - account locked: %s", req.Username)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+		return
+	}
+
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		log.Printf("Login failed - invalid password for user: %s", req.Username)
+		lock, err := h.lockout.Failure(user, now)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", user.ID, err)
+		}
+		if lock > 0 {
+			log.Printf("Account %s locked for %s after repeated failures from %s", req.Username, lock, middleware.ClientIP(r))
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	if err := h.lockout.Success(user); err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", user.ID, err)
+	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	h.completeLogin(w, r, user, "")
+}
 
-	tokenString, err := token.SignedString([]byte("your-secret-key"))
-	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// completeLogin starts a session for a user whose primary credentials were
+// accepted. Accounts with two-factor authentication get a challenge instead
+// and finish logging in with LoginTwoFactor.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, message string) {
+	if user.TwoFactorEnabled() {
+		challenge, err := h.tokens.Issue(user, auth.TokenMFAChallenge, "", mfaChallengeTTL)
+		if err != nil {
+			log.Printf("Failed to issue two-factor challenge: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MFAChallenge{
+			MFARequired:    true,
+			ChallengeToken: challenge,
+			ExpiresIn:      int(mfaChallengeTTL.Seconds()),
+		})
+		log.Printf("Primary login accepted for user %s; awaiting two-factor code", user.Username)
 		return
 	}
 
-	// Set cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    tokenString,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   86400, // 24 hours
-	})
+	// Start a session and return its tokens
+	h.startSession(w, r, user, message)
 
-	// Set response headers
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+	log.Printf("Successful login for user: %s", user.Username)
+}
 
-	// Return response
-	response := LoginResponse{
-		Token: tokenString,
-		User: User{
-			ID:       user.ID,
-			Username: user.Username,
-		},
+// LoginTwoFactor completes a login with the challenge token from Login and a
+// TOTP or recovery code
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode login response: %v", err)
+	claims, err := h.tokens.Parse(req.ChallengeToken, auth.TokenMFAChallenge)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if result := h.db.First(&user, "id = ?", claims.UserID()); result.Error != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	err = h.mfa.Verify(&user, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrMFALocked):
+		http.Error(w, "Too many invalid codes, try again later", http.StatusTooManyRequests)
+		return
+	case errors.Is(err, auth.ErrInvalidMFACode), errors.Is(err, auth.ErrMFANotEnrolled):
+		log.Printf("Two-factor login failed for user: %s", user.Username)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("Failed to verify two-factor code: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Successful login for user: %s", user.Username)
+	h.startSession(w, r, &user, "")
+
+	log.Printf("Successful two-factor login for user: %s", user.Username)
 }
 
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -260,43 +356,146 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.Parse(req.RefreshToken, func(token *jwt.Token) (interface{}, error) {
-		return []byte("your-secret-key"), nil // Use env variable in production
-	})
-
-	if err != nil || !token.Valid {
+	refreshToken, session, err := h.sessions.Rotate(req.RefreshToken, requestMetadata(r))
+	switch {
+	case errors.Is(err, auth.ErrRefreshTokenReused):
+		log.Printf("Refresh token reuse detected from %s; session revoked", middleware.ClientIP(r))
+		http.Error(w, "Refresh token reuse detected; session revoked", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
 		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
 		return
+	case err != nil:
+		log.Printf("Failed to rotate refresh token: %v", err)
+		http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+		return
 	}
 
-	claims := token.Claims.(jwt.MapClaims)
-	userID := claims["user_id"].(string)
-
 	var user models.User
-	if result := h.db.First(&user, "id = ?", userID); result.Error != nil {
+	if result := h.db.First(&user, "id = ?", session.UserID); result.Error != nil {
 		http.Error(w, "User not found", http.StatusUnauthorized)
 		return
 	}
 
-	newTokens, err := generateTokenPair(&user, "your-secret-key")
-	if err != nil {
-		http.Error(w, "Error generating tokens", http.StatusInternalServerError)
+	if rejectBanned(w, &user) {
+		if err := h.sessions.RevokeAll(user.ID); err != nil {
+			log.Printf("Failed to revoke sessions of banned user %s: %v", user.ID, err)
+		}
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tokens": newTokens,
-	})
+	h.writeTokens(w, &user, refreshToken, session.FamilyID, "")
+}
+
+// rejectBanned writes a 403 response if the user is banned
+func rejectBanned(w http.ResponseWriter, user *models.User) bool {
+	if !user.Banned(time.Now()) {
+		return false
+	}
+	msg := "Account suspended"
+	if user.BannedUntil != nil {
+		msg += " until " + user.BannedUntil.UTC().Format(time.RFC3339)
+	}
+	if user.BanReason != "" {
+		msg += ": " + user.BanReason
+	}
+	http.Error(w, msg, http.StatusForbidden)
+	return true
 }
 
+// Logout revokes the session of the presented refresh token and clears the
+// token cookie
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	// For token-based auth, client-side should remove the token
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		if err := h.sessions.Revoke(req.RefreshToken); err != nil && !errors.Is(err, auth.ErrInvalidRefreshToken) {
+			log.Printf("Failed to revoke session: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   -1,
+	})
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
 }
 
+// LogoutAll revokes every session of the calling user
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.sessions.RevokeAll(userID); err != nil {
+		log.Printf("Failed to revoke sessions for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out of all devices"})
+}
+
+// ListSessions returns the calling user's active sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	id, ok := middleware.IdentityFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID := id.UserID
+
+	sessions, err := h.sessions.List(userID, id.SessionID)
+	if err != nil {
+		log.Printf("Failed to list sessions for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession ends one of the calling user's sessions
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.sessions.RevokeSession(userID, mux.Vars(r)["id"])
+	if errors.Is(err, auth.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
-	userID := r.Header.Get("user_id")
+	userID := middleware.UserID(r)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"typerace/chat"
+	"typerace/middleware"
+	"typerace/social"
+	"typerace/websocket"
+)
+
+const (
+	defaultChatHistory = 50
+	maxChatHistory     = 100
+	maxReportReason    = 500
+)
+
+type ChatHandler struct {
+	chat    *chat.Service
+	friends *social.Graph
+	games   *GameHandler
+}
+
+func NewChatHandler(service *chat.Service, friends *social.Graph, games *GameHandler) *ChatHandler {
+	return &ChatHandler{
+		chat:    service,
+		friends: friends,
+		games:   games,
+	}
+}
+
+// GetLobbyMessages returns the lobby's recent messages
+func (h *ChatHandler) GetLobbyMessages(w http.ResponseWriter, r *http.Request) {
+	h.history(w, r, chat.Lobby)
+}
+
+// PostLobbyMessage posts to the lobby, delivered to every user connection
+func (h *ChatHandler) PostLobbyMessage(w http.ResponseWriter, r *http.Request) {
+	h.post(w, r, chat.Lobby)
+}
+
+// GetGameMessages returns a game's recent messages
+func (h *ChatHandler) GetGameMessages(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.gameRoom(w, r)
+	if !ok {
+		return
+	}
+	h.history(w, r, room)
+}
+
+// PostGameMessage posts to a game's room, delivered to its players and
+// spectators
+func (h *ChatHandler) PostGameMessage(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.gameRoom(w, r)
+	if !ok {
+		return
+	}
+	h.post(w, r, room)
+}
+
+// ReportMessage reports a chat message to the moderators
+func (h *ChatHandler) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Room      string `json:"room"`
+		MessageID string `json:"messageId"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !chat.ValidRoom(req.Room) || req.MessageID == "" {
+		http.Error(w, "A room and a message ID are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxReportReason {
+		http.Error(w, "Reason is limited to 500 characters", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.chat.Report(r.Context(), req.Room, req.MessageID, middleware.UserID(r), req.Reason)
+	switch {
+	case errors.Is(err, chat.ErrNotFound):
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	case errors.Is(err, chat.ErrReported):
+		http.Error(w, "You already reported this message", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error reporting message %s: %v", req.MessageID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// history writes a room's recent messages. Messages from users the caller
+// blocked are left out.
+func (h *ChatHandler) history(w http.ResponseWriter, r *http.Request, room string) {
+	limit, _ := pagination(r, defaultChatHistory, maxChatHistory)
+
+	hidden := make(map[string]bool)
+	if userID := middleware.UserID(r); userID != "" {
+		blocked, err := h.friends.Blocked(r.Context(), userID)
+		if err != nil {
+			log.Printf("Error fetching blocked users of %s: %v", userID, err)
+		}
+		for _, b := range blocked {
+			hidden[b.UserID] = true
+		}
+	}
+
+	messages, err := h.chat.History(r.Context(), room, limit, hidden)
+	if err != nil {
+		log.Printf("Error fetching chat history of %s: %v", room, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room":     room,
+		"messages": messages,
+	})
+}
+
+func (h *ChatHandler) post(w http.ResponseWriter, r *http.Request, room string) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.chat.Post(r.Context(), room, middleware.UserID(r), req.Text)
+	switch {
+	case errors.Is(err, chat.ErrEmpty):
+		http.Error(w, "Message is empty", http.StatusBadRequest)
+		return
+	case errors.Is(err, chat.ErrTooLong):
+		http.Error(w, "Message is too long", http.StatusBadRequest)
+		return
+	case errors.Is(err, chat.ErrMuted):
+		http.Error(w, "You are muted", http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Error posting to %s: %v", room, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Users who blocked the sender do not get their messages
+	skip := make(map[string]bool)
+	blockers, err := h.friends.BlockedBy(r.Context(), message.UserID)
+	if err != nil {
+		log.Printf("Error fetching users who blocked %s: %v", message.UserID, err)
+	}
+	for _, id := range blockers {
+		skip[id] = true
+	}
+	deliverChat(h.games.Hub, room, websocket.Message{Type: "chat", Data: message}, skip)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// gameRoom returns the chat room of the game in the path, writing an error
+// response if the caller cannot see it. Private rooms are open only to
+// the game's invitees.
+func (h *ChatHandler) gameRoom(w http.ResponseWriter, r *http.Request) (string, bool) {
+	gameID := mux.Vars(r)["id"]
+	game, exists := h.games.getGame(gameID)
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return "", false
+	}
+	if !game.Invited(middleware.UserID(r)) {
+		http.Error(w, "This race is private", http.StatusForbidden)
+		return "", false
+	}
+	return chat.GameRoom(gameID), true
+}
+
+// deliverChat sends a chat event to everyone in room but the users in skip:
+// every user connection for the lobby, or a game's connections
+func deliverChat(hub *websocket.Hub, room string, message websocket.Message, skip map[string]bool) {
+	if gameID, ok := strings.CutPrefix(room, "game:"); ok {
+		hub.BroadcastToGameExcept(gameID, message, skip)
+		return
+	}
+	hub.BroadcastToUsersExcept(message, skip)
+}
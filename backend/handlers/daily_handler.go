@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"typerace/daily"
+	"typerace/middleware"
+	"typerace/models"
+)
+
+type DailyHandler struct {
+	daily *daily.Scheduler
+	games *GameHandler
+}
+
+func NewDailyHandler(scheduler *daily.Scheduler, games *GameHandler) *DailyHandler {
+	return &DailyHandler{
+		daily: scheduler,
+		games: games,
+	}
+}
+
+// GetChallenge returns a day's challenge and passage, today's if no date is
+// given. Authenticated callers also get their ranked attempt and result.
+func (h *DailyHandler) GetChallenge(w http.ResponseWriter, r *http.Request) {
+	date, ok := challengeDate(w, r)
+	if !ok {
+		return
+	}
+	challenge, passage, ok := h.load(w, r, date)
+	if !ok {
+		return
+	}
+
+	response := map[string]interface{}{
+		"date":      date,
+		"today":     date == daily.Date(time.Now()),
+		"challenge": challenge,
+		"passage":   passage,
+	}
+	if userID := middleware.UserID(r); userID != "" {
+		attempt, err := h.daily.Attempt(r.Context(), date, userID)
+		if err != nil {
+			log.Printf("Error fetching daily attempt of %s: %v", userID, err)
+		}
+		me, err := h.daily.Rank(r.Context(), date, userID)
+		if err != nil {
+			log.Printf("Error fetching daily rank of %s: %v", userID, err)
+		}
+		response["attempt"] = attempt
+		response["me"] = me
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Play starts a solo game on a day's challenge. The first game on today's
+// challenge is the caller's ranked attempt; every other game is an
+// unranked replay whose result is not stored.
+func (h *DailyHandler) Play(w http.ResponseWriter, r *http.Request) {
+	id, _ := middleware.IdentityFrom(r.Context())
+	playerID, err := uuid.Parse(id.UserID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	date, ok := challengeDate(w, r)
+	if !ok {
+		return
+	}
+	_, passage, ok := h.load(w, r, date)
+	if !ok {
+		return
+	}
+
+	gameID := uuid.New().String()
+	ranked := false
+	if date == daily.Date(time.Now()) {
+		ranked, err = h.daily.Begin(r.Context(), date, id.UserID, gameID)
+		if err != nil {
+			log.Printf("Error starting daily attempt of %s: %v", id.UserID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	game := models.NewGame(gameID, passage.Text)
+	game.Mode = models.ModeDaily
+	game.CreatedBy = id.UserID
+	game.PassageID = passage.ID
+	game.PassageHash = models.PassageHash(passage.Text)
+	game.PassageType = passage.Type
+	game.CodeLanguage = passage.CodeLanguage
+	game.Language = passage.Language
+	game.Challenge = date
+	game.Unranked = !ranked
+	game.IsPrivate = true
+	game.Invite(id.UserID)
+	game.AddPlayer(&models.Player{
+		ID:     uuid.New(),
+		UserID: playerID,
+		GameID: game.ID,
+		Name:   id.Username,
+	})
+	game.Start()
+	h.games.putGame(game)
+	h.games.enterGame(r.Context(), game, id.UserID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"game":   game,
+		"ranked": ranked,
+	})
+}
+
+// GetLeaderboard ranks a day's finished ranked attempts. Supports limit and
+// offset; authenticated callers also get their own rank.
+func (h *DailyHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	date, ok := challengeDate(w, r)
+	if !ok {
+		return
+	}
+	if _, _, ok := h.load(w, r, date); !ok {
+		return
+	}
+
+	limit, offset := pagination(r, defaultLeaderboardSize, maxLeaderboardSize)
+	entries, total, err := h.daily.Leaderboard(r.Context(), date, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching daily leaderboard for %s: %v", date, err)
+		http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"date":    date,
+		"entries": entries,
+		"total":   total,
+	}
+	if userID := middleware.UserID(r); userID != "" {
+		me, err := h.daily.Rank(r.Context(), date, userID)
+		if err != nil {
+			log.Printf("Error fetching daily rank of %s: %v", userID, err)
+		}
+		response["me"] = me
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetStreak returns a user's current and best daily challenge streaks
+func (h *DailyHandler) GetStreak(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	streak, err := h.daily.Streak(r.Context(), userID, time.Now())
+	if err != nil {
+		log.Printf("Error fetching daily streak of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(streak)
+}
+
+// load fetches a day's challenge, writing an error response if there is
+// none
+func (h *DailyHandler) load(w http.ResponseWriter, r *http.Request, date string) (*models.DailyChallenge, *models.Passage, bool) {
+	challenge, passage, err := h.daily.Challenge(r.Context(), date, time.Now())
+	switch {
+	case errors.Is(err, daily.ErrNotFound):
+		http.Error(w, "Daily challenge not found", http.StatusNotFound)
+		return nil, nil, false
+	case errors.Is(err, daily.ErrNoPassages):
+		http.Error(w, "No passages are available", http.StatusServiceUnavailable)
+		return nil, nil, false
+	case err != nil:
+		log.Printf("Error fetching daily challenge for %s: %v", date, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return challenge, passage, true
+}
+
+// challengeDate reads the date in the path, today if it is missing or
+// "today", writing an error response if it is malformed
+func challengeDate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	date := mux.Vars(r)["date"]
+	if date == "" || date == "today" {
+		return daily.Date(time.Now()), true
+	}
+	if _, err := daily.ParseDate(date); err != nil {
+		http.Error(w, "Date must be YYYY-MM-DD", http.StatusBadRequest)
+		return "", false
+	}
+	return date, true
+}
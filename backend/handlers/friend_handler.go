@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/presence"
+	"typerace/social"
+	"typerace/websocket"
+)
+
+// maxPlayers is how many players a game holds; see models.Game.AddPlayer.
+const maxPlayers = 4
+
+type FriendHandler struct {
+	db       *gorm.DB
+	friends  *social.Graph
+	presence *presence.Tracker
+	games    *GameHandler
+}
+
+func NewFriendHandler(db *gorm.DB, friends *social.Graph, tracker *presence.Tracker, games *GameHandler) *FriendHandler {
+	return &FriendHandler{
+		db:       db,
+		friends:  friends,
+		presence: tracker,
+		games:    games,
+	}
+}
+
+// friendGame is the game a friend is racing in, so the caller can join or
+// spectate it.
+type friendGame struct {
+	ID       string            `json:"id"`
+	Mode     models.GameMode   `json:"mode"`
+	Status   models.GameStatus `json:"status"`
+	Players  int               `json:"players"`
+	Joinable bool              `json:"joinable"`
+}
+
+// ListFriends returns the caller's friends with their presence
+func (h *FriendHandler) ListFriends(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	friends, err := h.friends.Friends(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching friends of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, len(friends))
+	for i, f := range friends {
+		ids[i] = f.UserID
+	}
+	presences, err := h.presence.Get(r.Context(), ids)
+	if err != nil {
+		// Friends are still listed, all shown offline
+		log.Printf("Error fetching presence of friends of %s: %v", userID, err)
+		presences = make([]presence.Presence, len(ids))
+		for i, id := range ids {
+			presences[i] = presence.Presence{UserID: id, Status: presence.Offline}
+		}
+	}
+
+	list := make([]map[string]interface{}, len(friends))
+	for i, f := range friends {
+		entry := map[string]interface{}{
+			"userId":   f.UserID,
+			"username": f.Username,
+			"avatar":   f.Avatar,
+			"rating":   f.Rating,
+			"since":    f.Since,
+			"presence": presences[i],
+		}
+		if game := h.game(presences[i].GameID, userID); game != nil {
+			entry["game"] = game
+		}
+		list[i] = entry
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"friends": list,
+	})
+}
+
+// ListRequests returns the caller's pending incoming and outgoing friend
+// requests
+func (h *FriendHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	incoming, outgoing, err := h.friends.Requests(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching friend requests of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"incoming": incoming,
+		"outgoing": outgoing,
+	})
+}
+
+// SendRequest asks a user, by ID or username, to be the caller's friend.
+// If they had already asked the caller, they become friends at once.
+func (h *FriendHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   string `json:"userId"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	friendID, ok := findUser(h.db, req.UserID, req.Username)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	id, _ := middleware.IdentityFrom(r.Context())
+	accepted, err := h.friends.Request(r.Context(), id.UserID, friendID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	status, event := models.FriendPending, models.NotificationFriendRequest
+	if accepted {
+		status, event = models.FriendAccepted, models.NotificationFriendAccepted
+	}
+	from := map[string]interface{}{
+		"userId":   id.UserID,
+		"username": id.Username,
+	}
+	h.games.Hub.SendToUser(friendID, websocket.Message{
+		Type: string(event),
+		Data: from,
+	})
+	h.games.notifyUser(friendID, event, from)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId": friendID,
+		"status": status,
+	})
+}
+
+// AcceptRequest accepts the friend request the user in the path sent the
+// caller
+func (h *FriendHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
+	id, _ := middleware.IdentityFrom(r.Context())
+	requesterID := mux.Vars(r)["id"]
+	if err := h.friends.Accept(r.Context(), id.UserID, requesterID); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	by := map[string]interface{}{
+		"userId":   id.UserID,
+		"username": id.Username,
+	}
+	h.games.Hub.SendToUser(requesterID, websocket.Message{
+		Type: "friend_accepted",
+		Data: by,
+	})
+	h.games.notifyUser(requesterID, models.NotificationFriendAccepted, by)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId": requesterID,
+		"status": models.FriendAccepted,
+	})
+}
+
+// DeclineRequest drops the friend request the user in the path sent the
+// caller
+func (h *FriendHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
+	if err := h.friends.Decline(r.Context(), middleware.UserID(r), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelRequest withdraws the caller's friend request to the user in the
+// path
+func (h *FriendHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
+	if err := h.friends.Cancel(r.Context(), middleware.UserID(r), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFriend ends the caller's friendship with the user in the path
+func (h *FriendHandler) RemoveFriend(w http.ResponseWriter, r *http.Request) {
+	if err := h.friends.Remove(r.Context(), middleware.UserID(r), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBlocked returns the users the caller blocked
+func (h *FriendHandler) ListBlocked(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	blocked, err := h.friends.Blocked(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching blocked users of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"blocked": blocked,
+	})
+}
+
+// Block blocks the user in the path, ending any friendship or request
+// between them and the caller
+func (h *FriendHandler) Block(w http.ResponseWriter, r *http.Request) {
+	if err := h.friends.Block(r.Context(), middleware.UserID(r), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unblock lifts the caller's block on the user in the path
+func (h *FriendHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	if err := h.friends.Unblock(r.Context(), middleware.UserID(r), mux.Vars(r)["id"]); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IssueTicket returns a single-use ticket for opening the caller's user
+// connection at /ws/user
+func (h *FriendHandler) IssueTicket(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	ticket, err := h.presence.Issue(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error issuing presence ticket for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ticket": ticket,
+	})
+}
+
+// HandleUserSocket opens a user connection, authenticated by the ticket
+// query parameter. The user shows as online to their friends while it is
+// open and receives their presence changes over it.
+func (h *FriendHandler) HandleUserSocket(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.presence.Redeem(r.Context(), r.URL.Query().Get("ticket"))
+	if err != nil {
+		if !errors.Is(err, presence.ErrInvalidTicket) {
+			log.Printf("Error redeeming presence ticket: %v", err)
+		}
+		http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := h.games.upgrader.Upgrade(w, r)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	client := &websocket.UserClient{
+		Hub:    h.games.Hub,
+		Conn:   conn,
+		Send:   make(chan []byte, 256),
+		UserID: userID,
+	}
+	h.games.Hub.RegisterUser <- client
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+// game describes a game a friend is in, as seen by the caller, or nil if it
+// is not on this server or is over.
+func (h *FriendHandler) game(gameID, callerID string) *friendGame {
+	game, ok := h.games.getGame(gameID)
+	if gameID == "" || !ok {
+		return nil
+	}
+	invited := game.Invited(callerID)
+	game.Mu.Lock()
+	defer game.Mu.Unlock()
+	if game.Status == models.Finished {
+		return nil
+	}
+	return &friendGame{
+		ID:       gameID,
+		Mode:     game.Mode,
+		Status:   game.Status,
+		Players:  len(game.Players),
+		Joinable: invited && game.Status == models.Waiting && game.SessionID == "" && len(game.Players) < maxPlayers,
+	}
+}
+
+// findUser resolves a user given by ID or, failing that, by username
+func findUser(db *gorm.DB, userID, username string) (string, bool) {
+	if userID != "" {
+		return userID, true
+	}
+	var user models.User
+	username = strings.TrimSpace(username)
+	if username == "" || db.Select("id").First(&user, "username = ?", username).Error != nil {
+		return "", false
+	}
+	return user.ID, true
+}
+
+func (h *FriendHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, social.ErrSelf):
+		http.Error(w, "You cannot befriend or block yourself", http.StatusBadRequest)
+	case errors.Is(err, social.ErrUserNotFound):
+		http.Error(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, social.ErrNotFound):
+		http.Error(w, "Friend request or friendship not found", http.StatusNotFound)
+	case errors.Is(err, social.ErrBlocked):
+		http.Error(w, "You cannot befriend this user", http.StatusForbidden)
+	case errors.Is(err, social.ErrAlreadyFriends):
+		http.Error(w, "Already friends", http.StatusConflict)
+	case errors.Is(err, social.ErrAlreadyRequested):
+		http.Error(w, "Friend request already sent", http.StatusConflict)
+	default:
+		log.Printf("Error updating friends: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
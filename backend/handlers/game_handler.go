@@ -3,9 +3,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,48 +18,189 @@ import (
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 
+	"typerace/achievements"
+	"typerace/config"
+	"typerace/leaderboard"
+	"typerace/middleware"
 	"typerace/models"
+	"typerace/notifications"
+	"typerace/presence"
+	"typerace/typing"
 	"typerace/websocket"
 )
 
+// maxLabelLength bounds the free-form category and difficulty of a game.
+const maxLabelLength = 32
+
 type GameHandler struct {
-	Hub   *websocket.Hub          `json:"hub,omitempty"`
-	db    *gorm.DB                `json:"db,omitempty"`
-	redis *redis.Client           `json:"redis,omitempty"`
-	Games map[string]*models.Game `json:"games,omitempty"`
+	Hub   *websocket.Hub `json:"hub,omitempty"`
+	db    *gorm.DB
+	redis *redis.Client
+
+	// games and sessions are written from timers as well as requests; use
+	// the accessors below, which hold mu
+	mu       sync.RWMutex
+	games    map[string]*models.Game
+	sessions map[string]*models.Session
+
+	cors          config.CORSConfig
+	upgrader      *websocket.OriginUpgrader
+	boards        *leaderboard.Leaderboard
+	achievements  *achievements.Engine
+	presence      *presence.Tracker
+	notifications *notifications.Service
 }
 
-func NewGameHandler(hub *websocket.Hub, db *gorm.DB, redis *redis.Client) *GameHandler {
+func NewGameHandler(hub *websocket.Hub, db *gorm.DB, redis *redis.Client, cors config.CORSConfig, boards *leaderboard.Leaderboard, achievements *achievements.Engine, presence *presence.Tracker, notifications *notifications.Service) *GameHandler {
 	return &GameHandler{
 		Hub:   hub,
 		db:    db,
 		redis: redis,
-		Games: make(map[string]*models.Game),
+
+		games:    make(map[string]*models.Game),
+		sessions: make(map[string]*models.Session),
+
+		cors:          cors,
+		upgrader:      websocket.NewOriginUpgrader(cors.AllowsOrigin),
+		boards:        boards,
+		achievements:  achievements,
+		presence:      presence,
+		notifications: notifications,
 	}
 }
 
-func (h *GameHandler) CreateGame(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Text string `json:"text"`
-	}
+// getGame returns a game running on this server.
+func (h *GameHandler) getGame(id string) (*models.Game, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	game, ok := h.games[id]
+	return game, ok
+}
+
+// putGame adds a game to those running on this server.
+func (h *GameHandler) putGame(game *models.Game) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.games[game.ID.String()] = game
+}
 
+// deleteGame drops a game that will never be played.
+func (h *GameHandler) deleteGame(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.games, id)
+}
+
+// getSession returns a session running on this server.
+func (h *GameHandler) getSession(id string) (*models.Session, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	session, ok := h.sessions[id]
+	return session, ok
+}
+
+// putSession adds a session to those running on this server.
+func (h *GameHandler) putSession(session *models.Session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions[session.ID] = session
+}
+
+// gameOptions describe the race a new game is set up for.
+type gameOptions struct {
+	Text         string             `json:"text"`
+	Mode         models.GameMode    `json:"mode"`
+	Duration     int                `json:"duration"`
+	WordCount    int                `json:"wordCount"`
+	PassageID    string             `json:"passageId"`
+	PassageType  models.PassageType `json:"passageType"`
+	CodeLanguage string             `json:"codeLanguage"`
+	Language     string             `json:"language"`
+	Category     string             `json:"category"`
+	Difficulty   string             `json:"difficulty"`
+}
+
+func (h *GameHandler) CreateGame(w http.ResponseWriter, r *http.Request) {
+	var req gameOptions
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	gameID := uuid.New().String()
-	game := models.NewGame(gameID, req.Text)
-	h.Games[gameID] = game
+	game, status, err := h.newGame(req)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	game.CreatedBy = middleware.UserID(r)
+	h.putGame(game)
 
 	json.NewEncoder(w).Encode(game)
 }
 
+// newGame validates the options and sets up a waiting game. If they are
+// invalid it returns the status code to reply with.
+func (h *GameHandler) newGame(req gameOptions) (*models.Game, int, error) {
+	if req.Mode == "" {
+		req.Mode = models.ModeStandard
+	}
+	if !req.Mode.Valid() {
+		return nil, http.StatusBadRequest, errors.New("Invalid game mode")
+	}
+	if req.PassageType != "" && !req.PassageType.Valid() {
+		return nil, http.StatusBadRequest, errors.New("Invalid passage type")
+	}
+	req.Category = strings.ToLower(strings.TrimSpace(req.Category))
+	req.Difficulty = strings.ToLower(strings.TrimSpace(req.Difficulty))
+	if len(req.Category) > maxLabelLength || len(req.Difficulty) > maxLabelLength {
+		return nil, http.StatusBadRequest, errors.New("Category and difficulty are limited to 32 characters")
+	}
+
+	language := typing.BaseLanguage(req.Language)
+	if req.Mode.IsGenerated() && language != "" && language != "en" {
+		return nil, http.StatusBadRequest, errors.New("Generated word streams are only available in English")
+	}
+
+	gameID := uuid.New().String()
+	var game *models.Game
+	if req.Mode.IsGenerated() {
+		var err error
+		game, err = models.NewModeGame(gameID, req.Mode, req.Duration, req.WordCount)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	} else if req.Text != "" {
+		game = models.NewGame(gameID, req.Text)
+		if req.PassageType == models.PassageCode {
+			game.PassageType = models.PassageCode
+			game.CodeLanguage = req.CodeLanguage
+		}
+		if req.Language != "" {
+			game.Language = req.Language
+		}
+		game.PassageHash = models.PassageHash(game.Text)
+	} else {
+		passage, err := h.pickPassage(req.PassageID, req.PassageType, req.CodeLanguage, language)
+		if err != nil {
+			return nil, http.StatusNotFound, err
+		}
+		game = models.NewGame(gameID, passage.Text)
+		game.PassageID = passage.ID
+		game.PassageType = passage.Type
+		game.CodeLanguage = passage.CodeLanguage
+		game.Language = passage.Language
+		game.PassageHash = models.PassageHash(passage.Text)
+	}
+	game.Category = req.Category
+	game.Difficulty = req.Difficulty
+	return game, http.StatusOK, nil
+}
+
 func (h *GameHandler) GetGame(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
 
-	game, exists := h.Games[gameID]
+	game, exists := h.getGame(gameID)
 	if !exists {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
@@ -67,37 +213,180 @@ func (h *GameHandler) JoinGame(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
 
+	// The body is optional; the player's user comes from their token
 	var player models.Player
-	if err := json.NewDecoder(r.Body).Decode(&player); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&player); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := bindPlayer(r, &player); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	game, exists := h.Games[gameID]
+	game, exists := h.getGame(gameID)
 	if !exists {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	}
 
-	if !game.AddPlayer(&player) {
-		http.Error(w, "Game is full", http.StatusBadRequest)
+	if !game.Invited(player.UserID.String()) {
+		http.Error(w, "This race is private", http.StatusForbidden)
 		return
 	}
+	if err := game.AddPlayer(&player); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrGameStarted) || errors.Is(err, models.ErrAlreadyJoined) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	h.enterGame(r.Context(), game, player.UserID.String())
+
+	// Invitation races start as soon as both sides are in
+	if game.InvitationID != "" && game.ParticipantsJoined() {
+		h.startGame(game)
+	}
 
 	json.NewEncoder(w).Encode(game)
 }
 
+// markRecord flags the fastest finisher of a fixed-text race if they beat
+// the passage's record. Only speeds measured by the server count.
+func (h *GameHandler) markRecord(game *models.Game, standings []models.Standing, results []models.GameResult) {
+	if game.PassageHash == "" {
+		return
+	}
+	record, err := h.boards.PassageRecord(context.Background(), game.PassageHash)
+	if err != nil {
+		log.Printf("Error loading record for passage %s: %v", game.PassageHash, err)
+		return
+	}
+
+	fastest := -1
+	for i, s := range standings {
+		if s.Finished && s.Measured && (fastest < 0 || s.WPM > standings[fastest].WPM) {
+			fastest = i
+		}
+	}
+	if fastest >= 0 && (record == nil || standings[fastest].WPM > record.WPM) {
+		results[fastest].Record = true
+	}
+}
+
+// announceRecord tells the race when a player who just finished beat the
+// passage's record and everyone who finished before them. Only speeds
+// measured by the server count.
+func (h *GameHandler) announceRecord(ctx context.Context, game *models.Game, userID string) {
+	if game.PassageHash == "" || game.Unranked {
+		return
+	}
+	record, err := h.boards.PassageRecord(ctx, game.PassageHash)
+	if err != nil {
+		log.Printf("Error loading record for passage %s: %v", game.PassageHash, err)
+		return
+	}
+
+	var finisher *models.Standing
+	best := 0
+	if record != nil {
+		best = record.WPM
+	}
+	standings := game.Rank(time.Now())
+	for i, s := range standings {
+		switch {
+		case s.UserID == userID:
+			finisher = &standings[i]
+		case s.Finished && s.Measured && s.WPM > best:
+			best = s.WPM
+		}
+	}
+	if finisher == nil || !finisher.Measured || finisher.WPM <= best {
+		return
+	}
+
+	h.Hub.BroadcastToGame(game.ID.String(), websocket.Message{
+		Type: "record_broken",
+		Data: map[string]interface{}{
+			"user_id":  userID,
+			"name":     finisher.Name,
+			"wpm":      finisher.WPM,
+			"previous": record,
+		},
+	})
+}
+
+// enterGame shows a player as racing in a game to their friends.
+func (h *GameHandler) enterGame(ctx context.Context, game *models.Game, userID string) {
+	if h.presence != nil {
+		h.presence.EnterGame(ctx, userID, game.ID.String())
+	}
+}
+
+// leaveGame stops showing a finished game's players as racing in it.
+func (h *GameHandler) leaveGame(game *models.Game) {
+	if h.presence == nil {
+		return
+	}
+	game.Mu.Lock()
+	players := append([]models.Player(nil), game.Players...)
+	game.Mu.Unlock()
+	for _, p := range players {
+		h.presence.LeaveGame(context.Background(), p.UserID.String(), game.ID.String())
+	}
+}
+
+// notifyUser adds a notification to a user's notification center.
+func (h *GameHandler) notifyUser(userID string, kind models.NotificationType, data interface{}) {
+	if h.notifications == nil {
+		return
+	}
+	if _, err := h.notifications.Notify(context.Background(), userID, kind, data); err != nil {
+		log.Printf("Error notifying %s of %s: %v", userID, kind, err)
+	}
+}
+
+// bindPlayer sets a joining player's user from the authenticated caller, so
+// clients cannot join races as someone else. The display name defaults to
+// the caller's username.
+func bindPlayer(r *http.Request, player *models.Player) error {
+	id, ok := middleware.IdentityFrom(r.Context())
+	if !ok {
+		return errors.New("no authenticated user")
+	}
+	userID, err := uuid.Parse(id.UserID)
+	if err != nil {
+		return err
+	}
+	player.UserID = userID
+	if player.Name == "" {
+		player.Name = id.Username
+	}
+	return nil
+}
+
+// HandleWebSocket opens a game connection. Spectators may connect
+// anonymously; signed-in users pass a ticket from /presence/ticket so that
+// chat from users they blocked is held back.
 func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["gameId"]
 
-	// Enable CORS for WebSocket
-	websocket.Upgrader.CheckOrigin = func(r *http.Request) bool {
-		origin := r.Header.Get("Origin")
-		return origin == "http://localhost:3000"
+	var userID string
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" && h.presence != nil {
+		var err error
+		userID, err = h.presence.Redeem(r.Context(), ticket)
+		if err != nil {
+			if !errors.Is(err, presence.ErrInvalidTicket) {
+				log.Printf("Error redeeming presence ticket: %v", err)
+			}
+			http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+			return
+		}
 	}
 
-	conn, err := websocket.UpgradeConnection(w, r)
+	conn, err := h.upgrader.Upgrade(w, r)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
@@ -109,18 +398,25 @@ func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Conn:   conn,
 		Send:   make(chan []byte, 256),
 		GameID: gameID,
+		UserID: userID,
 	}
 
 	// Register client with the hub
 	h.Hub.Register <- client
 
 	// Send initial game state if game exists
-	if game, exists := h.Games[gameID]; exists {
+	if game, exists := h.getGame(gameID); exists {
 		initialState, _ := json.Marshal(map[string]interface{}{
 			"type":    "gameState",
 			"payload": game,
 		})
 		client.Send <- initialState
+	} else if session, exists := h.getSession(gameID); exists {
+		initialState, _ := json.Marshal(map[string]interface{}{
+			"type":    "sessionState",
+			"payload": session,
+		})
+		client.Send <- initialState
 	}
 
 	// Start goroutines for reading and writing
@@ -128,16 +424,47 @@ func (h *GameHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go client.ReadPump()
 }
 
+// pickPassage loads the requested passage, or a random stored passage
+// matching the type and language filters when no ID is given. language
+// matches passages tagged with it or with any of its regional variants.
+func (h *GameHandler) pickPassage(id string, passageType models.PassageType, codeLanguage, language string) (*models.Passage, error) {
+	var passage models.Passage
+	if id != "" {
+		if err := h.db.First(&passage, "id = ?", id).Error; err != nil {
+			return nil, fmt.Errorf("passage not found")
+		}
+		return &passage, nil
+	}
+
+	query := h.db.Model(&models.Passage{})
+	if passageType != "" {
+		query = query.Where("type = ?", passageType)
+	}
+	if codeLanguage != "" {
+		query = query.Where("LOWER(code_language) = LOWER(?)", codeLanguage)
+	}
+	if language != "" {
+		query = query.Where("LOWER(language) = ? OR LOWER(language) LIKE ?", language, language+"-%")
+	}
+	if err := query.Order("RANDOM()").First(&passage).Error; err != nil {
+		return nil, fmt.Errorf("no passage matches the requested filters")
+	}
+	return &passage, nil
+}
+
 // UpdateProgress handles updating a player's progress in the game
 func (h *GameHandler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
-	userID := r.Header.Get("user_id")
+	userID := middleware.UserID(r)
 
 	var req struct {
-		Progress float64 `json:"progress"`
-		WPM      int     `json:"wpm"`
-		Accuracy float64 `json:"accuracy"`
+		Progress     float64 `json:"progress"`
+		WPM          int     `json:"wpm"`
+		Accuracy     float64 `json:"accuracy"`
+		Position     int     `json:"position"`
+		CorrectWords int     `json:"correctWords"`
+		Input        *string `json:"input"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -145,6 +472,48 @@ func (h *GameHandler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	game, exists := h.getGame(gameID)
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	// Generated-mode games extend their text as they run
+	game.Mu.Lock()
+	status, text := game.Status, game.Text
+	game.Mu.Unlock()
+	if status != models.Playing {
+		http.Error(w, "Game is not in progress", http.StatusConflict)
+		return
+	}
+	if req.Input == nil && !game.Unranked {
+		http.Error(w, "Typed input is required in ranked races", http.StatusBadRequest)
+		return
+	}
+
+	// When the typed input is sent, progress, accuracy and speed are computed
+	// on the server instead of trusting the client's figures
+	speed := typing.Speed{WPM: float64(req.WPM), Unit: "wpm"}
+	if req.Input != nil {
+		result := typing.Compare(text, *req.Input, typing.RulesFor(string(game.PassageType), game.CodeLanguage))
+		speed = typing.MeasureSpeed(game.Language, result.Correct, game.Elapsed(time.Now()))
+		req.Progress = result.Progress
+		req.Accuracy = result.Accuracy
+		req.Position = result.Position
+		req.CorrectWords = result.Words
+		req.WPM = int(math.Round(speed.WPM))
+	}
+	finished := game.PlayerFinished(userID)
+	game.UpdatePlayer(userID, req.Progress, req.WPM, req.Accuracy, req.CorrectWords, req.Input != nil)
+	if !finished && game.PlayerFinished(userID) {
+		h.announceRecord(r.Context(), game, userID)
+		// An elimination round is decided once only its slowest player is
+		// still typing
+		if game.SessionID != "" && game.Unfinished() <= 1 {
+			defer h.finishGame(game)
+		}
+	}
+
 	// Update game progress in Redis
 	progressKey := fmt.Sprintf("game:%s:progress:%s", gameID, userID)
 	err := h.redis.HSet(context.Background(), progressKey, map[string]interface{}{
@@ -167,24 +536,113 @@ func (h *GameHandler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
 			"progress": req.Progress,
 			"wpm":      req.WPM,
 			"accuracy": req.Accuracy,
+			"cpm":      speed.CPM,
+			"unit":     speed.Unit,
 		},
 	})
 
+	// Stream more text to generated-mode races as players near the end
+	if offset, chunk, ok := game.NextChunk(req.Position); ok {
+		h.Hub.BroadcastToGame(gameID, websocket.Message{
+			Type: "text_chunk",
+			Data: map[string]interface{}{
+				"offset": offset,
+				"text":   chunk,
+			},
+		})
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
+// StartGame starts a waiting game and, for time-attack races, schedules its end
+func (h *GameHandler) StartGame(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	game, exists := h.getGame(gameID)
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	// Only the game's own players and its creator may start it
+	userID := middleware.UserID(r)
+	if userID == "" || (userID != game.CreatedBy && !game.HasPlayer(userID)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !h.startGame(game) {
+		http.Error(w, "Game has already started", http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(game)
+}
+
+// startGame starts a waiting game and tells its clients, reporting false if
+// it had already started
+func (h *GameHandler) startGame(game *models.Game) bool {
+	if !game.TryStart() {
+		return false
+	}
+	if game.Mode == models.ModeTime {
+		time.AfterFunc(time.Duration(game.Duration)*time.Second, func() {
+			h.finishGame(game)
+		})
+	}
+
+	h.Hub.BroadcastToGame(game.ID.String(), websocket.Message{
+		Type: "game_start",
+		Data: map[string]interface{}{
+			"startedAt": game.StartedAt,
+			"mode":      game.Mode,
+			"duration":  game.Duration,
+			"wordCount": game.WordCount,
+		},
+	})
+	return true
+}
+
 // EndGame handles ending a game
 func (h *GameHandler) EndGame(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
 
-	game, exists := h.Games[gameID]
+	game, exists := h.getGame(gameID)
 	if !exists {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	}
 
+	// Only the game's own players and its creator may end it; moderators
+	// use the admin API
+	userID := middleware.UserID(r)
+	if userID == "" || (userID != game.CreatedBy && !game.HasPlayer(userID)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// Ending a round early would decide who is eliminated
+	if game.SessionID != "" {
+		http.Error(w, "Elimination rounds end on their own", http.StatusForbidden)
+		return
+	}
+
+	h.finishGame(game)
+
+	json.NewEncoder(w).Encode(game)
+}
+
+// finishGame marks a game as finished, ranks its players, records their
+// results and broadcasts the final state. Calling it on a finished game is a
+// no-op, so time-attack timers and manual ends can race safely.
+func (h *GameHandler) finishGame(game *models.Game) {
 	game.Mu.Lock()
+	if game.Status == models.Finished {
+		game.Mu.Unlock()
+		return
+	}
 	game.Status = models.Finished
 	endTime := time.Now()
 	game.ReplayData = append(game.ReplayData, models.GameEvent{
@@ -194,26 +652,81 @@ func (h *GameHandler) EndGame(w http.ResponseWriter, r *http.Request) {
 	})
 	game.Mu.Unlock()
 
+	standings := game.Rank(endTime)
+	game.Mu.Lock()
+	game.Standings = standings
+	game.Mu.Unlock()
+
+	h.recordResults(game, standings)
+	h.leaveGame(game)
+
 	// Broadcast game end to all clients
-	endMsg, _ := json.Marshal(map[string]interface{}{
-		"type": "gameEnd",
-		"data": game,
+	h.Hub.BroadcastToGame(game.ID.String(), websocket.Message{
+		Type: "gameEnd",
+		Data: game,
 	})
-	h.broadcastToGame(gameID, endMsg)
 
-	json.NewEncoder(w).Encode(game)
+	if game.SessionID != "" {
+		h.advanceSession(game, standings)
+	}
 }
 
-// Helper method to broadcast messages to all clients in a game
-func (h *GameHandler) broadcastToGame(gameID string, message []byte) {
-	if gameClients, exists := h.Hub.Games[gameID]; exists {
-		for client := range gameClients {
-			select {
-			case client.Send <- message:
-			default:
-				close(client.Send)
-				delete(gameClients, client)
-			}
+// recordResults persists a GameResult row for every ranked player
+func (h *GameHandler) recordResults(game *models.Game, standings []models.Standing) {
+	if h.db == nil || len(standings) == 0 || game.Unranked {
+		return
+	}
+
+	now := time.Now()
+	results := make([]models.GameResult, 0, len(standings))
+	for _, s := range standings {
+		results = append(results, models.GameResult{
+			ID:          uuid.New().String(),
+			GameID:      game.ID.String(),
+			UserID:      s.UserID,
+			WPM:         s.WPM,
+			Accuracy:    s.Accuracy,
+			Position:    s.Position,
+			Mode:        game.Mode,
+			CorrectWPM:  s.CorrectWPM,
+			Finished:    s.Finished,
+			Category:    game.Category,
+			Difficulty:  game.Difficulty,
+			Language:    game.Language,
+			PassageHash: game.PassageHash,
+			PassageID:   game.PassageID,
+			CreatedAt:   now,
+		})
+	}
+	h.markRecord(game, standings, results)
+
+	if err := h.db.Create(&results).Error; err != nil {
+		log.Printf("Error recording results for game %s: %v", game.ID, err)
+	} else {
+		h.boards.Record(context.Background(), results)
+		for _, result := range results {
+			h.announceAchievements(game.ID.String(), h.achievements.RaceFinished(context.Background(), result))
 		}
 	}
+
+	// Session rounds are rated on the session's final placements instead
+	if game.SessionID == "" {
+		userIDs := make([]string, len(standings))
+		for i, s := range standings {
+			userIDs[i] = s.UserID
+		}
+		h.updateRatings(userIDs)
+	}
+}
+
+// announceAchievements tells everyone watching a game or session about
+// achievements unlocked in it
+func (h *GameHandler) announceAchievements(channel string, unlocked []models.Achievement) {
+	for _, achievement := range unlocked {
+		h.Hub.BroadcastToGame(channel, websocket.Message{
+			Type: "achievement_unlocked",
+			Data: achievement,
+		})
+		h.notifyUser(achievement.UserID, models.NotificationAchievement, achievement)
+	}
 }
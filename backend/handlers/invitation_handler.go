@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"typerace/invitations"
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/social"
+	"typerace/websocket"
+)
+
+type InvitationHandler struct {
+	db      *gorm.DB
+	invites *invitations.Manager
+	friends *social.Graph
+	games   *GameHandler
+}
+
+func NewInvitationHandler(db *gorm.DB, invites *invitations.Manager, friends *social.Graph, games *GameHandler) *InvitationHandler {
+	return &InvitationHandler{
+		db:      db,
+		invites: invites,
+		friends: friends,
+		games:   games,
+	}
+}
+
+// CreateInvitation challenges a user, by ID or username, to a race with
+// the given game options. A private game is set up that only the
+// challenger may join until the opponent accepts.
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   string `json:"userId"`
+		Username string `json:"username"`
+		gameOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	id, _ := middleware.IdentityFrom(r.Context())
+	opponentID, ok := findUser(h.db, req.UserID, req.Username)
+	if !ok || h.db.Select("id").First(&models.User{}, "id = ?", opponentID).Error != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if opponentID == id.UserID {
+		http.Error(w, "You cannot challenge yourself", http.StatusBadRequest)
+		return
+	}
+	blocked, err := h.friends.Blocking(r.Context(), id.UserID, opponentID)
+	if err != nil {
+		log.Printf("Error checking blocks between %s and %s: %v", id.UserID, opponentID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot challenge this user", http.StatusForbidden)
+		return
+	}
+
+	game, status, err := h.games.newGame(req.gameOptions)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	invitation := models.Invitation{
+		ID:           uuid.New().String(),
+		ChallengerID: id.UserID,
+		OpponentID:   opponentID,
+		GameID:       game.ID.String(),
+		Mode:         game.Mode,
+		PassageID:    game.PassageID,
+	}
+	if err := h.invites.Create(r.Context(), &invitation); err != nil {
+		log.Printf("Error creating invitation from %s to %s: %v", id.UserID, opponentID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	game.CreatedBy = id.UserID
+	game.IsPrivate = true
+	game.InvitationID = invitation.ID
+	// The opponent is let in once they accept
+	game.Expect(id.UserID, opponentID)
+	game.Invite(id.UserID)
+	h.games.putGame(game)
+	time.AfterFunc(time.Until(invitation.ExpiresAt), func() {
+		h.expire(&invitation)
+	})
+
+	invited := map[string]interface{}{
+		"invitation": invitation,
+		"from": map[string]interface{}{
+			"userId":   id.UserID,
+			"username": id.Username,
+		},
+	}
+	h.games.Hub.SendToUser(opponentID, websocket.Message{
+		Type: "race_invitation",
+		Data: invited,
+	})
+	h.games.notifyUser(opponentID, models.NotificationRaceInvitation, invited)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invitation": invitation,
+		"game":       game,
+	})
+}
+
+// ListInvitations returns the caller's pending incoming and outgoing
+// invitations
+func (h *InvitationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	incoming, outgoing, err := h.invites.Pending(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching invitations of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"incoming": incoming,
+		"outgoing": outgoing,
+	})
+}
+
+// GetInvitation returns an invitation to or from the caller
+func (h *InvitationHandler) GetInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, err := h.invites.Get(r.Context(), mux.Vars(r)["id"], middleware.UserID(r))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// AcceptInvitation accepts an invitation to the caller and lets them join
+// its game. The race starts once both players have joined.
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.respond(w, r, models.InvitationAccepted)
+	if !ok {
+		return
+	}
+
+	game, exists := h.games.getGame(invitation.GameID)
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	game.Invite(invitation.OpponentID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invitation": invitation,
+		"game":       game,
+	})
+}
+
+// DeclineInvitation declines an invitation to the caller
+func (h *InvitationHandler) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.respond(w, r, models.InvitationDeclined)
+	if !ok {
+		return
+	}
+	h.games.deleteGame(invitation.GameID)
+
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// CancelInvitation withdraws an invitation the caller sent
+func (h *InvitationHandler) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := h.respond(w, r, models.InvitationCancelled)
+	if !ok {
+		return
+	}
+	h.games.deleteGame(invitation.GameID)
+
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// GetHeadToHead returns the record of the user in the path against the
+// other user in the path
+func (h *InvitationHandler) GetHeadToHead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	record, err := h.invites.HeadToHead(r.Context(), vars["id"], vars["otherId"])
+	if err != nil {
+		log.Printf("Error fetching head-to-head of %s and %s: %v", vars["id"], vars["otherId"], err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(record)
+}
+
+// respond answers the invitation in the path and tells the other side,
+// writing an error response if it cannot be answered
+func (h *InvitationHandler) respond(w http.ResponseWriter, r *http.Request, status models.InvitationStatus) (*models.Invitation, bool) {
+	id, _ := middleware.IdentityFrom(r.Context())
+	invitation, err := h.invites.Respond(r.Context(), mux.Vars(r)["id"], id.UserID, status)
+	if err != nil {
+		h.writeError(w, err)
+		return nil, false
+	}
+
+	other := invitation.ChallengerID
+	if id.UserID == other {
+		other = invitation.OpponentID
+	}
+	h.games.Hub.SendToUser(other, websocket.Message{
+		Type: "invitation_" + string(status),
+		Data: map[string]interface{}{
+			"invitation": invitation,
+			"by": map[string]interface{}{
+				"userId":   id.UserID,
+				"username": id.Username,
+			},
+		},
+	})
+	return invitation, true
+}
+
+// expire drops an invitation's game if it was never answered and tells
+// both sides
+func (h *InvitationHandler) expire(invitation *models.Invitation) {
+	expired, err := h.invites.Expire(context.Background(), invitation.ID)
+	if err != nil {
+		log.Printf("Error expiring invitation %s: %v", invitation.ID, err)
+		return
+	}
+	if !expired {
+		return
+	}
+	h.games.deleteGame(invitation.GameID)
+
+	invitation.Status = models.InvitationExpired
+	message := websocket.Message{
+		Type: "invitation_expired",
+		Data: map[string]interface{}{
+			"invitation": invitation,
+		},
+	}
+	h.games.Hub.SendToUser(invitation.ChallengerID, message)
+	h.games.Hub.SendToUser(invitation.OpponentID, message)
+}
+
+func (h *InvitationHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, invitations.ErrNotFound):
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+	case errors.Is(err, invitations.ErrForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, invitations.ErrNotPending):
+		http.Error(w, "Invitation has already been answered", http.StatusConflict)
+	case errors.Is(err, invitations.ErrExpired):
+		http.Error(w, "Invitation has expired", http.StatusGone)
+	default:
+		log.Printf("Error updating invitation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -1,68 +1,293 @@
 package handlers
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
-	// "typerace/models"
+	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+
+	"typerace/leaderboard"
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/seasons"
+)
+
+const (
+	defaultLeaderboardSize = 50
+	maxLeaderboardSize     = 100
+	// maxNeighbors bounds how many players either side of the caller are
+	// returned.
+	maxNeighbors = 25
 )
 
 type LeaderboardHandler struct {
-	db *gorm.DB
+	db      *gorm.DB
+	boards  *leaderboard.Leaderboard
+	seasons *seasons.Manager
 }
 
-func NewLeaderboardHandler(db *gorm.DB) *LeaderboardHandler {
+func NewLeaderboardHandler(db *gorm.DB, boards *leaderboard.Leaderboard, seasons *seasons.Manager) *LeaderboardHandler {
 	return &LeaderboardHandler{
-		db: db,
+		db:      db,
+		boards:  boards,
+		seasons: seasons,
 	}
 }
 
-type LeaderboardEntry struct {
-	UserID   string  `json:"userId"`
-	Username string  `json:"username"`
-	WPM      int     `json:"wpm"`
-	Accuracy float64 `json:"accuracy"`
-	Wins     int     `json:"wins"`
+// GetLeaderboard ranks players by their race results. Query parameters:
+// window (day, week, month, season or all), category, difficulty, language, mode,
+// sort (avgWpm, bestWpm, wins, rating or accuracy), minRaces, limit and
+// offset. Authenticated callers also get their own rank, and with
+// neighbors=n the n players either side of them.
+func (h *LeaderboardHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	q, err := parseLeaderboardQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	neighbors, err := strconv.Atoi(r.URL.Query().Get("neighbors"))
+	if err != nil || neighbors < 0 {
+		neighbors = 0
+	}
+	if neighbors > maxNeighbors {
+		neighbors = maxNeighbors
+	}
+	if q.Window == leaderboard.WindowSeason {
+		season, err := h.seasons.Current(r.Context(), time.Now())
+		if err != nil {
+			log.Printf("Error fetching current season: %v", err)
+			http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
+			return
+		}
+		if season == nil {
+			http.Error(w, "No season is running", http.StatusNotFound)
+			return
+		}
+		q.Season = season
+	}
+
+	limit, offset := pagination(r, defaultLeaderboardSize, maxLeaderboardSize)
+	entries, total, err := h.boards.Page(r.Context(), q, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching leaderboard: %v", err)
+		http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"window":  q.Window,
+		"sort":    q.Sort,
+	}
+	if since := q.Since(time.Now()); !since.IsZero() {
+		response["since"] = since
+	}
+
+	if userID := middleware.UserID(r); userID != "" {
+		me, err := h.boards.Rank(r.Context(), q, userID)
+		if err != nil {
+			log.Printf("Error fetching leaderboard rank for %s: %v", userID, err)
+		}
+		response["me"] = me
+
+		if neighbors > 0 && me != nil {
+			around, err := h.boards.Around(r.Context(), q, userID, neighbors)
+			if err != nil {
+				log.Printf("Error fetching leaderboard neighbors for %s: %v", userID, err)
+			}
+			response["neighbors"] = around
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
 }
 
-func (h *LeaderboardHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
-	var entries []LeaderboardEntry
-
-	// Query the database for all users and their stats
-	rows, err := h.db.Raw(`
-        SELECT 
-            u.id as user_id,
-            u.username,
-            AVG(p.wpm) as avg_wpm,
-            AVG(p.accuracy) as avg_accuracy,
-            COUNT(CASE WHEN p.wpm = (
-                SELECT MAX(p2.wpm) 
-                FROM players p2 
-                WHERE p2.game_id = p.game_id
-            ) THEN 1 END) as wins
-        FROM users u
-        LEFT JOIN players p ON p.user_id = u.id 
-        GROUP BY u.id, u.username
-        ORDER BY avg_wpm DESC
-        LIMIT 100
-    `).Rows()
+// GetPassageLeaderboard ranks players by their fastest result on one
+// passage. The id is a stored passage's ID or the hash of a passage's text,
+// which also covers custom texts. Supports limit and offset.
+func (h *LeaderboardHandler) GetPassageLeaderboard(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	response := map[string]interface{}{}
+	var passage models.Passage
+	err := h.db.First(&passage, "id = ?", id).Error
+	switch {
+	case err == nil:
+		response["passage"] = passage
+		id = models.PassageHash(passage.Text)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		log.Printf("Error fetching passage %s: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	case !isPassageHash(id):
+		http.Error(w, "Passage not found", http.StatusNotFound)
+		return
+	}
+
+	limit, offset := pagination(r, defaultLeaderboardSize, maxLeaderboardSize)
+	entries, total, err := h.boards.Passage(r.Context(), id, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching leaderboard for passage %s: %v", id, err)
+		http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
+		return
+	}
+	record, err := h.boards.PassageRecord(r.Context(), id)
+	if err != nil {
+		log.Printf("Error fetching record for passage %s: %v", id, err)
+		http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
+		return
+	}
 
+	response["passageHash"] = id
+	response["record"] = record
+	response["entries"] = entries
+	response["total"] = total
+	json.NewEncoder(w).Encode(response)
+}
+
+// isPassageHash reports whether s looks like a models.PassageHash.
+func isPassageHash(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32 && s == strings.ToLower(s)
+}
+
+// ListSeasons returns every season, newest first
+func (h *LeaderboardHandler) ListSeasons(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pagination(r, defaultLeaderboardSize, maxLeaderboardSize)
+	var list []models.Season
+	if err := h.db.Order("starts_at DESC").Limit(limit).Offset(offset).Find(&list).Error; err != nil {
+		log.Printf("Error listing seasons: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetSeason returns a season by ID, or the running one for "current"
+func (h *LeaderboardHandler) GetSeason(w http.ResponseWriter, r *http.Request) {
+	season, ok := h.loadSeason(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(season)
+}
+
+// GetSeasonStandings ranks a season's players by rating. Archived seasons
+// return their final standings; the running season is ranked live.
+// Supports limit and offset.
+func (h *LeaderboardHandler) GetSeasonStandings(w http.ResponseWriter, r *http.Request) {
+	season, ok := h.loadSeason(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset := pagination(r, defaultLeaderboardSize, maxLeaderboardSize)
+	var (
+		entries interface{}
+		total   int64
+		err     error
+	)
+	if season.ArchivedAt != nil {
+		entries, total, err = h.seasons.Standings(r.Context(), season.ID, limit, offset)
+	} else {
+		entries, total, err = h.boards.Page(r.Context(), leaderboard.Query{
+			Window:   leaderboard.WindowSeason,
+			Season:   season,
+			Sort:     "rating",
+			MinRaces: 1,
+		}, limit, offset)
+	}
 	if err != nil {
+		log.Printf("Error fetching standings of season %s: %v", season.ID, err)
 		http.Error(w, "Error fetching leaderboard data", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var entry LeaderboardEntry
-		err := rows.Scan(&entry.UserID, &entry.Username, &entry.WPM, &entry.Accuracy, &entry.Wins)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"season":  season,
+		"final":   season.ArchivedAt != nil,
+		"entries": entries,
+		"total":   total,
+	})
+}
+
+// loadSeason looks up the season named in the path, writing an error
+// response if there is none
+func (h *LeaderboardHandler) loadSeason(w http.ResponseWriter, r *http.Request) (*models.Season, bool) {
+	id := mux.Vars(r)["id"]
+	if id == "current" {
+		season, err := h.seasons.Current(r.Context(), time.Now())
 		if err != nil {
-			http.Error(w, "Error scanning leaderboard data", http.StatusInternalServerError)
-			return
+			log.Printf("Error fetching current season: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+		if season == nil {
+			http.Error(w, "No season is running", http.StatusNotFound)
+			return nil, false
+		}
+		return season, true
+	}
+
+	var season models.Season
+	if err := h.db.First(&season, "id = ?", id).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error fetching season %s: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
 		}
-		entries = append(entries, entry)
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &season, true
+}
+
+func parseLeaderboardQuery(r *http.Request) (leaderboard.Query, error) {
+	params := r.URL.Query()
+	q := leaderboard.Query{
+		Window:     params.Get("window"),
+		Category:   strings.ToLower(strings.TrimSpace(params.Get("category"))),
+		Difficulty: strings.ToLower(strings.TrimSpace(params.Get("difficulty"))),
+		Language:   strings.TrimSpace(params.Get("language")),
+		Mode:       models.GameMode(params.Get("mode")),
+		Sort:       params.Get("sort"),
+		MinRaces:   1,
 	}
 
-	json.NewEncoder(w).Encode(entries)
+	if q.Window == "" {
+		q.Window = leaderboard.WindowAll
+	}
+	if _, ok := leaderboard.WindowStart(q.Window, time.Now()); !ok && q.Window != leaderboard.WindowSeason {
+		return q, errors.New("window must be day, week, month, season or all")
+	}
+
+	if q.Mode != "" && !q.Mode.Valid() && q.Mode != models.ModeElimination && q.Mode != models.ModeDaily {
+		return q, errors.New("invalid game mode")
+	}
+
+	if q.Sort == "" {
+		q.Sort = "avgWpm"
+	}
+	if _, ok := leaderboard.Sorts[q.Sort]; !ok {
+		return q, errors.New("sort must be avgWpm, bestWpm, wins, rating or accuracy")
+	}
+
+	if raw := params.Get("minRaces"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return q, errors.New("minRaces must be a positive integer")
+		}
+		q.MinRaces = n
+	}
+	return q, nil
 }
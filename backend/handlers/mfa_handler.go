@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"typerace/auth"
+	"typerace/middleware"
+	"typerace/models"
+)
+
+// MFAHandler manages a user's TOTP two-factor authentication
+type MFAHandler struct {
+	db  *gorm.DB
+	mfa *auth.MFA
+}
+
+func NewMFAHandler(db *gorm.DB, mfa *auth.MFA) *MFAHandler {
+	return &MFAHandler{
+		db:  db,
+		mfa: mfa,
+	}
+}
+
+type twoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	RemainingRecoveryCodes int64 `json:"remainingRecoveryCodes"`
+}
+
+// GetStatus reports whether the calling user has two-factor login enabled
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	status := twoFactorStatus{Enabled: user.TwoFactorEnabled()}
+	if status.Enabled {
+		remaining, err := h.mfa.RemainingRecoveryCodes(user.ID)
+		if err != nil {
+			log.Printf("Failed to count recovery codes for %s: %v", user.ID, err)
+		}
+		status.RemainingRecoveryCodes = remaining
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
+
+// Enroll creates a new TOTP secret and returns its otpauth URI. Two-factor
+// login stays off until the user confirms a code with Enable.
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	secret, uri, err := h.mfa.Enroll(user)
+	if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to enroll %s in two-factor authentication: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":     secret,
+		"otpauthUri": uri,
+	})
+}
+
+// Enable confirms enrollment with a code from the authenticator and returns
+// the recovery codes, which are shown only this once
+func (h *MFAHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfa.Enable(user, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrMFAAlreadyEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Failed to enable two-factor authentication for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user: %s", user.Username)
+	json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+}
+
+// Disable turns off two-factor login. It requires both the password and a
+// current code so a stolen access token alone cannot remove it.
+func (h *MFAHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Accounts created through a login provider have no password to check
+	if user.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+	}
+	if !h.verify(w, user, req.Code) {
+		return
+	}
+
+	if err := h.mfa.Disable(user.ID); err != nil {
+		log.Printf("Failed to disable two-factor authentication for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user: %s", user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the calling user's recovery codes after
+// checking a current code
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !h.verify(w, user, req.Code) {
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		log.Printf("Failed to regenerate recovery codes for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+}
+
+func (h *MFAHandler) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	return &user, true
+}
+
+// verify checks a code for a sensitive change and writes the error response
+// if it is rejected
+func (h *MFAHandler) verify(w http.ResponseWriter, user *models.User, code string) bool {
+	err := h.mfa.Verify(user, code)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrMFANotEnrolled):
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+	case errors.Is(err, auth.ErrMFALocked):
+		http.Error(w, "Too many invalid codes, try again later", http.StatusTooManyRequests)
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+	default:
+		log.Printf("Failed to verify two-factor code for %s: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
+}
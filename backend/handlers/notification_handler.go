@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"typerace/middleware"
+	"typerace/notifications"
+	"typerace/presence"
+)
+
+const (
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+	// streamKeepAlive is how often an idle event stream is written to, so
+	// proxies do not close it.
+	streamKeepAlive = 30 * time.Second
+)
+
+type NotificationHandler struct {
+	notifications *notifications.Service
+	presence      *presence.Tracker
+}
+
+func NewNotificationHandler(service *notifications.Service, presence *presence.Tracker) *NotificationHandler {
+	return &NotificationHandler{
+		notifications: service,
+		presence:      presence,
+	}
+}
+
+// ListNotifications returns a page of the caller's notifications, newest
+// first, or only unread ones with ?unread=true
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	unreadOnly, _ := strconv.ParseBool(r.URL.Query().Get("unread"))
+	limit, offset := pagination(r, defaultNotificationPageSize, maxNotificationPageSize)
+
+	list, total, err := h.notifications.List(r.Context(), userID, unreadOnly, limit, offset)
+	if err != nil {
+		log.Printf("Error fetching notifications of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	unread, err := h.notifications.Unread(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error counting unread notifications of %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": list,
+		"total":         total,
+		"unread":        unread,
+	})
+}
+
+// MarkRead marks one of the caller's notifications read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	n, err := h.notifications.MarkRead(r.Context(), userID, mux.Vars(r)["id"])
+	if errors.Is(err, notifications.ErrNotFound) {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking notification %s read: %v", mux.Vars(r)["id"], err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(n)
+}
+
+// MarkAllRead marks all of the caller's notifications read
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	updated, err := h.notifications.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error marking notifications of %s read: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"updated": updated,
+	})
+}
+
+// StreamNotifications sends the caller's new notifications as Server-Sent
+// Events, for clients without a user websocket. Like the websocket it is
+// authenticated by the ticket query parameter, as EventSource cannot set
+// headers.
+func (h *NotificationHandler) StreamNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.presence.Redeem(r.Context(), r.URL.Query().Get("ticket"))
+	if err != nil {
+		if !errors.Is(err, presence.ErrInvalidTicket) {
+			log.Printf("Error redeeming presence ticket: %v", err)
+		}
+		http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, closeStream := h.notifications.Subscribe(userID)
+	defer closeStream()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case n := <-stream:
+			data, err := json.Marshal(n)
+			if err != nil {
+				log.Printf("Error encoding notification %s: %v", n.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", n.ID, data)
+		}
+		flusher.Flush()
+	}
+}
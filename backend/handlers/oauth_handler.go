@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/oauth"
+)
+
+// oauthStateCookie binds a pending external login to the browser that
+// started it, so a callback cannot be replayed into another user's session
+const oauthStateCookie = "oauth_state"
+
+// OAuthHandler logs users in through external OAuth2 and OpenID Connect
+// providers and manages the identities linked to their accounts
+type OAuthHandler struct {
+	db        *gorm.DB
+	auth      *AuthHandler
+	providers *oauth.Registry
+	states    *oauth.StateStore
+}
+
+func NewOAuthHandler(db *gorm.DB, auth *AuthHandler, providers *oauth.Registry, states *oauth.StateStore) *OAuthHandler {
+	return &OAuthHandler{
+		db:        db,
+		auth:      auth,
+		providers: providers,
+		states:    states,
+	}
+}
+
+// ListProviders returns the names of the configured login providers
+func (h *OAuthHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string][]string{"providers": h.providers.Names()})
+}
+
+// StartLogin returns the provider URL to send the user to
+func (h *OAuthHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	h.start(w, r, "")
+}
+
+// StartLink is StartLogin for a logged-in user adding a provider to their
+// account
+func (h *OAuthHandler) StartLink(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.start(w, r, userID)
+}
+
+func (h *OAuthHandler) start(w http.ResponseWriter, r *http.Request, linkUserID string) {
+	provider, err := h.providers.Get(mux.Vars(r)["provider"])
+	if err != nil {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, pending, err := h.states.Begin(r.Context(), provider.Name(), linkUserID)
+	if err != nil {
+		log.Printf("Failed to store login state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, pending.Nonce, oauth.Challenge(pending.Verifier))
+	if err != nil {
+		log.Printf("Failed to start %s login: %v", provider.Name(), err)
+		http.Error(w, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oauth",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int((10 * time.Minute).Seconds()),
+	})
+
+	json.NewEncoder(w).Encode(map[string]string{"authorizationUrl": authURL})
+}
+
+// Callback completes a login or link with the code and state the provider
+// redirected back to the frontend with
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || req.State == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.State)) != 1 {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/api/auth/oauth",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+
+	pending, err := h.states.Take(r.Context(), req.State)
+	if errors.Is(err, oauth.ErrInvalidState) {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load login state: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if pending.Provider != mux.Vars(r)["provider"] {
+		http.Error(w, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	provider, err := h.providers.Get(pending.Provider)
+	if err != nil {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), req.Code, pending.Verifier, pending.Nonce)
+	if err != nil {
+		log.Printf("%s login failed: %v", provider.Name(), err)
+		http.Error(w, "Login with provider failed", http.StatusUnauthorized)
+		return
+	}
+
+	if pending.LinkUserID != "" {
+		h.link(w, pending.LinkUserID, identity)
+		return
+	}
+
+	user, created, err := h.resolveUser(identity)
+	if err != nil {
+		log.Printf("Failed to resolve %s identity: %v", identity.Provider, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	message := ""
+	if created {
+		message = "Registration successful"
+		log.Printf("Registered user %s from %s", user.Username, identity.Provider)
+	}
+	h.auth.completeLogin(w, r, user, message)
+}
+
+// ListIdentities returns the providers linked to the calling user
+func (h *OAuthHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var identities []models.UserIdentity
+	if err := h.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		log.Printf("Failed to list identities for %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(identities)
+}
+
+// Unlink removes a provider from the calling user's account, unless it is
+// their only way to log in
+func (h *OAuthHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&count)
+	if user.PasswordHash == "" && count <= 1 {
+		http.Error(w, "Set a password before unlinking your only login provider", http.StatusConflict)
+		return
+	}
+
+	result := h.db.Where("user_id = ? AND provider = ?", userID, mux.Vars(r)["provider"]).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		log.Printf("Failed to unlink identity for %s: %v", userID, result.Error)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Provider not linked", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// link attaches an identity to an existing user
+func (h *OAuthHandler) link(w http.ResponseWriter, userID string, identity *oauth.Identity) {
+	var existing models.UserIdentity
+	err := h.db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&existing).Error
+	if err == nil {
+		if existing.UserID != userID {
+			http.Error(w, "This account is already linked to another user", http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(existing)
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, identity.Provider).Count(&count)
+	if count > 0 {
+		http.Error(w, "Another account from this provider is already linked", http.StatusConflict)
+		return
+	}
+
+	linked := newIdentity(userID, identity)
+	if err := h.db.Create(linked).Error; err != nil {
+		log.Printf("Failed to link %s identity for %s: %v", identity.Provider, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Linked %s identity to user %s", identity.Provider, userID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(linked)
+}
+
+// resolveUser finds the user for an external identity. Unknown identities
+// are linked to the user with the same verified email, or otherwise get a
+// new account.
+func (h *OAuthHandler) resolveUser(identity *oauth.Identity) (*models.User, bool, error) {
+	var user models.User
+	var linked models.UserIdentity
+	err := h.db.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+	if err == nil {
+		err = h.db.First(&user, "id = ?", linked.UserID).Error
+		return &user, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	// Both sides must have verified the address, or anyone could claim an
+	// account by registering its email with a provider
+	if identity.EmailVerified && identity.Email != "" {
+		err := h.db.Where("LOWER(email) = LOWER(?) AND email_verified_at IS NOT NULL", identity.Email).First(&user).Error
+		if err == nil {
+			if err := h.db.Create(newIdentity(user.ID, identity)).Error; err != nil {
+				return nil, false, err
+			}
+			log.Printf("Linked %s identity to user %s by verified email", identity.Provider, user.Username)
+			return &user, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, err
+		}
+	}
+
+	created, err := h.provision(identity)
+	return created, err == nil, err
+}
+
+// provision creates a user for a new external identity
+func (h *OAuthHandler) provision(identity *oauth.Identity) (*models.User, error) {
+	username, err := h.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	// Only claim the email if it is verified and not already in use
+	if identity.EmailVerified && identity.Email != "" {
+		var count int64
+		h.db.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", identity.Email).Count(&count)
+		if count == 0 {
+			user.Email = identity.Email
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(newIdentity(user.ID, identity)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a free username from the identity's handle,
+// name or email
+func (h *OAuthHandler) availableUsername(identity *oauth.Identity) (string, error) {
+	base := ""
+	for _, candidate := range []string{identity.Username, identity.Name, strings.Split(identity.Email, "@")[0]} {
+		if base = sanitizeUsername(candidate); len(base) >= 3 {
+			break
+		}
+	}
+	if len(base) < 3 {
+		base = "player"
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := h.db.Model(&models.User{}).Where("LOWER(username) = LOWER(?)", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%04d", base, rand.Intn(10000))
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+// maxUsernameLength bounds generated usernames, leaving room for a suffix
+const maxUsernameLength = 20
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+			b.WriteRune('_')
+		}
+		if b.Len() >= maxUsernameLength {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "_-")
+}
+
+func newIdentity(userID string, identity *oauth.Identity) *models.UserIdentity {
+	return &models.UserIdentity{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+	}
+}
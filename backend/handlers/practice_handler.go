@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/typing"
+)
+
+const (
+	// practiceWords is the length of a generated practice drill.
+	practiceWords = 40
+	// weakSpotCount is how many weak keys and bigrams a drill targets.
+	weakSpotCount = 5
+	// maxKeystrokes bounds the size of a single keystroke upload.
+	maxKeystrokes = 5000
+)
+
+type PracticeHandler struct {
+	db    *gorm.DB
+	games *GameHandler
+}
+
+func NewPracticeHandler(db *gorm.DB, games *GameHandler) *PracticeHandler {
+	return &PracticeHandler{
+		db:    db,
+		games: games,
+	}
+}
+
+type KeyProfileEntry struct {
+	Key          string  `json:"key"`
+	Presses      int     `json:"presses"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"errorRate"`
+	AvgLatencyMs float64 `json:"avgLatencyMs"`
+}
+
+type KeyProfileResponse struct {
+	UserID      string            `json:"userId"`
+	Keys        []KeyProfileEntry `json:"keys"`
+	Bigrams     []KeyProfileEntry `json:"bigrams"`
+	WeakKeys    []string          `json:"weakKeys"`
+	WeakBigrams []string          `json:"weakBigrams"`
+}
+
+// StartPractice creates a solo practice game whose passage drills the
+// player's slowest keys and most-missed bigrams
+func (h *PracticeHandler) StartPractice(w http.ResponseWriter, r *http.Request) {
+	id, _ := middleware.IdentityFrom(r.Context())
+	userID := id.UserID
+	playerID, err := uuid.Parse(userID)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, bigrams, err := h.loadProfile(userID)
+	if err != nil {
+		log.Printf("Error loading key profile for %s: %v", userID, err)
+		http.Error(w, "Failed to load typing profile", http.StatusInternalServerError)
+		return
+	}
+	weakKeys := typing.Weakest(keys, weakSpotCount)
+	weakBigrams := typing.Weakest(bigrams, weakSpotCount)
+
+	gameID := uuid.New().String()
+	game := models.NewGame(gameID, typing.Drill(models.CommonWords(), weakKeys, weakBigrams, practiceWords))
+	game.Mode = models.ModePractice
+	game.CreatedBy = userID
+	game.AddPlayer(&models.Player{
+		ID:     uuid.New(),
+		UserID: playerID,
+		GameID: game.ID,
+		Name:   id.Username,
+	})
+	game.Start()
+	h.games.putGame(game)
+	h.games.enterGame(r.Context(), game, userID)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"game":        game,
+		"weakKeys":    weakKeys,
+		"weakBigrams": weakBigrams,
+	})
+}
+
+// RecordKeystrokes folds a race's keystroke log into the player's typing
+// profile
+func (h *PracticeHandler) RecordKeystrokes(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r)
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Keystrokes []typing.Keystroke `json:"keystrokes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Keystrokes) > maxKeystrokes {
+		http.Error(w, "Too many keystrokes", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	game, exists := h.games.getGame(mux.Vars(r)["id"])
+	if !exists {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if !game.HasPlayer(userID) {
+		http.Error(w, "You are not in this race", http.StatusForbidden)
+		return
+	}
+
+	// Every keystroke must name a single character of the passage, as
+	// shown or as compared
+	game.Mu.Lock()
+	text := game.Text
+	game.Mu.Unlock()
+	chars := make(map[string]bool)
+	for _, c := range typing.Graphemes(text) {
+		chars[c] = true
+	}
+	for _, c := range typing.Graphemes(typing.Normalize(text, typing.RulesFor(string(game.PassageType), game.CodeLanguage))) {
+		chars[c] = true
+	}
+	for _, k := range req.Keystrokes {
+		if !chars[k.Expected] {
+			http.Error(w, "Keystrokes must expect a character of the passage", http.StatusBadRequest)
+			return
+		}
+	}
+
+	analysis := typing.Analyze(req.Keystrokes)
+	now := time.Now()
+
+	keyRows := make([]models.KeyStat, 0, len(analysis.Keys))
+	for key, s := range analysis.Keys {
+		keyRows = append(keyRows, models.KeyStat{
+			UserID:         userID,
+			Key:            key,
+			Presses:        s.Presses,
+			Errors:         s.Errors,
+			TotalLatencyMs: s.TotalLatencyMs,
+			UpdatedAt:      now,
+		})
+	}
+	bigramRows := make([]models.BigramStat, 0, len(analysis.Bigrams))
+	for bigram, s := range analysis.Bigrams {
+		bigramRows = append(bigramRows, models.BigramStat{
+			UserID:         userID,
+			Bigram:         bigram,
+			Presses:        s.Presses,
+			Errors:         s.Errors,
+			TotalLatencyMs: s.TotalLatencyMs,
+			UpdatedAt:      now,
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if len(keyRows) > 0 {
+			if err := tx.Clauses(accumulate("key_stats", "key")).Create(&keyRows).Error; err != nil {
+				return err
+			}
+		}
+		if len(bigramRows) > 0 {
+			if err := tx.Clauses(accumulate("bigram_stats", "bigram")).Create(&bigramRows).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error recording keystrokes for %s: %v", userID, err)
+		http.Error(w, "Failed to record keystrokes", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accumulate builds an upsert that adds the inserted counters to an existing
+// row of table keyed by user and column
+func accumulate(table, column string) clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: column}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "presses"}, Value: gorm.Expr(table + ".presses + EXCLUDED.presses")},
+			{Column: clause.Column{Name: "errors"}, Value: gorm.Expr(table + ".errors + EXCLUDED.errors")},
+			{Column: clause.Column{Name: "total_latency_ms"}, Value: gorm.Expr(table + ".total_latency_ms + EXCLUDED.total_latency_ms")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("EXCLUDED.updated_at")},
+		},
+	}
+}
+
+// GetKeyProfile returns a user's per-key and per-bigram heatmap data. The
+// profile shows how someone types, so only its owner may see it.
+func (h *PracticeHandler) GetKeyProfile(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if middleware.UserID(r) != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	keys, bigrams, err := h.loadProfile(userID)
+	if err != nil {
+		log.Printf("Error loading key profile for %s: %v", userID, err)
+		http.Error(w, "Failed to load typing profile", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(KeyProfileResponse{
+		UserID:      userID,
+		Keys:        profileEntries(keys),
+		Bigrams:     profileEntries(bigrams),
+		WeakKeys:    typing.Weakest(keys, weakSpotCount),
+		WeakBigrams: typing.Weakest(bigrams, weakSpotCount),
+	})
+}
+
+func (h *PracticeHandler) loadProfile(userID string) (map[string]typing.KeyStat, map[string]typing.KeyStat, error) {
+	var keyRows []models.KeyStat
+	if err := h.db.Where("user_id = ?", userID).Find(&keyRows).Error; err != nil {
+		return nil, nil, err
+	}
+	var bigramRows []models.BigramStat
+	if err := h.db.Where("user_id = ?", userID).Find(&bigramRows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	keys := make(map[string]typing.KeyStat, len(keyRows))
+	for _, k := range keyRows {
+		keys[k.Key] = typing.KeyStat{Presses: k.Presses, Errors: k.Errors, TotalLatencyMs: k.TotalLatencyMs}
+	}
+	bigrams := make(map[string]typing.KeyStat, len(bigramRows))
+	for _, b := range bigramRows {
+		bigrams[b.Bigram] = typing.KeyStat{Presses: b.Presses, Errors: b.Errors, TotalLatencyMs: b.TotalLatencyMs}
+	}
+	return keys, bigrams, nil
+}
+
+func profileEntries(stats map[string]typing.KeyStat) []KeyProfileEntry {
+	entries := make([]KeyProfileEntry, 0, len(stats))
+	for key, s := range stats {
+		entries = append(entries, KeyProfileEntry{
+			Key:          key,
+			Presses:      s.Presses,
+			Errors:       s.Errors,
+			ErrorRate:    s.ErrorRate(),
+			AvgLatencyMs: s.AvgLatencyMs(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
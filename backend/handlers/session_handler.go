@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/rating"
+	"typerace/websocket"
+)
+
+const (
+	// eliminationPassageWords is the length of each elimination round.
+	eliminationPassageWords = 20
+	// eliminationIntermission is the pause between elimination rounds.
+	eliminationIntermission = 5 * time.Second
+	// eliminationRoundTimeout ends a round that players have stalled, so
+	// the session cannot hang on an idle player.
+	eliminationRoundTimeout = 2 * time.Minute
+)
+
+// CreateSession opens a new elimination lobby
+func (h *GameHandler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	session := models.NewSession(uuid.New().String(), models.ModeElimination, middleware.UserID(r))
+	h.putSession(session)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *GameHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	session, exists := h.getSession(mux.Vars(r)["id"])
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *GameHandler) JoinSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+
+	// The body is optional; the player's user comes from their token
+	var player models.Player
+	if err := json.NewDecoder(r.Body).Decode(&player); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := bindPlayer(r, &player); err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, exists := h.getSession(sessionID)
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := session.AddPlayer(&player); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, models.ErrSessionStarted) || errors.Is(err, models.ErrSessionJoined) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	h.Hub.BroadcastToGame(sessionID, websocket.Message{
+		Type: "player_joined",
+		Data: player,
+	})
+
+	json.NewEncoder(w).Encode(session)
+}
+
+// StartSession starts the first round of an elimination session
+func (h *GameHandler) StartSession(w http.ResponseWriter, r *http.Request) {
+	session, exists := h.getSession(mux.Vars(r)["id"])
+	if !exists {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if middleware.UserID(r) != session.CreatedBy {
+		http.Error(w, "Only the session's creator can start it", http.StatusForbidden)
+		return
+	}
+
+	session.Mu.Lock()
+	if session.Status != models.SessionWaiting {
+		session.Mu.Unlock()
+		http.Error(w, "Session has already started", http.StatusConflict)
+		return
+	}
+	if len(session.Players) < 2 {
+		session.Mu.Unlock()
+		http.Error(w, "At least two players are required", http.StatusBadRequest)
+		return
+	}
+	session.Status = models.SessionActive
+	session.Mu.Unlock()
+
+	h.startRound(session)
+
+	json.NewEncoder(w).Encode(session)
+}
+
+// startRound creates and starts the next round's game with every remaining
+// player of the session
+func (h *GameHandler) startRound(session *models.Session) {
+	session.Mu.Lock()
+	session.Round++
+	game := models.NewGame(uuid.New().String(), models.GenerateText(eliminationPassageWords))
+	game.Mode = models.ModeElimination
+	game.SessionID = session.ID
+	game.Round = session.Round
+	game.Players = append(game.Players, session.Players...)
+	session.GameID = game.ID.String()
+	round := session.Round
+	session.Mu.Unlock()
+
+	h.putGame(game)
+	game.Start()
+	time.AfterFunc(eliminationRoundTimeout, func() {
+		h.finishGame(game)
+	})
+	for _, p := range game.Players {
+		h.enterGame(context.Background(), game, p.UserID.String())
+	}
+
+	h.Hub.BroadcastToGame(session.ID, websocket.Message{
+		Type: "round_start",
+		Data: map[string]interface{}{
+			"sessionId": session.ID,
+			"round":     round,
+			"game":      game,
+		},
+	})
+	for _, p := range game.Players {
+		h.notifyUser(p.UserID.String(), models.NotificationRoundStart, map[string]interface{}{
+			"sessionId": session.ID,
+			"round":     round,
+			"gameId":    game.ID.String(),
+		})
+	}
+}
+
+// advanceSession eliminates the slowest player of a finished round and
+// either schedules the next round or records the session's final placements
+func (h *GameHandler) advanceSession(game *models.Game, standings []models.Standing) {
+	session, exists := h.getSession(game.SessionID)
+	if !exists {
+		return
+	}
+
+	if eliminated, ok := session.Eliminate(standings); ok {
+		msg := websocket.Message{
+			Type: "player_eliminated",
+			Data: eliminated,
+		}
+		h.Hub.BroadcastToGame(session.ID, msg)
+		h.Hub.BroadcastToGame(game.ID.String(), msg)
+	}
+
+	session.Mu.Lock()
+	remaining := len(session.Players)
+	session.Mu.Unlock()
+
+	if remaining > 1 {
+		time.AfterFunc(eliminationIntermission, func() {
+			h.startRound(session)
+		})
+		return
+	}
+
+	session.Mu.Lock()
+	session.Status = models.SessionFinished
+	session.Mu.Unlock()
+
+	placements := session.Placements()
+	h.recordPlacements(placements)
+
+	h.Hub.BroadcastToGame(session.ID, websocket.Message{
+		Type: "session_end",
+		Data: map[string]interface{}{
+			"sessionId":  session.ID,
+			"placements": placements,
+		},
+	})
+}
+
+// recordPlacements persists the final placements of a session, updates the
+// ratings of its players and awards the winner's achievements
+func (h *GameHandler) recordPlacements(placements []models.Placement) {
+	if h.db == nil || len(placements) == 0 {
+		return
+	}
+
+	now := time.Now()
+	userIDs := make([]string, len(placements))
+	for i := range placements {
+		placements[i].ID = uuid.New().String()
+		placements[i].CreatedAt = now
+		userIDs[i] = placements[i].UserID
+	}
+
+	if err := h.db.Create(&placements).Error; err != nil {
+		log.Printf("Error recording session placements: %v", err)
+	} else {
+		for _, p := range placements {
+			if p.Placement == 1 {
+				h.announceAchievements(p.SessionID, h.achievements.TournamentWon(context.Background(), p.UserID))
+			}
+		}
+	}
+	h.updateRatings(userIDs)
+}
+
+// updateRatings applies a rating update to registered users listed in
+// finishing order, best first. Players without an account are skipped.
+func (h *GameHandler) updateRatings(userIDs []string) {
+	var users []models.User
+	if err := h.db.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		log.Printf("Error loading users for rating update: %v", err)
+		return
+	}
+
+	byID := make(map[string]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	ranked := make([]models.User, 0, len(users))
+	for _, id := range userIDs {
+		if u, ok := byID[id]; ok {
+			ranked = append(ranked, u)
+		}
+	}
+	if len(ranked) < 2 {
+		return
+	}
+
+	ratings := make([]float64, len(ranked))
+	for i, u := range ranked {
+		ratings[i] = u.Rating
+	}
+
+	for i, updated := range rating.Update(ratings) {
+		if err := h.db.Model(&models.User{}).Where("id = ?", ranked[i].ID).Update("rating", updated).Error; err != nil {
+			log.Printf("Error updating rating for user %s: %v", ranked[i].ID, err)
+			continue
+		}
+		h.boards.SetRating(context.Background(), ranked[i].ID, updated)
+	}
+}
@@ -2,32 +2,30 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"time"
 
-	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"typerace/achievements"
 	"typerace/models"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	achievements *achievements.Engine
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
+func NewUserHandler(db *gorm.DB, achievements *achievements.Engine) *UserHandler {
 	return &UserHandler{
-		db: db,
+		db:           db,
+		achievements: achievements,
 	}
 }
 
-type CreateUserRequest struct {
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
 type UserResponse struct {
 	ID         string  `json:"id"`
 	Username   string  `json:"username"`
@@ -38,59 +36,6 @@ type UserResponse struct {
 	BestWPM    float64 `json:"bestWpm"`
 }
 
-func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Generate UUID and convert to string
-	userID := uuid.New().String()
-
-	// Check if email already exists
-	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err == nil {
-		http.Error(w, "Email already registered", http.StatusConflict)
-		return
-	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
-		return
-	}
-
-	now := time.Now()
-	user = models.User{
-		ID:           userID,
-		Username:     req.Username,
-		Email:        req.Email,
-		PasswordHash: string(hashedPassword),
-		CreatedAt:    now,
-		UpdatedAt:    now,
-	}
-
-	if err := h.db.Create(&user).Error; err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
-		return
-	}
-
-	response := UserResponse{
-		ID:         user.ID,
-		Username:   user.Username,
-		Email:      user.Email,
-		Avatar:     user.Avatar,
-		TotalRaces: user.TotalRaces,
-		AverageWPM: user.AverageWPM,
-		BestWPM:    user.BestWPM,
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
-}
-
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email    string `json:"email"`
@@ -145,3 +90,44 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// GetAchievements lists the achievements a user has unlocked and the rules
+// of those still locked
+func (h *UserHandler) GetAchievements(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	var user models.User
+	if err := h.db.Select("id").First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error loading user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	unlocked, err := h.achievements.Unlocked(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error loading achievements of %s: %v", userID, err)
+		http.Error(w, "Failed to load achievements", http.StatusInternalServerError)
+		return
+	}
+
+	held := make(map[string]bool, len(unlocked))
+	for _, a := range unlocked {
+		held[a.Type] = true
+	}
+	locked := make([]achievements.Rule, 0)
+	for _, rule := range h.achievements.Rules() {
+		if !held[rule.Type] {
+			locked = append(locked, rule)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId":   userID,
+		"unlocked": unlocked,
+		"locked":   locked,
+	})
+}
@@ -0,0 +1,159 @@
+// Package invitations records race challenges between users. An invitation
+// stays pending until the opponent accepts or declines it, the challenger
+// cancels it, or it expires.
+package invitations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+// TTL is how long an opponent has to answer an invitation.
+const TTL = 5 * time.Minute
+
+var (
+	ErrNotFound   = errors.New("invitation not found")
+	ErrForbidden  = errors.New("invitation belongs to other users")
+	ErrNotPending = errors.New("invitation has already been answered")
+	ErrExpired    = errors.New("invitation has expired")
+)
+
+// Record is how a user has fared against an opponent in the ranked races
+// they were both in.
+type Record struct {
+	UserID         string     `json:"userId"`
+	OpponentID     string     `json:"opponentId"`
+	Races          int        `json:"races"`
+	Wins           int        `json:"wins"`
+	Losses         int        `json:"losses"`
+	Draws          int        `json:"draws"`
+	AvgWPM         float64    `json:"avgWpm"`
+	OpponentAvgWPM float64    `json:"opponentAvgWpm"`
+	LastRaceAt     *time.Time `json:"lastRaceAt,omitempty"`
+}
+
+type Manager struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Manager {
+	return &Manager{
+		db: db,
+	}
+}
+
+// Create stores a new pending invitation, expiring TTL from now.
+func (m *Manager) Create(ctx context.Context, invitation *models.Invitation) error {
+	now := time.Now()
+	invitation.Status = models.InvitationPending
+	invitation.CreatedAt = now
+	invitation.ExpiresAt = now.Add(TTL)
+	return m.db.WithContext(ctx).Create(invitation).Error
+}
+
+// Get returns an invitation to or from userID.
+func (m *Manager) Get(ctx context.Context, id, userID string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := m.db.WithContext(ctx).First(&invitation, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if userID != invitation.ChallengerID && userID != invitation.OpponentID {
+		return nil, ErrForbidden
+	}
+	return &invitation, nil
+}
+
+// Pending lists the unexpired pending invitations sent to and by userID,
+// newest first.
+func (m *Manager) Pending(ctx context.Context, userID string) (incoming, outgoing []models.Invitation, err error) {
+	now := time.Now()
+	pending := func() *gorm.DB {
+		return m.db.WithContext(ctx).Where("status = ? AND expires_at > ?", models.InvitationPending, now).Order("created_at DESC")
+	}
+	incoming, outgoing = []models.Invitation{}, []models.Invitation{}
+	if err = pending().Where("opponent_id = ?", userID).Find(&incoming).Error; err != nil {
+		return nil, nil, err
+	}
+	if err = pending().Where("challenger_id = ?", userID).Find(&outgoing).Error; err != nil {
+		return nil, nil, err
+	}
+	return incoming, outgoing, nil
+}
+
+// Respond answers a pending invitation on behalf of userID. Only the
+// opponent may accept or decline it and only the challenger may cancel it.
+func (m *Manager) Respond(ctx context.Context, id, userID string, status models.InvitationStatus) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invitation, "id = ?", id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		answerer := invitation.OpponentID
+		if status == models.InvitationCancelled {
+			answerer = invitation.ChallengerID
+		}
+		switch now := time.Now(); {
+		case userID != answerer:
+			return ErrForbidden
+		case invitation.Status != models.InvitationPending:
+			return ErrNotPending
+		case !now.Before(invitation.ExpiresAt):
+			return ErrExpired
+		default:
+			invitation.Status = status
+			invitation.RespondedAt = &now
+		}
+		return tx.Model(&invitation).Updates(map[string]interface{}{
+			"status":       invitation.Status,
+			"responded_at": invitation.RespondedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// Expire marks an invitation expired if it is still pending once it is due
+// and reports whether it did.
+func (m *Manager) Expire(ctx context.Context, id string) (bool, error) {
+	res := m.db.WithContext(ctx).Model(&models.Invitation{}).
+		Where("id = ? AND status = ? AND expires_at <= ?", id, models.InvitationPending, time.Now()).
+		Update("status", models.InvitationExpired)
+	return res.RowsAffected > 0, res.Error
+}
+
+// HeadToHead returns userID's record against opponentID over every ranked
+// race they were both in, whoever set it up.
+func (m *Manager) HeadToHead(ctx context.Context, userID, opponentID string) (Record, error) {
+	// Scan zeroes its destination, so the IDs are set afterwards
+	var record Record
+	err := m.db.WithContext(ctx).Table("game_results a").
+		Select(`COUNT(*) AS races,
+			COUNT(*) FILTER (WHERE a.position < b.position) AS wins,
+			COUNT(*) FILTER (WHERE a.position > b.position) AS losses,
+			COUNT(*) FILTER (WHERE a.position = b.position) AS draws,
+			COALESCE(AVG(a.wpm), 0) AS avg_wpm,
+			COALESCE(AVG(b.wpm), 0) AS opponent_avg_wpm,
+			MAX(a.created_at) AS last_race_at`).
+		Joins("JOIN game_results b ON b.game_id = a.game_id AND b.user_id = ?", opponentID).
+		Where("a.user_id = ? AND a.mode <> ?", userID, models.ModePractice).
+		Scan(&record).Error
+	record.UserID, record.OpponentID = userID, opponentID
+	return record, err
+}
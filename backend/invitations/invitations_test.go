@@ -0,0 +1,79 @@
+package invitations
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+// testDB connects to the Postgres database named by TEST_DATABASE_DSN and
+// migrates it, or skips the test if the variable is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestHeadToHead(t *testing.T) {
+	conn := testDB(t)
+	ctx := context.Background()
+	a, b := uuid.New().String(), uuid.New().String()
+	t.Cleanup(func() { conn.Where("user_id IN ?", []string{a, b}).Delete(&models.GameResult{}) })
+
+	race := func(mode models.GameMode, aPosition, bPosition, aWPM, bWPM int) {
+		game := uuid.New().String()
+		results := []models.GameResult{
+			{ID: uuid.New().String(), GameID: game, UserID: a, Mode: mode, Position: aPosition, WPM: aWPM, CreatedAt: time.Now()},
+			{ID: uuid.New().String(), GameID: game, UserID: b, Mode: mode, Position: bPosition, WPM: bWPM, CreatedAt: time.Now()},
+		}
+		if err := conn.Create(&results).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	race(models.ModeStandard, 1, 2, 80, 60)
+	race(models.ModeStandard, 2, 1, 70, 90)
+	race(models.ModeTime, 1, 2, 90, 30)
+	// Practice is not a race against each other
+	race(models.ModePractice, 2, 1, 10, 100)
+
+	got, err := New(conn).HeadToHead(ctx, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != a || got.OpponentID != b {
+		t.Errorf("record is of %q against %q, want %q against %q", got.UserID, got.OpponentID, a, b)
+	}
+	if got.Races != 3 || got.Wins != 2 || got.Losses != 1 || got.Draws != 0 {
+		t.Errorf("record %d races, %d-%d-%d, want 3 races, 2-1-0", got.Races, got.Wins, got.Losses, got.Draws)
+	}
+	if got.AvgWPM != 80 || got.OpponentAvgWPM != 60 || got.LastRaceAt == nil {
+		t.Errorf("record %+v", got)
+	}
+
+	none, err := New(conn).HeadToHead(ctx, a, uuid.New().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none.Races != 0 || none.UserID != a {
+		t.Errorf("record against a stranger = %+v", none)
+	}
+}
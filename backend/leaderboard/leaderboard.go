@@ -0,0 +1,236 @@
+// Package leaderboard ranks players by their race results. Rankings are
+// kept in Redis sorted sets, updated as results are recorded and rebuilt
+// from Postgres periodically; queries Redis cannot answer are computed in
+// SQL.
+package leaderboard
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// Windows are the periods a leaderboard can cover. They are calendar
+// periods in UTC, weeks starting on Monday, except WindowSeason which
+// covers the query's season.
+const (
+	WindowDay    = "day"
+	WindowWeek   = "week"
+	WindowMonth  = "month"
+	WindowAll    = "all"
+	WindowSeason = "season"
+)
+
+// Sorts maps each sort key to the column it ranks by.
+var Sorts = map[string]string{
+	"avgWpm":   "avg_wpm",
+	"bestWpm":  "best_wpm",
+	"wins":     "wins",
+	"rating":   "rating",
+	"accuracy": "accuracy",
+}
+
+type Entry struct {
+	Rank     int     `json:"rank"`
+	UserID   string  `json:"userId"`
+	Username string  `json:"username"`
+	Races    int     `json:"races"`
+	AvgWPM   float64 `json:"avgWpm"`
+	BestWPM  int     `json:"bestWpm"`
+	Accuracy float64 `json:"accuracy"`
+	Wins     int     `json:"wins"`
+	Rating   float64 `json:"rating"`
+}
+
+// Query selects and orders a leaderboard.
+type Query struct {
+	Window     string
+	Category   string
+	Difficulty string
+	Language   string
+	Mode       models.GameMode
+	// Sort is a key of Sorts.
+	Sort     string
+	MinRaces int
+	// Season bounds WindowSeason.
+	Season *models.Season
+}
+
+// Since returns when q's window began at now, or the zero time for
+// WindowAll.
+func (q Query) Since(now time.Time) time.Time {
+	if q.Window == WindowSeason && q.Season != nil {
+		return q.Season.StartsAt
+	}
+	start, _ := WindowStart(q.Window, now)
+	return start
+}
+
+// Until returns when q's window ends if it has already been fixed, as for
+// a season, or the zero time.
+func (q Query) Until() time.Time {
+	if q.Window == WindowSeason && q.Season != nil {
+		return q.Season.EndsAt
+	}
+	return time.Time{}
+}
+
+// WindowStart returns when the named window began at now. It reports false
+// for unknown windows.
+func WindowStart(window string, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case WindowAll:
+		return time.Time{}, true
+	case WindowDay:
+		return today, true
+	case WindowWeek:
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7), true
+	case WindowMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), true
+	}
+	return time.Time{}, false
+}
+
+// windowEnd returns when the window that began at start ends.
+func windowEnd(window string, start time.Time) time.Time {
+	switch window {
+	case WindowDay:
+		return start.AddDate(0, 0, 1)
+	case WindowWeek:
+		return start.AddDate(0, 0, 7)
+	case WindowMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return time.Time{}
+}
+
+// ranking answers leaderboard queries from one store.
+type ranking interface {
+	Page(ctx context.Context, q Query, limit, offset int) ([]Entry, int64, error)
+	// Rank returns userID's entry, or nil if they are not ranked.
+	Rank(ctx context.Context, q Query, userID string) (*Entry, error)
+	// Around returns up to n entries either side of userID's, and theirs.
+	Around(ctx context.Context, q Query, userID string, n int) ([]Entry, error)
+}
+
+// Leaderboard serves rankings from Redis where it can and from SQL
+// otherwise, including when Redis fails.
+type Leaderboard struct {
+	db    *gorm.DB
+	redis *redisRanking
+	sql   *sqlRanking
+}
+
+func New(db *gorm.DB, client *redis.Client) *Leaderboard {
+	return &Leaderboard{
+		db:    db,
+		redis: &redisRanking{client: client, db: db},
+		sql:   &sqlRanking{db: db},
+	}
+}
+
+func (l *Leaderboard) Page(ctx context.Context, q Query, limit, offset int) ([]Entry, int64, error) {
+	if l.redis.serves(q) {
+		entries, total, err := l.redis.Page(ctx, q, limit, offset)
+		if err == nil {
+			return entries, total, nil
+		}
+		log.Printf("Redis leaderboard unavailable, using SQL: %v", err)
+	}
+	return l.sql.Page(ctx, q, limit, offset)
+}
+
+func (l *Leaderboard) Rank(ctx context.Context, q Query, userID string) (*Entry, error) {
+	if l.redis.serves(q) {
+		entry, err := l.redis.Rank(ctx, q, userID)
+		if err == nil {
+			return entry, nil
+		}
+		log.Printf("Redis leaderboard unavailable, using SQL: %v", err)
+	}
+	return l.sql.Rank(ctx, q, userID)
+}
+
+func (l *Leaderboard) Around(ctx context.Context, q Query, userID string, n int) ([]Entry, error) {
+	if l.redis.serves(q) {
+		entries, err := l.redis.Around(ctx, q, userID, n)
+		if err == nil {
+			return entries, nil
+		}
+		log.Printf("Redis leaderboard unavailable, using SQL: %v", err)
+	}
+	return l.sql.Around(ctx, q, userID, n)
+}
+
+// Ranked returns a query of every ranked entry of q on db, for use in SQL
+// statements such as archiving a season's standings in a transaction.
+func (l *Leaderboard) Ranked(db *gorm.DB, q Query) *gorm.DB {
+	return l.sql.ranked(db, q)
+}
+
+// Record adds freshly stored results to the Redis rankings. Results of
+// practice drills, guests and banned users are skipped, as in SQL. Errors
+// are logged; the next reconciliation repairs any drift.
+func (l *Leaderboard) Record(ctx context.Context, results []models.GameResult) {
+	if err := l.redis.record(ctx, results, time.Now()); err != nil {
+		log.Printf("Error updating leaderboards: %v", err)
+	}
+}
+
+// SetRating updates a player's position in the rating ranking.
+func (l *Leaderboard) SetRating(ctx context.Context, userID string, rating float64) {
+	if err := l.redis.setRating(ctx, userID, rating); err != nil {
+		log.Printf("Error updating rating leaderboard for %s: %v", userID, err)
+	}
+}
+
+// RefreshRatings rebuilds the rating ranking, as after ratings are changed
+// in bulk.
+func (l *Leaderboard) RefreshRatings(ctx context.Context) {
+	if err := l.redis.rebuildRatings(ctx); err != nil {
+		log.Printf("Error rebuilding rating leaderboard: %v", err)
+	}
+}
+
+// Remove drops a player from every current ranking, as when they are
+// banned.
+func (l *Leaderboard) Remove(ctx context.Context, userID string) {
+	if err := l.redis.remove(ctx, userID, time.Now()); err != nil {
+		log.Printf("Error removing %s from leaderboards: %v", userID, err)
+	}
+}
+
+// Rebuild replaces every current Redis ranking with one computed in SQL, as
+// after results are deleted. Errors are logged; the next reconciliation
+// repairs any drift.
+func (l *Leaderboard) Rebuild(ctx context.Context) {
+	for _, p := range currentPeriods(time.Now()) {
+		if err := l.redis.rebuild(ctx, p); err != nil {
+			log.Printf("Error rebuilding %s leaderboards: %v", p.name(), err)
+		}
+	}
+}
+
+// Run rebuilds the Redis rankings from Postgres at startup and then every
+// interval until ctx is done. Only one replica rebuilds at a time.
+func (l *Leaderboard) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.redis.reconcile(ctx, time.Now(), interval); err != nil {
+			log.Printf("Error reconciling leaderboards: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
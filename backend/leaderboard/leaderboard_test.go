@@ -0,0 +1,124 @@
+package leaderboard
+
+import (
+	"testing"
+	"time"
+
+	"typerace/models"
+)
+
+func TestWindowStart(t *testing.T) {
+	// Late on Wednesday at UTC-2 is already Thursday in UTC
+	now := time.Date(2024, 5, 15, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	tests := []struct {
+		window string
+		want   time.Time
+	}{
+		{WindowAll, time.Time{}},
+		{WindowDay, time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{WindowWeek, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{WindowMonth, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := WindowStart(tt.window, now)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("WindowStart(%s) = %s, %v, want %s", tt.window, got, ok, tt.want)
+		}
+	}
+
+	sunday := time.Date(2024, 5, 19, 12, 0, 0, 0, time.UTC)
+	if got, _ := WindowStart(WindowWeek, sunday); !got.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("week of a Sunday starts %s, want the Monday before", got)
+	}
+	if _, ok := WindowStart("fortnight", now); ok {
+		t.Error("WindowStart accepted an unknown window")
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		window   string
+		name     string
+		expireAt time.Time
+	}{
+		{WindowAll, "all", time.Time{}},
+		{WindowDay, "day:2024-05-15", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+		{WindowWeek, "week:2024-05-13", time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC)},
+		{WindowMonth, "month:2024-05", time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		p := currentPeriod(tt.window, now)
+		if p.name() != tt.name {
+			t.Errorf("%s period name = %s, want %s", tt.window, p.name(), tt.name)
+		}
+		if !p.expireAt().Equal(tt.expireAt) {
+			t.Errorf("%s period expires %s, want %s", tt.window, p.expireAt(), tt.expireAt)
+		}
+	}
+}
+
+// TestQueryScopeMatchesResultScopes checks that the sorted set a query reads
+// from is one every matching result is recorded in, and no other result.
+func TestQueryScopeMatchesResultScopes(t *testing.T) {
+	result := models.GameResult{Category: "quotes", Difficulty: "hard", Language: "en", Mode: models.ModeTime}
+	other := models.GameResult{Category: "code", Difficulty: "easy", Language: "de", Mode: models.ModeWords}
+	queries := []Query{
+		{},
+		{Category: "quotes"},
+		{Difficulty: "hard"},
+		{Language: "en"},
+		{Mode: models.ModeTime},
+	}
+	contains := func(scopes []string, scope string) bool {
+		for _, s := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+		return false
+	}
+	for _, q := range queries {
+		scope, ok := queryScope(q)
+		if !ok {
+			t.Errorf("queryScope(%+v) is not served", q)
+			continue
+		}
+		if !contains(resultScopes(result), scope) {
+			t.Errorf("scope %s of %+v is not recorded for a matching result", scope, q)
+		}
+		if scope != allScope && contains(resultScopes(other), scope) {
+			t.Errorf("scope %s of %+v is recorded for a result it filters out", scope, q)
+		}
+	}
+
+	if _, ok := queryScope(Query{Category: "quotes", Mode: models.ModeTime}); ok {
+		t.Error("queryScope served two filters")
+	}
+}
+
+func TestRedisServes(t *testing.T) {
+	season := &models.Season{}
+	tests := []struct {
+		name string
+		q    Query
+		want bool
+	}{
+		{"all time average", Query{Window: WindowAll, Sort: "avgWpm"}, true},
+		{"daily wins by mode", Query{Window: WindowDay, Sort: "wins", Mode: models.ModeTime}, true},
+		{"one race minimum", Query{Window: WindowWeek, Sort: "bestWpm", MinRaces: 1}, true},
+		{"all time rating", Query{Window: WindowAll, Sort: "rating"}, true},
+		{"two filters", Query{Window: WindowAll, Sort: "avgWpm", Category: "quotes", Language: "en"}, false},
+		{"race minimum", Query{Window: WindowAll, Sort: "avgWpm", MinRaces: 5}, false},
+		{"season", Query{Window: WindowSeason, Sort: "avgWpm", Season: season}, false},
+		{"weekly rating", Query{Window: WindowWeek, Sort: "rating"}, false},
+		{"filtered rating", Query{Window: WindowAll, Sort: "rating", Mode: models.ModeTime}, false},
+		{"unknown sort", Query{Window: WindowAll, Sort: "name"}, false},
+	}
+	s := &redisRanking{}
+	for _, tt := range tests {
+		if got := s.serves(tt.q); got != tt.want {
+			t.Errorf("%s: serves = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
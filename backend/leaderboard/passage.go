@@ -0,0 +1,76 @@
+package leaderboard
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// PassageEntry is a player's best result on one passage.
+type PassageEntry struct {
+	Rank       int       `json:"rank"`
+	UserID     string    `json:"userId"`
+	Username   string    `json:"username"`
+	WPM        int       `json:"wpm"`
+	Accuracy   float64   `json:"accuracy"`
+	Record     bool      `json:"record"`
+	GameID     string    `json:"gameId"`
+	AchievedAt time.Time `json:"achievedAt"`
+}
+
+// Passage ranks players by their fastest result on the passage with the
+// given hash. Equal speeds share a rank and are listed oldest first.
+func (l *Leaderboard) Passage(ctx context.Context, hash string, limit, offset int) ([]PassageEntry, int64, error) {
+	db := l.db.WithContext(ctx)
+	var total int64
+	if err := db.Table("(?) AS bests", passageBests(db, hash)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]PassageEntry, 0, limit)
+	err := db.Table("(?) AS bests", passageBests(db, hash)).
+		Select("*, RANK() OVER (ORDER BY wpm DESC) AS rank").
+		Order("rank, achieved_at").Limit(limit).Offset(offset).
+		Scan(&entries).Error
+	return entries, total, err
+}
+
+// PassageRecord returns the fastest result on the passage, or nil if no
+// one has finished it.
+func (l *Leaderboard) PassageRecord(ctx context.Context, hash string) (*PassageEntry, error) {
+	entries, _, err := l.Passage(ctx, hash, 1, 0)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// ReflagPassageRecord flags the fastest remaining result on the passage as
+// its record, as after the record result is deleted. It runs on db so that
+// it can join the deletion's transaction.
+func (l *Leaderboard) ReflagPassageRecord(db *gorm.DB, hash string) error {
+	var fastest PassageEntry
+	err := db.Table("(?) AS bests", passageBests(db, hash)).
+		Order("wpm DESC, achieved_at").Limit(1).Scan(&fastest).Error
+	if err != nil || fastest.UserID == "" || fastest.Record {
+		return err
+	}
+	return db.Model(&models.GameResult{}).
+		Where("passage_hash = ? AND user_id = ? AND game_id = ?", hash, fastest.UserID, fastest.GameID).
+		Update("record", true).Error
+}
+
+// passageBests selects each ranked player's fastest result on a passage.
+func passageBests(db *gorm.DB, hash string) *gorm.DB {
+	runs := db.Table("game_results gr").
+		Select(`gr.user_id, u.username, gr.wpm, gr.accuracy, gr.record, gr.game_id,
+			gr.created_at AS achieved_at,
+			ROW_NUMBER() OVER (PARTITION BY gr.user_id ORDER BY gr.wpm DESC, gr.created_at) AS nth`).
+		Joins("JOIN users u ON u.id = gr.user_id").
+		Where("u.banned_at IS NULL OR u.banned_until <= ?", time.Now()).
+		Where("gr.passage_hash = ?", hash)
+	return db.Table("(?) AS runs", runs).Where("nth = 1")
+}
@@ -0,0 +1,93 @@
+package leaderboard
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+// testDB connects to the Postgres database named by TEST_DATABASE_DSN and
+// migrates it, or skips the test if the variable is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestReflagPassageRecord(t *testing.T) {
+	conn := testDB(t)
+	l := &Leaderboard{db: conn}
+	hash := "reflag-" + uuid.New().String()
+	users := make([]models.User, 3)
+	for i := range users {
+		users[i] = models.User{ID: uuid.New().String(), Username: "reflag-" + uuid.New().String()[:8]}
+		if err := conn.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		conn.Where("passage_hash = ?", hash).Delete(&models.GameResult{})
+		for _, u := range users {
+			conn.Delete(&u)
+		}
+	})
+
+	start := time.Now().Add(-time.Hour)
+	result := func(user models.User, wpm int, record bool, at time.Duration) models.GameResult {
+		return models.GameResult{
+			ID: uuid.New().String(), GameID: uuid.New().String(), UserID: user.ID, WPM: wpm,
+			Mode: models.ModeStandard, Finished: true, PassageHash: hash, Record: record, CreatedAt: start.Add(at),
+		}
+	}
+	// b and c tie behind a's record; b got there first
+	results := []models.GameResult{
+		result(users[1], 90, true, 0),
+		result(users[0], 100, true, time.Minute),
+		result(users[2], 90, false, 2*time.Minute),
+		result(users[1], 80, false, 3*time.Minute),
+	}
+	if err := conn.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Delete(&results[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReflagPassageRecord(conn, hash); err != nil {
+		t.Fatal(err)
+	}
+	var flagged []string
+	conn.Model(&models.GameResult{}).Where("passage_hash = ? AND record", hash).Order("id").Pluck("id", &flagged)
+	if len(flagged) != 1 || flagged[0] != results[0].ID {
+		t.Errorf("records after deleting the fastest = %v, want only %s", flagged, results[0].ID)
+	}
+
+	if err := conn.Delete(&results[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := l.ReflagPassageRecord(conn, hash); err != nil {
+		t.Fatal(err)
+	}
+	var record models.GameResult
+	if err := conn.Where("passage_hash = ? AND record", hash).First(&record).Error; err != nil || record.ID != results[2].ID {
+		t.Errorf("record after deleting the holder = %s, %v, want c's %s", record.ID, err, results[2].ID)
+	}
+}
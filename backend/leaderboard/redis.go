@@ -0,0 +1,565 @@
+package leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// Redis keeps, for every period and scope, a hash of each player's race
+// totals and a sorted set per ranked column:
+//
+//	lb:<period>:<scope>:totals    <user>:races, <user>:wpm, <user>:accuracy
+//	lb:<period>:<scope>:avg_wpm   and best_wpm, wins, accuracy
+//	lb:<period>:scopes            the scopes with rankings in the period
+//	lb:rating                     all-time rating of every ranked player
+//
+// A period is "all" or a window and its start, such as day:2024-05-01, so
+// each window rolls over to fresh keys; the old keys expire one window
+// after they end. A scope is "all" or a single filter, such as mode=time.
+const (
+	keyPrefix     = "lb:"
+	ratingKey     = keyPrefix + "rating"
+	reconcileLock = keyPrefix + "reconcile:lock"
+	allScope      = "all"
+)
+
+// metrics are the sorted sets kept for each scope; rating is kept once.
+var metrics = []string{"avg_wpm", "best_wpm", "wins", "accuracy"}
+
+// recordScript adds one result to a scope: KEYS are the totals hash and
+// the avg_wpm, best_wpm, wins and accuracy sets; ARGV are the user, WPM,
+// accuracy, 1 for a win or 0, and the expiry as a Unix time or 0.
+var recordScript = redis.NewScript(`
+local user = ARGV[1]
+local races = redis.call('HINCRBY', KEYS[1], user .. ':races', 1)
+local wpm = tonumber(redis.call('HINCRBYFLOAT', KEYS[1], user .. ':wpm', ARGV[2]))
+local accuracy = tonumber(redis.call('HINCRBYFLOAT', KEYS[1], user .. ':accuracy', ARGV[3]))
+redis.call('ZADD', KEYS[2], wpm / races, user)
+local best = redis.call('ZSCORE', KEYS[3], user)
+if not best or tonumber(best) < tonumber(ARGV[2]) then
+	redis.call('ZADD', KEYS[3], ARGV[2], user)
+end
+redis.call('ZINCRBY', KEYS[4], ARGV[4], user)
+redis.call('ZADD', KEYS[5], accuracy / races, user)
+if tonumber(ARGV[5]) > 0 then
+	for i = 1, #KEYS do
+		redis.call('EXPIREAT', KEYS[i], ARGV[5])
+	end
+end
+return races
+`)
+
+// period is one instance of a window, such as the week starting on a date.
+type period struct {
+	window     string
+	start, end time.Time
+}
+
+func currentPeriod(window string, now time.Time) period {
+	start, _ := WindowStart(window, now)
+	return period{window: window, start: start, end: windowEnd(window, start)}
+}
+
+func currentPeriods(now time.Time) []period {
+	windows := []string{WindowAll, WindowDay, WindowWeek, WindowMonth}
+	periods := make([]period, len(windows))
+	for i, window := range windows {
+		periods[i] = currentPeriod(window, now)
+	}
+	return periods
+}
+
+func (p period) name() string {
+	switch p.window {
+	case WindowAll:
+		return WindowAll
+	case WindowMonth:
+		return p.window + ":" + p.start.Format("2006-01")
+	}
+	return p.window + ":" + p.start.Format("2006-01-02")
+}
+
+// expireAt is when the period's keys expire: one window after it ends, so
+// the previous period stays readable for a while. All-time keys never
+// expire and return zero.
+func (p period) expireAt() time.Time {
+	if p.window == WindowAll {
+		return time.Time{}
+	}
+	return p.end.Add(p.end.Sub(p.start))
+}
+
+func (p period) key(scope, metric string) string {
+	return keyPrefix + p.name() + ":" + scope + ":" + metric
+}
+
+func (p period) scopesKey() string {
+	return keyPrefix + p.name() + ":scopes"
+}
+
+// resultScopes are the scopes a result counts towards.
+func resultScopes(r models.GameResult) []string {
+	scopes := []string{allScope}
+	for _, filter := range [][2]string{
+		{"category", r.Category},
+		{"difficulty", r.Difficulty},
+		{"language", r.Language},
+		{"mode", string(r.Mode)},
+	} {
+		if filter[1] != "" {
+			scopes = append(scopes, filter[0]+"="+filter[1])
+		}
+	}
+	return scopes
+}
+
+// queryScope returns the scope answering q, if q filters on at most one
+// field.
+func queryScope(q Query) (string, bool) {
+	scope, filters := allScope, 0
+	for _, filter := range [][2]string{
+		{"category", q.Category},
+		{"difficulty", q.Difficulty},
+		{"language", q.Language},
+		{"mode", string(q.Mode)},
+	} {
+		if filter[1] != "" {
+			scope = filter[0] + "=" + filter[1]
+			filters++
+		}
+	}
+	return scope, filters <= 1
+}
+
+// redisRanking answers queries from the sorted sets in O(log n) per entry.
+type redisRanking struct {
+	client *redis.Client
+	db     *gorm.DB
+}
+
+// serves reports whether the sorted sets can answer q: they hold no
+// combinations of filters, race thresholds or seasons, and rating is only
+// ranked all-time across all races.
+func (s *redisRanking) serves(q Query) bool {
+	scope, ok := queryScope(q)
+	if !ok || q.MinRaces > 1 || q.Window == WindowSeason {
+		return false
+	}
+	if q.Sort == "rating" {
+		return q.Window == WindowAll && scope == allScope
+	}
+	_, known := Sorts[q.Sort]
+	return known
+}
+
+// board returns the period, scope and sorted set answering q.
+func (s *redisRanking) board(q Query, now time.Time) (period, string, string) {
+	p := currentPeriod(q.Window, now)
+	scope, _ := queryScope(q)
+	if q.Sort == "rating" {
+		return p, scope, ratingKey
+	}
+	return p, scope, p.key(scope, Sorts[q.Sort])
+}
+
+func (s *redisRanking) Page(ctx context.Context, q Query, limit, offset int) ([]Entry, int64, error) {
+	p, scope, key := s.board(q, time.Now())
+	total, err := s.client.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	members, err := s.client.ZRevRangeWithScores(ctx, key, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := s.entries(ctx, p, scope, key, members)
+	return entries, total, err
+}
+
+func (s *redisRanking) Rank(ctx context.Context, q Query, userID string) (*Entry, error) {
+	p, scope, key := s.board(q, time.Now())
+	score, err := s.client.ZScore(ctx, key, userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.entries(ctx, p, scope, key, []redis.Z{{Score: score, Member: userID}})
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+func (s *redisRanking) Around(ctx context.Context, q Query, userID string, n int) ([]Entry, error) {
+	p, scope, key := s.board(q, time.Now())
+	position, err := s.client.ZRevRank(ctx, key, userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	start := position - int64(n)
+	if start < 0 {
+		start = 0
+	}
+	members, err := s.client.ZRevRangeWithScores(ctx, key, start, position+int64(n)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.entries(ctx, p, scope, key, members)
+}
+
+// entries fills in the stats and rank of members of the sorted set key.
+// Players with equal scores share a rank.
+func (s *redisRanking) entries(ctx context.Context, p period, scope, key string, members []redis.Z) ([]Entry, error) {
+	if len(members) == 0 {
+		return []Entry{}, nil
+	}
+
+	type lookups struct {
+		rank   *redis.IntCmd
+		totals *redis.SliceCmd
+		best   *redis.FloatCmd
+		wins   *redis.FloatCmd
+		userID string
+	}
+	pending := make([]lookups, len(members))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, m := range members {
+			userID := m.Member.(string)
+			pending[i] = lookups{
+				rank:   pipe.ZCount(ctx, key, "("+strconv.FormatFloat(m.Score, 'f', -1, 64), "+inf"),
+				totals: pipe.HMGet(ctx, p.key(scope, "totals"), userID+":races", userID+":wpm", userID+":accuracy"),
+				best:   pipe.ZScore(ctx, p.key(scope, "best_wpm"), userID),
+				wins:   pipe.ZScore(ctx, p.key(scope, "wins"), userID),
+				userID: userID,
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.Member.(string)
+	}
+	var users []models.User
+	if err := s.db.WithContext(ctx).Select("id", "username", "rating").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	entries := make([]Entry, 0, len(members))
+	for _, l := range pending {
+		user, ok := byID[l.userID]
+		if !ok {
+			// Deleted since it was ranked; reconciliation drops it
+			continue
+		}
+		totals := l.totals.Val()
+		races := parseTotal(totals[0])
+		entry := Entry{
+			Rank:     int(l.rank.Val()) + 1,
+			UserID:   l.userID,
+			Username: user.Username,
+			Races:    int(races),
+			BestWPM:  int(l.best.Val()),
+			Wins:     int(l.wins.Val()),
+			Rating:   user.Rating,
+		}
+		if races > 0 {
+			entry.AvgWPM = parseTotal(totals[1]) / races
+			entry.Accuracy = parseTotal(totals[2]) / races
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func parseTotal(v interface{}) float64 {
+	s, _ := v.(string)
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// record adds results to the current period of every window.
+func (s *redisRanking) record(ctx context.Context, results []models.GameResult, now time.Time) error {
+	ranked, err := s.rankable(ctx, results)
+	if err != nil {
+		return err
+	}
+
+	periods := currentPeriods(now)
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, r := range results {
+			if !ranked[r.UserID] || r.Mode == models.ModePractice {
+				continue
+			}
+			win := 0
+			if r.Position == 1 && !r.Mode.IsSolo() {
+				win = 1
+			}
+			for _, p := range periods {
+				var expireAt int64
+				if at := p.expireAt(); !at.IsZero() {
+					expireAt = at.Unix()
+				}
+				for _, scope := range resultScopes(r) {
+					keys := []string{p.key(scope, "totals")}
+					for _, metric := range metrics {
+						keys = append(keys, p.key(scope, metric))
+					}
+					// Eval rather than Run: a pipeline cannot retry a missing script
+					recordScript.Eval(ctx, pipe, keys, r.UserID, r.WPM, r.Accuracy, win, expireAt)
+					pipe.SAdd(ctx, p.scopesKey(), scope)
+					if expireAt > 0 {
+						pipe.ExpireAt(ctx, p.scopesKey(), p.expireAt())
+					}
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// rankable returns which of the results' users may be ranked: registered
+// and not banned.
+func (s *redisRanking) rankable(ctx context.Context, results []models.GameResult) (map[string]bool, error) {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.UserID)
+	}
+	var users []string
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id IN ?", ids).
+		Where("banned_at IS NULL OR banned_until <= ?", time.Now()).
+		Pluck("id", &users).Error
+	if err != nil {
+		return nil, err
+	}
+	ranked := make(map[string]bool, len(users))
+	for _, id := range users {
+		ranked[id] = true
+	}
+	return ranked, nil
+}
+
+func (s *redisRanking) setRating(ctx context.Context, userID string, rating float64) error {
+	return s.client.ZAdd(ctx, ratingKey, &redis.Z{Score: rating, Member: userID}).Err()
+}
+
+func (s *redisRanking) remove(ctx context.Context, userID string, now time.Time) error {
+	for _, p := range currentPeriods(now) {
+		scopes, err := s.client.SMembers(ctx, p.scopesKey()).Result()
+		if err != nil {
+			return err
+		}
+		_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, scope := range scopes {
+				pipe.HDel(ctx, p.key(scope, "totals"), userID+":races", userID+":wpm", userID+":accuracy")
+				for _, metric := range metrics {
+					pipe.ZRem(ctx, p.key(scope, metric), userID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.client.ZRem(ctx, ratingKey, userID).Err()
+}
+
+// totals are a player's aggregated results in one scope.
+type totals struct {
+	races    int64
+	wpm      float64
+	best     float64
+	accuracy float64
+	wins     int64
+}
+
+// reconcile rebuilds the current period of every window from Postgres,
+// unless another replica did so within interval. Results recorded while a
+// period is rebuilt may be missing from it until the next run.
+func (s *redisRanking) reconcile(ctx context.Context, now time.Time, interval time.Duration) error {
+	acquired, err := s.client.SetNX(ctx, reconcileLock, now.Unix(), interval).Result()
+	if err != nil || !acquired {
+		return err
+	}
+
+	for _, p := range currentPeriods(now) {
+		if err := s.rebuild(ctx, p); err != nil {
+			return fmt.Errorf("%s: %w", p.name(), err)
+		}
+	}
+	return s.rebuildRatings(ctx)
+}
+
+// rebuild replaces a period's rankings with ones computed in SQL, swapping
+// in the new keys atomically.
+func (s *redisRanking) rebuild(ctx context.Context, p period) error {
+	var rows []struct {
+		UserID     string
+		Category   string
+		Difficulty string
+		Language   string
+		Mode       models.GameMode
+		Races      int64
+		WPM        float64
+		Best       float64
+		Accuracy   float64
+		Wins       int64
+	}
+	query := s.db.WithContext(ctx).Table("game_results gr").
+		Select(`gr.user_id, gr.category, gr.difficulty, gr.language, gr.mode,
+			COUNT(*) AS races,
+			SUM(gr.wpm) AS wpm,
+			MAX(gr.wpm) AS best,
+			SUM(gr.accuracy) AS accuracy,
+			COUNT(*) FILTER (WHERE gr.position = 1 AND gr.mode <> ?) AS wins`, models.ModeDaily).
+		Joins("JOIN users u ON u.id = gr.user_id").
+		Where("u.banned_at IS NULL OR u.banned_until <= ?", time.Now()).
+		Where("gr.mode <> ?", models.ModePractice)
+	if !p.start.IsZero() {
+		query = query.Where("gr.created_at >= ?", p.start)
+	}
+	err := query.Group("gr.user_id, gr.category, gr.difficulty, gr.language, gr.mode").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	scopes := make(map[string]map[string]*totals)
+	for _, row := range rows {
+		result := models.GameResult{Category: row.Category, Difficulty: row.Difficulty, Language: row.Language, Mode: row.Mode}
+		for _, scope := range resultScopes(result) {
+			players, ok := scopes[scope]
+			if !ok {
+				players = make(map[string]*totals)
+				scopes[scope] = players
+			}
+			t, ok := players[row.UserID]
+			if !ok {
+				t = &totals{}
+				players[row.UserID] = t
+			}
+			t.races += row.Races
+			t.wpm += row.WPM
+			t.accuracy += row.Accuracy
+			t.wins += row.Wins
+			if row.Best > t.best {
+				t.best = row.Best
+			}
+		}
+	}
+
+	// Write the new rankings beside the live ones
+	staging := func(key string) string { return key + ":rebuild" }
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for scope, players := range scopes {
+			fields := make([]interface{}, 0, 6*len(players))
+			sets := make(map[string][]*redis.Z, len(metrics))
+			for userID, t := range players {
+				fields = append(fields, userID+":races", t.races, userID+":wpm", t.wpm, userID+":accuracy", t.accuracy)
+				races := float64(t.races)
+				sets["avg_wpm"] = append(sets["avg_wpm"], &redis.Z{Score: t.wpm / races, Member: userID})
+				sets["best_wpm"] = append(sets["best_wpm"], &redis.Z{Score: t.best, Member: userID})
+				sets["wins"] = append(sets["wins"], &redis.Z{Score: float64(t.wins), Member: userID})
+				sets["accuracy"] = append(sets["accuracy"], &redis.Z{Score: t.accuracy / races, Member: userID})
+			}
+			totalsKey := staging(p.key(scope, "totals"))
+			pipe.Del(ctx, totalsKey)
+			pipe.HSet(ctx, totalsKey, fields...)
+			for _, metric := range metrics {
+				key := staging(p.key(scope, metric))
+				pipe.Del(ctx, key)
+				pipe.ZAdd(ctx, key, sets[metric]...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	old, err := s.client.SMembers(ctx, p.scopesKey()).Result()
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, scope := range old {
+			if _, ok := scopes[scope]; !ok {
+				pipe.Del(ctx, p.key(scope, "totals"))
+				for _, metric := range metrics {
+					pipe.Del(ctx, p.key(scope, metric))
+				}
+			}
+		}
+		pipe.Del(ctx, p.scopesKey())
+		for scope := range scopes {
+			keys := []string{p.key(scope, "totals")}
+			for _, metric := range metrics {
+				keys = append(keys, p.key(scope, metric))
+			}
+			for _, key := range keys {
+				pipe.Rename(ctx, staging(key), key)
+				if at := p.expireAt(); !at.IsZero() {
+					pipe.ExpireAt(ctx, key, at)
+				}
+			}
+			pipe.SAdd(ctx, p.scopesKey(), scope)
+		}
+		if at := p.expireAt(); !at.IsZero() && len(scopes) > 0 {
+			pipe.ExpireAt(ctx, p.scopesKey(), at)
+		}
+		return nil
+	})
+	return err
+}
+
+// rebuildRatings replaces the rating ranking with every player who has a
+// ranked result.
+func (s *redisRanking) rebuildRatings(ctx context.Context) error {
+	var users []models.User
+	err := s.db.WithContext(ctx).Select("id", "rating").
+		Where("banned_at IS NULL OR banned_until <= ?", time.Now()).
+		Where("EXISTS (SELECT 1 FROM game_results gr WHERE gr.user_id = users.id AND gr.mode <> ?)", models.ModePractice).
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	staged := ratingKey + ":rebuild"
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, staged)
+		if len(users) == 0 {
+			pipe.Del(ctx, ratingKey)
+			return nil
+		}
+		members := make([]*redis.Z, len(users))
+		for i, u := range users {
+			members[i] = &redis.Z{Score: u.Rating, Member: u.ID}
+		}
+		pipe.ZAdd(ctx, staged, members...)
+		pipe.Rename(ctx, staged, ratingKey)
+		return nil
+	})
+	return err
+}
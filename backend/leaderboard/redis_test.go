@@ -0,0 +1,138 @@
+package leaderboard
+
+import (
+	"context"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// testStores connects to the Postgres database named by TEST_DATABASE_DSN
+// and the Redis server at TEST_REDIS_ADDR, or skips the test if either is
+// not set.
+func testStores(t *testing.T) (*gorm.DB, *redis.Client) {
+	t.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR is not set")
+	}
+	conn := testDB(t)
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	return conn, client
+}
+
+// TestRedisMatchesSQL records the same results in both stores and checks
+// every sort ranks players alike, both as recorded and after a rebuild.
+func TestRedisMatchesSQL(t *testing.T) {
+	conn, client := testStores(t)
+	ctx := context.Background()
+	l := New(conn, client)
+
+	// A category of its own keeps the rankings apart from other data
+	category := "parity-" + uuid.New().String()[:8]
+	users := make([]models.User, 4)
+	for i := range users {
+		users[i] = models.User{ID: uuid.New().String(), Username: category + "-" + string(rune('a'+i))}
+		if err := conn.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, u := range users {
+			l.Remove(ctx, u.ID)
+			conn.Where("user_id = ?", u.ID).Delete(&models.GameResult{})
+			conn.Delete(&u)
+		}
+	})
+
+	result := func(user models.User, mode models.GameMode, wpm int, accuracy float64, position int) models.GameResult {
+		return models.GameResult{
+			ID: uuid.New().String(), GameID: uuid.New().String(), UserID: user.ID,
+			WPM: wpm, Accuracy: accuracy, Position: position, Mode: mode, Finished: true,
+			Category: category, CreatedAt: time.Now(),
+		}
+	}
+	// a and b tie on average speed and accuracy; c's daily win does not
+	// count; d only practised and is not ranked
+	results := []models.GameResult{
+		result(users[0], models.ModeStandard, 60, 90, 1),
+		result(users[0], models.ModeStandard, 80, 100, 2),
+		result(users[1], models.ModeStandard, 70, 95, 1),
+		result(users[2], models.ModeStandard, 50, 99, 2),
+		result(users[2], models.ModeDaily, 100, 85, 1),
+		result(users[3], models.ModePractice, 120, 100, 1),
+	}
+	if err := conn.Create(&results).Error; err != nil {
+		t.Fatal(err)
+	}
+	l.Record(ctx, results)
+
+	compare := func(t *testing.T) {
+		for _, window := range []string{WindowAll, WindowDay} {
+			for sort := range Sorts {
+				q := Query{Window: window, Category: category, Sort: sort}
+				if !l.redis.serves(q) {
+					continue
+				}
+				fromRedis, redisTotal, err := l.redis.Page(ctx, q, 10, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fromSQL, sqlTotal, err := l.sql.Page(ctx, q, 10, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if redisTotal != 3 || sqlTotal != 3 {
+					t.Errorf("%s %s: Redis ranks %d players and SQL %d, want 3", window, sort, redisTotal, sqlTotal)
+				}
+				bySQL := make(map[string]Entry, len(fromSQL))
+				for _, e := range fromSQL {
+					bySQL[e.UserID] = e
+				}
+				for _, got := range fromRedis {
+					want, ok := bySQL[got.UserID]
+					switch {
+					case !ok:
+						t.Errorf("%s %s: %s is only ranked in Redis", window, sort, got.Username)
+					case got.Rank != want.Rank || got.Races != want.Races || got.BestWPM != want.BestWPM || got.Wins != want.Wins ||
+						math.Abs(got.AvgWPM-want.AvgWPM) > 1e-9 || math.Abs(got.Accuracy-want.Accuracy) > 1e-9:
+						t.Errorf("%s %s: Redis has %+v, SQL %+v", window, sort, got, want)
+					}
+				}
+
+				for _, u := range users {
+					r, err := l.redis.Rank(ctx, q, u.ID)
+					if err != nil {
+						t.Fatal(err)
+					}
+					s, err := l.sql.Rank(ctx, q, u.ID)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if (r == nil) != (s == nil) || (r != nil && r.Rank != s.Rank) {
+						t.Errorf("%s %s: Rank of %s is %+v in Redis and %+v in SQL", window, sort, u.Username, r, s)
+					}
+				}
+			}
+		}
+	}
+
+	t.Run("recorded", compare)
+	for _, window := range []string{WindowAll, WindowDay} {
+		if err := l.redis.rebuild(ctx, currentPeriod(window, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Run("rebuilt", compare)
+}
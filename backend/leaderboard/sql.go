@@ -0,0 +1,114 @@
+package leaderboard
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// sqlRanking aggregates game_results on every query. It answers any query,
+// at the cost of scanning every matching result.
+type sqlRanking struct {
+	db *gorm.DB
+}
+
+func (s *sqlRanking) Page(ctx context.Context, q Query, limit, offset int) ([]Entry, int64, error) {
+	var total int64
+	db := s.db.WithContext(ctx)
+	if err := db.Table("(?) AS stats", s.stats(db, q)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]Entry, 0, limit)
+	err := s.ranked(db, q).Order("rank, user_id").Limit(limit).Offset(offset).Scan(&entries).Error
+	return entries, total, err
+}
+
+func (s *sqlRanking) Rank(ctx context.Context, q Query, userID string) (*Entry, error) {
+	var entries []Entry
+	db := s.db.WithContext(ctx)
+	if err := s.ranked(db, q).Where("user_id = ?", userID).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+func (s *sqlRanking) Around(ctx context.Context, q Query, userID string, n int) ([]Entry, error) {
+	me, err := s.Rank(ctx, q, userID)
+	if err != nil || me == nil {
+		return nil, err
+	}
+
+	// Ties share a rank, so take n either side by position rather than rank
+	var position int
+	db := s.db.WithContext(ctx)
+	err = s.ranked(db, q).Where("rank < ? OR (rank = ? AND user_id < ?)", me.Rank, me.Rank, userID).
+		Select("COUNT(*)").Scan(&position).Error
+	if err != nil {
+		return nil, err
+	}
+	start := position - n
+	if start < 0 {
+		start = 0
+	}
+
+	var entries []Entry
+	err = s.ranked(db, q).Order("rank, user_id").Limit(position - start + n + 1).Offset(start).Scan(&entries).Error
+	return entries, err
+}
+
+// stats aggregates each player's results matching q.
+func (s *sqlRanking) stats(db *gorm.DB, q Query) *gorm.DB {
+	query := db.Table("game_results gr").
+		Select(`gr.user_id, u.username, u.rating,
+			COUNT(*) AS races,
+			AVG(gr.wpm) AS avg_wpm,
+			MAX(gr.wpm) AS best_wpm,
+			AVG(gr.accuracy) AS accuracy,
+			COUNT(*) FILTER (WHERE gr.position = 1 AND gr.mode <> ?) AS wins`, models.ModeDaily).
+		Joins("JOIN users u ON u.id = gr.user_id").
+		Where("u.banned_at IS NULL OR u.banned_until <= ?", time.Now()).
+		// Solo practice drills are always won and would swamp the rankings
+		Where("gr.mode <> ?", models.ModePractice)
+
+	if since := q.Since(time.Now()); !since.IsZero() {
+		query = query.Where("gr.created_at >= ?", since)
+	}
+	if until := q.Until(); !until.IsZero() {
+		query = query.Where("gr.created_at < ?", until)
+	}
+	if q.Category != "" {
+		query = query.Where("gr.category = ?", q.Category)
+	}
+	if q.Difficulty != "" {
+		query = query.Where("gr.difficulty = ?", q.Difficulty)
+	}
+	if q.Language != "" {
+		query = query.Where("gr.language = ?", q.Language)
+	}
+	if q.Mode != "" {
+		query = query.Where("gr.mode = ?", q.Mode)
+	}
+
+	minRaces := q.MinRaces
+	if minRaces < 1 {
+		minRaces = 1
+	}
+	return query.Group("gr.user_id, u.username, u.rating").Having("COUNT(*) >= ?", minRaces)
+}
+
+// ranked numbers the players of stats by the sort column. Ties share a rank.
+func (s *sqlRanking) ranked(db *gorm.DB, q Query) *gorm.DB {
+	column, ok := Sorts[q.Sort]
+	if !ok {
+		column = Sorts["avgWpm"]
+	}
+	return db.Table("(?) AS ranked", db.Table("(?) AS stats", s.stats(db, q)).
+		Select("*, RANK() OVER (ORDER BY "+column+" DESC) AS rank"))
+}
@@ -0,0 +1,33 @@
+// Package mailer sends transactional email such as verification and
+// password reset links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"typerace/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.Driver.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "log", "":
+		return NewLogMailer(cfg.From, cfg.OutboxDir), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
@@ -1,83 +1,178 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 
+	"typerace/achievements"
+	"typerace/auth"
+	"typerace/chat"
+	"typerace/config"
+	"typerace/daily"
 	"typerace/db"
 	"typerace/handlers"
+	"typerace/invitations"
+	"typerace/leaderboard"
+	"typerace/mailer"
 	"typerace/middleware"
+	"typerace/notifications"
+	"typerace/oauth"
+	"typerace/presence"
+	"typerace/ratelimit"
+	"typerace/redis"
+	"typerace/seasons"
+	"typerace/social"
 	"typerace/websocket"
 )
 
 func main() {
-	// Initialize database with auto-migration
-	var database *gorm.DB
-	database, err := db.InitDB()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	// Load configuration from file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if err := middleware.TrustProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	// Initialize database, applying pending migrations
+	database, err := db.InitDB(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	if err := database.PromoteAdmins(cfg.Admin.BootstrapUsers); err != nil {
+		log.Fatalf("Failed to promote bootstrap admins: %v", err)
+	}
+
 	// Initialize Redis
-	redisClient := InitRedis()
+	redisClient := redis.InitRedis(cfg.Redis)
+
+	// Initialize token issuance
+	tokens, err := auth.NewTokenService(cfg.JWT)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	sessions := auth.NewSessionStore(database.DB, cfg.JWT.RefreshTTL)
+	mfa := auth.NewMFA(database.DB, "TypeRacer Elite")
+	lockout := auth.NewLoginLockout(database.DB, cfg.Limits.LoginMaxFailures, cfg.Limits.LoginLockout, cfg.Limits.LoginLockoutMax)
+
+	// Initialize outgoing mail
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
+	// Initialize external login providers
+	providers := oauth.NewRegistry(cfg.OAuth, cfg.Server.PublicURL, &http.Client{Timeout: 10 * time.Second})
 
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
+	hub.MessageLimit = ratelimit.PerMinute(cfg.Limits.WSMessages)
 	go hub.Run()
 
-	// Initialize handlers with database connection
-	gameHandler := handlers.NewGameHandler(hub, database, redisClient)
-	userHandler := handlers.NewUserHandler(database)
-	leaderboardHandler := handlers.NewLeaderboardHandler(database)
-	authHandler := handlers.NewAuthHandler(database)
+	// Initialize leaderboards, rebuilt from stored results in the background
+	boards := leaderboard.New(database.DB, redisClient)
+	go boards.Run(context.Background(), cfg.Leaderboard.ReconcileInterval)
+
+	// Initialize achievements, from the configured rules if any
+	rules, err := achievements.LoadRules(cfg.Achievements.RulesFile)
+	if err != nil {
+		log.Fatalf("Failed to load achievement rules: %v", err)
+	}
+	awards := achievements.New(database.DB, rules)
+
+	// Initialize seasons, archived and reset in the background as they end
+	calendar := seasons.New(database.DB, boards, awards, cfg.Seasons.RatingCarryover)
+	go calendar.Run(context.Background(), cfg.Seasons.CheckInterval)
+
+	// Initialize the daily challenge, rotated in the background at midnight UTC
+	dailies := daily.New(database.DB)
+	go dailies.Run(context.Background())
+
+	// Initialize friends and their presence, kept alive in the background
+	// while users are connected
+	friends := social.New(database.DB)
+	tracker := presence.New(redisClient, hub, friends)
+	go tracker.Run(context.Background())
+
+	// Initialize chat, with history kept in Redis
+	chatService := chat.New(redisClient, database.DB, chat.NewFilter(cfg.Chat.BlockedWords), cfg.Chat.MaxLength, cfg.Chat.History)
+
+	// Initialize notifications, pruned in the background once they expire
+	notifier := notifications.New(database.DB, hub)
+	go notifier.Run(context.Background(), cfg.Notifications.Retention)
+
+	gameHandler := handlers.NewGameHandler(hub, database.DB, redisClient, cfg.CORS, boards, awards, tracker, notifier)
+	userHandler := handlers.NewUserHandler(database.DB, awards)
+	leaderboardHandler := handlers.NewLeaderboardHandler(database.DB, boards, calendar)
+	authHandler := handlers.NewAuthHandler(database, tokens, sessions, mfa, lockout)
+	mfaHandler := handlers.NewMFAHandler(database.DB, mfa)
+	oauthHandler := handlers.NewOAuthHandler(database.DB, authHandler, providers, oauth.NewStateStore(redisClient))
+	accountHandler := handlers.NewAccountHandler(database.DB, mail, sessions, cfg.Server.PublicURL)
+	practiceHandler := handlers.NewPracticeHandler(database.DB, gameHandler)
+	adminHandler := handlers.NewAdminHandler(database.DB, gameHandler, sessions, mfa, dailies, chatService)
+	dailyHandler := handlers.NewDailyHandler(dailies, gameHandler)
+	friendHandler := handlers.NewFriendHandler(database.DB, friends, tracker, gameHandler)
+	invitationHandler := handlers.NewInvitationHandler(database.DB, invitations.New(database.DB), friends, gameHandler)
+	chatHandler := handlers.NewChatHandler(chatService, friends, gameHandler)
+	notificationHandler := handlers.NewNotificationHandler(notifier, tracker)
+	limiter := middleware.NewRateLimiter(ratelimit.NewRedis(redisClient))
+	routes := middleware.NewRoutes(middleware.NewAuth(tokens), middleware.NewAuthorizer(database.DB), limiter)
 
 	// API Routes
 	router := mux.NewRouter()
+	router.HandleFunc("/.well-known/jwks.json", authHandler.JWKS).Methods("GET")
 	api := router.PathPrefix("/api").Subrouter()
-
-	// Auth routes
-	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/register", authHandler.Register).Methods("POST", "OPTIONS")
-	api.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
-	api.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
-	api.HandleFunc("/auth/me", authHandler.GetMe).Methods("GET")
-	api.HandleFunc("/auth/check-username/{username}", authHandler.CheckUsername).Methods("GET")
-
-	// Game routes
-	api.HandleFunc("/games", gameHandler.CreateGame).Methods("POST")
-	api.HandleFunc("/games/{id}", gameHandler.GetGame).Methods("GET")
-	api.HandleFunc("/games/{id}/join", gameHandler.JoinGame).Methods("POST")
-	api.HandleFunc("/ws/{gameId}", gameHandler.HandleWebSocket)
-
-	// New routes
-	api.HandleFunc("/games/{id}/progress", gameHandler.UpdateProgress).Methods("POST")
-	api.HandleFunc("/games/{id}/end", gameHandler.EndGame).Methods("POST")
-	api.HandleFunc("/leaderboard", leaderboardHandler.GetLeaderboard).Methods("GET")
-
-	// User management routes
-	api.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	api.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
-
-	// Protected routes
-	protected := api.PathPrefix("/").Subrouter()
-	protected.Use(middleware.AuthMiddlewareHandler)
-	protected.HandleFunc("/games", gameHandler.CreateGame).Methods("POST")
-	protected.HandleFunc("/games/{id}/join", gameHandler.JoinGame).Methods("POST")
+	api.Use(limiter.Handler("api", ratelimit.PerMinute(cfg.Limits.API)))
+	err = routes.Register(api, apiRoutes(apiHandlers{
+		auth:         authHandler,
+		account:      accountHandler,
+		mfa:          mfaHandler,
+		oauth:        oauthHandler,
+		admin:        adminHandler,
+		game:         gameHandler,
+		practice:     practiceHandler,
+		user:         userHandler,
+		leaderboard:  leaderboardHandler,
+		daily:        dailyHandler,
+		friend:       friendHandler,
+		invitation:   invitationHandler,
+		chat:         chatHandler,
+		notification: notificationHandler,
+	}, cfg.Limits))
+	if err != nil {
+		log.Fatalf("Invalid route table: %v", err)
+	}
+	if err := middleware.CheckDuplicates(router); err != nil {
+		log.Fatalf("Conflicting routes: %v", err)
+	}
 
 	// Wrap router with CORS middleware
-	handler := setupCORS(router)
+	handler := setupCORS(router, cfg.CORS)
 
 	// Start server
-	log.Printf("Server starting on port :8080")
-	log.Fatal(http.ListenAndServe(":8080", handler))
+	log.Printf("Server starting on %s", cfg.Server.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Server.Addr, handler))
 }
 
-func setupCORS(handler http.Handler) http.Handler {
+func setupCORS(handler http.Handler, cors config.CORSConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+		if origin := r.Header.Get("Origin"); cors.AllowsOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		w.Header().Add("Vary", "Origin")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, Authorization")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
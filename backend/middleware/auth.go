@@ -1,13 +1,27 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
+	"typerace/auth"
 )
 
-func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// Auth validates bearer access tokens issued by the token service and puts
+// the caller's Identity in the request context.
+type Auth struct {
+	tokens *auth.TokenService
+}
+
+func NewAuth(tokens *auth.TokenService) *Auth {
+	return &Auth{
+		tokens: tokens,
+	}
+}
+
+// AuthMiddleware rejects requests without a valid access token.
+func (a *Auth) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
@@ -15,27 +29,54 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your-secret-key"), nil // Use env variable in production
-		})
+		id, ok := a.authenticate(w, r, authHeader)
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	}
+}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+// OptionalAuth identifies the caller when an access token is sent and lets
+// anonymous requests through. An invalid token is still rejected, so
+// clients know to refresh it.
+func (a *Auth) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		r.Header.Set("user_id", claims["user_id"].(string))
-		r.Header.Set("username", claims["username"].(string))
+		id, ok := a.authenticate(w, r, authHeader)
+		if !ok {
+			return
+		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
 	}
 }
 
 // Add this function to work with gorilla/mux middleware
-func AuthMiddlewareHandler(next http.Handler) http.Handler {
+func (a *Auth) AuthMiddlewareHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		AuthMiddleware(next.ServeHTTP)(w, r)
+		a.AuthMiddleware(next.ServeHTTP)(w, r)
 	})
 }
+
+func (a *Auth) authenticate(w http.ResponseWriter, r *http.Request, authHeader string) (Identity, bool) {
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	claims, err := a.tokens.Parse(tokenString, auth.TokenAccess)
+	if err != nil {
+		log.Printf("Rejected token from %s: %v", ClientIP(r), err)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return Identity{}, false
+	}
+
+	return Identity{
+		UserID:    claims.UserID(),
+		Username:  claims.Username,
+		SessionID: claims.SessionID,
+	}, true
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"typerace/models"
+)
+
+// Identity is the authenticated caller of a request, set by AuthMiddleware.
+type Identity struct {
+	UserID    string
+	Username  string
+	SessionID string
+	// Role is only set on routes guarded by Authorizer.Require.
+	Role models.Role
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller's identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFrom returns the caller's identity, if the request was
+// authenticated.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// UserID returns the authenticated caller's user ID, or "" for anonymous
+// requests.
+func UserID(r *http.Request) string {
+	id, _ := IdentityFrom(r.Context())
+	return id.UserID
+}
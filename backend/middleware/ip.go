@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies allowed to set X-Forwarded-For.
+var trustedProxies []*net.IPNet
+
+// TrustProxies sets the CIDRs of reverse proxies whose X-Forwarded-For
+// headers ClientIP believes. It is called once at startup.
+func TrustProxies(cidrs []string) error {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+// ClientIP returns the address of the client that sent r. When the request
+// came through trusted proxies, it is the last X-Forwarded-For hop that is
+// not itself a trusted proxy; a header sent by anyone else is ignored, so
+// clients cannot pick their own address to dodge rate limits.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop != "" && !isTrustedProxy(hop) {
+			return hop
+		}
+	}
+	return strings.TrimSpace(hops[0])
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := TrustProxies([]string{"127.0.0.0/8", "10.1.0.0/16"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { TrustProxies(nil) })
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"header from a client", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"header from an untrusted private address", "172.17.0.1:5000", "198.51.100.1", "172.17.0.1"},
+		{"trusted proxy", "127.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"client prepends a hop", "127.0.0.1:5000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "127.0.0.1:5000", "198.51.100.1, 10.1.2.3", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: ClientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
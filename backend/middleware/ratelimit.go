@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"typerace/ratelimit"
+)
+
+// RateLimiter rejects clients that exceed a route's request rate with 429
+// Too Many Requests.
+type RateLimiter struct {
+	limiter ratelimit.Limiter
+}
+
+func NewRateLimiter(limiter ratelimit.Limiter) *RateLimiter {
+	return &RateLimiter{
+		limiter: limiter,
+	}
+}
+
+// Limit allows each client IP limit.Burst requests to next at once,
+// refilled at limit.Rate. Clients are counted separately per name. A
+// disabled limit lets every request through.
+func (rl *RateLimiter) Limit(name string, limit ratelimit.Limit, next http.HandlerFunc) http.HandlerFunc {
+	return rl.limit(name, limit, next, func(r *http.Request) string {
+		return "ip:" + ClientIP(r)
+	})
+}
+
+// LimitUser is Limit counted per user rather than per IP, so users behind a
+// shared address do not exhaust each other's budget. It must be wrapped by
+// AuthMiddleware, which sets the user ID it reads.
+func (rl *RateLimiter) LimitUser(name string, limit ratelimit.Limit, next http.HandlerFunc) http.HandlerFunc {
+	return rl.limit(name, limit, next, func(r *http.Request) string {
+		return "user:" + UserID(r)
+	})
+}
+
+func (rl *RateLimiter) limit(name string, limit ratelimit.Limit, next http.HandlerFunc, client func(*http.Request) string) http.HandlerFunc {
+	if !limit.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := name + ":" + client(r)
+
+		result, err := rl.limiter.Allow(r.Context(), key, limit)
+		if err != nil {
+			// Fail open; an outage of the limiter should not take the API down
+			log.Printf("Rate limiter error for %s: %v", key, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Handler is Limit as gorilla/mux middleware, for limiting whole routers.
+func (rl *RateLimiter) Handler(name string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return rl.Limit(name, limit, next.ServeHTTP)
+	}
+}
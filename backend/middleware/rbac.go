@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"typerace/models"
+)
+
+// Authorizer checks the caller's role against the permission a route
+// requires. Roles are read from the database on every request, so role
+// changes and bans apply immediately rather than when tokens expire.
+type Authorizer struct {
+	db *gorm.DB
+}
+
+func NewAuthorizer(db *gorm.DB) *Authorizer {
+	return &Authorizer{
+		db: db,
+	}
+}
+
+// Require runs next only for callers granted perm. It must be wrapped by
+// AuthMiddleware, which identifies the caller. The caller's role is added
+// to their Identity.
+func (z *Authorizer) Require(perm models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFrom(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		userID := id.UserID
+
+		var user models.User
+		if err := z.db.Select("id", "role", "banned_at", "banned_until").First(&user, "id = ?", userID).Error; err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !user.Can(perm) {
+			log.Printf("Denied %s to user %s (%s) from %s", perm, userID, user.Role, ClientIP(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		id.Role = user.Role
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+	}
+}
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"typerace/models"
+	"typerace/ratelimit"
+)
+
+// Access is who may call a route.
+type Access int
+
+const (
+	// Public routes are open to anyone and never see an Identity.
+	Public Access = iota
+	// Optional routes identify callers that send an access token and
+	// serve anonymous callers too.
+	Optional
+	// Authenticated routes require a valid access token.
+	Authenticated
+	// Authorized routes require a valid access token and a role granted
+	// the route's Permission.
+	Authorized
+)
+
+func (a Access) String() string {
+	switch a {
+	case Public:
+		return "public"
+	case Optional:
+		return "optional"
+	case Authenticated:
+		return "authenticated"
+	case Authorized:
+		return "authorized"
+	}
+	return fmt.Sprintf("Access(%d)", int(a))
+}
+
+// Route is one entry of a route table.
+type Route struct {
+	// Method is the HTTP method; empty matches any method, as needed for
+	// websocket upgrades.
+	Method string
+	Path   string
+	Access Access
+	// Permission is required for Authorized routes.
+	Permission models.Permission
+	// RateLimit names the bucket the route is counted against, if any.
+	// Routes sharing a name share a budget.
+	RateLimit string
+	Limit     ratelimit.Limit
+	Handler   http.HandlerFunc
+	// PerUser counts the rate limit per user rather than per IP. It needs
+	// an authenticated route.
+	PerUser bool
+}
+
+// Routes registers route tables, wrapping each handler in the rate limit,
+// authentication and authorization its entry asks for.
+type Routes struct {
+	auth       *Auth
+	authorizer *Authorizer
+	limiter    *RateLimiter
+}
+
+func NewRoutes(auth *Auth, authorizer *Authorizer, limiter *RateLimiter) *Routes {
+	return &Routes{
+		auth:       auth,
+		authorizer: authorizer,
+		limiter:    limiter,
+	}
+}
+
+// Register adds table to router. Entries are checked before anything is
+// registered, so a bad table leaves router untouched.
+func (rs *Routes) Register(router *mux.Router, table []Route) error {
+	var errs []error
+	for _, route := range table {
+		if err := route.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, route := range table {
+		r := router.HandleFunc(route.Path, rs.wrap(route))
+		if route.Method != "" {
+			r.Methods(route.Method)
+		}
+	}
+	return nil
+}
+
+func (rs *Routes) wrap(route Route) http.HandlerFunc {
+	h := route.Handler
+	// Per-user limits need the identity, so they run after authentication
+	if route.RateLimit != "" && route.PerUser {
+		h = rs.limiter.LimitUser(route.RateLimit, route.Limit, h)
+	}
+	switch route.Access {
+	case Optional:
+		h = rs.auth.OptionalAuth(h)
+	case Authenticated:
+		h = rs.auth.AuthMiddleware(h)
+	case Authorized:
+		h = rs.auth.AuthMiddleware(rs.authorizer.Require(route.Permission, h))
+	}
+	// Per-IP limits run first so that rejected credentials count too
+	if route.RateLimit != "" && !route.PerUser {
+		h = rs.limiter.Limit(route.RateLimit, route.Limit, h)
+	}
+	return h
+}
+
+func (route Route) validate() error {
+	name := route.Method + " " + route.Path
+	switch {
+	case route.Path == "":
+		return fmt.Errorf("route %q: missing path", name)
+	case route.Handler == nil:
+		return fmt.Errorf("route %q: missing handler", name)
+	case route.Access < Public || route.Access > Authorized:
+		return fmt.Errorf("route %q: unknown access %s", name, route.Access)
+	case route.Access == Authorized && route.Permission == "":
+		return fmt.Errorf("route %q: authorized route needs a permission", name)
+	case route.Access != Authorized && route.Permission != "":
+		return fmt.Errorf("route %q: permission %s is only checked on authorized routes", name, route.Permission)
+	case route.PerUser && route.RateLimit == "":
+		return fmt.Errorf("route %q: per-user limit without a rate limit", name)
+	case route.PerUser && route.Access < Authenticated:
+		return fmt.Errorf("route %q: per-user limit on %s route", name, route.Access)
+	}
+	return nil
+}
+
+// pathVariable matches a mux path variable with an optional pattern.
+var pathVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// CheckDuplicates reports routes of router that would shadow each other:
+// the same method and path, where paths differing only in the names of
+// their variables are the same. Routes without a method clash with every
+// route of that path. mux silently serves the first match, so a duplicate
+// with weaker protection would otherwise go unnoticed.
+func CheckDuplicates(router *mux.Router) error {
+	seen := make(map[string][]string)
+	var errs []error
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			// Subrouter prefixes and other routes without a full path
+			return nil
+		}
+		if route.GetHandler() == nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{""}
+		}
+
+		path := pathVariable.ReplaceAllString(tmpl, "{}")
+		for _, method := range methods {
+			for _, prev := range seen[path] {
+				if prev == "" || method == "" || prev == method {
+					errs = append(errs, fmt.Errorf("duplicate route %s", strings.TrimSpace(method+" "+tmpl)))
+				}
+			}
+			seen[path] = append(seen[path], method)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
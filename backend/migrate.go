@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"typerace/config"
+	"typerace/db"
+)
+
+const migrateUsage = `usage:
+  main migrate [config flags] up
+  main migrate [config flags] down [steps]
+  main migrate [config flags] status
+  main migrate create [-dir path] <name>`
+
+// runMigrate implements the migrate subcommand. args follow "migrate".
+func runMigrate(args []string) {
+	// create only writes files, so it needs no configuration
+	if len(args) > 0 && args[0] == "create" {
+		createMigration(args[1:])
+		return
+	}
+
+	// Only the database settings are needed to migrate
+	dbConfig, rest, err := config.ParseDatabase(args)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(rest) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	database, err := db.Open(dbConfig)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	migrator, err := db.NewMigrator(sqlDB)
+	if err != nil {
+		log.Fatalf("Invalid migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch rest[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		log.Printf("Applied %d migrations", applied)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "down":
+		steps := 1
+		if len(rest) > 1 {
+			steps, err = strconv.Atoi(rest[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid step count %q", rest[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		log.Printf("Reverted %d migrations", reverted)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
+
+func createMigration(args []string) {
+	fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+	dir := fs.String("dir", "db/migrations", "directory of the migration files")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	up, down, err := db.CreateMigration(*dir, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to create migration: %v", err)
+	}
+	fmt.Println(up)
+	fmt.Println(down)
+}
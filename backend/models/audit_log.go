@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records an action taken through the admin API.
+type AuditLog struct {
+	ID         string `json:"id" gorm:"primaryKey"`
+	ActorID    string `json:"actorId" gorm:"index;not null"`
+	ActorRole  Role   `json:"actorRole" gorm:"type:varchar(16)"`
+	Action     string `json:"action" gorm:"type:varchar(64);index;not null"`
+	TargetType string `json:"targetType" gorm:"type:varchar(32)"`
+	TargetID   string `json:"targetId" gorm:"index"`
+	// Details is a JSON object describing the change.
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+}
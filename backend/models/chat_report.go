@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ChatReport is a player's report of a chat message for moderators to
+// review. The message is copied, as chat history expires.
+type ChatReport struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	Room       string     `json:"room"`
+	MessageID  string     `json:"messageId" gorm:"uniqueIndex:idx_chat_reports_message_reporter"`
+	ReporterID string     `json:"reporterId" gorm:"uniqueIndex:idx_chat_reports_message_reporter"`
+	UserID     string     `json:"userId" gorm:"index"`
+	Username   string     `json:"username"`
+	Text       string     `json:"text"`
+	Reason     string     `json:"reason"`
+	ResolvedBy string     `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
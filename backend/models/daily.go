@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// DailyChallenge is the passage everyone races on one UTC day, named by
+// its date as YYYY-MM-DD.
+type DailyChallenge struct {
+	Date      string `json:"date" gorm:"primaryKey;type:varchar(10)"`
+	PassageID string `json:"passageId" gorm:"not null"`
+	// Curated is set when an organizer chose the passage rather than the
+	// scheduler.
+	Curated   bool      `json:"curated"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DailyAttempt is a user's one ranked attempt at a daily challenge. Its
+// result is the GameResult of the attempt's game.
+type DailyAttempt struct {
+	Date      string    `json:"date" gorm:"primaryKey;type:varchar(10)"`
+	UserID    string    `json:"userId" gorm:"primaryKey"`
+	GameID    string    `json:"gameId"`
+	StartedAt time.Time `json:"startedAt"`
+}
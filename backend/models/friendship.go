@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// FriendStatus is the state of one user's edge to another.
+type FriendStatus string
+
+const (
+	// FriendPending is a request from UserID awaiting FriendID's answer.
+	FriendPending FriendStatus = "pending"
+	// FriendAccepted is stored in both directions once a request is
+	// accepted.
+	FriendAccepted FriendStatus = "accepted"
+	// FriendBlocked is stored only for the user who blocked.
+	FriendBlocked FriendStatus = "blocked"
+)
+
+// Friendship is a directed edge of the social graph from UserID to
+// FriendID.
+type Friendship struct {
+	UserID    string       `json:"userId" gorm:"primaryKey"`
+	FriendID  string       `json:"friendId" gorm:"primaryKey"`
+	Status    FriendStatus `json:"status" gorm:"type:varchar(16);not null"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -17,6 +18,12 @@ const (
 	Finished GameStatus = "finished"
 )
 
+var (
+	ErrGameFull      = errors.New("game is full")
+	ErrGameStarted   = errors.New("game has already started")
+	ErrAlreadyJoined = errors.New("already joined this game")
+)
+
 type Game struct {
 	ID           uuid.UUID   `gorm:"type:uuid;primary_key;"`
 	Status       GameStatus  `gorm:"type:varchar(20);not null"`
@@ -26,12 +33,34 @@ type Game struct {
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 	Mu           sync.Mutex
-	Category     string `json:"category"`
-	Difficulty   string `json:"difficulty"`
-	IsPrivate    bool   `json:"isPrivate"`
-	Password     string `json:"-"`
-	CreatedBy    string `json:"createdBy"`
-	TournamentID string `json:"tournamentId,omitempty"`
+	Category     string      `json:"category"`
+	Difficulty   string      `json:"difficulty"`
+	IsPrivate    bool        `json:"isPrivate"`
+	Password     string      `json:"-"`
+	CreatedBy    string      `json:"createdBy"`
+	TournamentID string      `json:"tournamentId,omitempty"`
+	Mode         GameMode    `json:"mode" gorm:"type:varchar(20);default:'standard'"`
+	Duration     int         `json:"duration,omitempty"`
+	WordCount    int         `json:"wordCount,omitempty"`
+	StartedAt    time.Time   `json:"startedAt"`
+	SessionID    string      `json:"sessionId,omitempty"`
+	Round        int         `json:"round,omitempty"`
+	PassageID    string      `json:"passageId,omitempty"`
+	PassageHash  string      `json:"passageHash,omitempty"`
+	PassageType  PassageType `json:"passageType" gorm:"type:varchar(20);default:'prose'"`
+	CodeLanguage string      `json:"codeLanguage,omitempty"`
+	Language     string      `json:"language" gorm:"type:varchar(16);default:'en'"`
+	Challenge    string      `json:"challenge,omitempty"`
+	Unranked     bool        `json:"unranked,omitempty"`
+	Standings    []Standing  `json:"standings,omitempty" gorm:"-"`
+	// InvitationID is set on the private game of an invitation. Only
+	// Invitees may join a private game; it starts once all of its
+	// Participants have joined.
+	InvitationID string   `json:"invitationId,omitempty"`
+	Invitees     []string `json:"invitees,omitempty" gorm:"-"`
+	Participants []string `json:"participants,omitempty" gorm:"-"`
+
+	generatedWords int
 }
 
 type Player struct {
@@ -43,6 +72,12 @@ type Player struct {
 	WPM      int       `gorm:"default:0"`
 	Accuracy float64   `gorm:"default:0"`
 	Avatar   string    `json:"avatar"`
+
+	CorrectWords int       `json:"correctWords"`
+	FinishedAt   time.Time `json:"finishedAt"`
+	// Measured is set while the player's figures are computed by the
+	// server from their typed input rather than reported by the client.
+	Measured bool `json:"-" gorm:"-"`
 }
 
 type GameEvent struct {
@@ -66,30 +101,127 @@ func NewGame(id string, text string) *Game {
 		return nil
 	}
 	return &Game{
-		ID:      uuid,
-		Status:  Waiting,
-		Text:    text,
-		Players: make([]Player, 0),
+		ID:          uuid,
+		Status:      Waiting,
+		Mode:        ModeStandard,
+		PassageType: PassageProse,
+		Language:    "en",
+		Text:        text,
+		Players:     make([]Player, 0),
 	}
 }
 
-func (g *Game) AddPlayer(player *Player) bool {
+// AddPlayer adds a player to a waiting game. Each user may join once.
+func (g *Game) AddPlayer(player *Player) error {
 	g.Mu.Lock()
 	defer g.Mu.Unlock()
 
+	if g.Status != Waiting {
+		return ErrGameStarted
+	}
+	for _, p := range g.Players {
+		if p.UserID == player.UserID {
+			return ErrAlreadyJoined
+		}
+	}
 	if len(g.Players) >= 4 {
-		return false
+		return ErrGameFull
 	}
 
 	g.Players = append(g.Players, *player)
+	return nil
+}
+
+// HasPlayer reports whether the user has joined the game.
+func (g *Game) HasPlayer(userID string) bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	for _, p := range g.Players {
+		if p.UserID.String() == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Invite lets a user join a private game.
+func (g *Game) Invite(userID string) {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+	g.Invitees = append(g.Invitees, userID)
+}
+
+// Invited reports whether the user may join the game.
+func (g *Game) Invited(userID string) bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	if !g.IsPrivate {
+		return true
+	}
+	for _, id := range g.Invitees {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Expect sets the users a private game waits for before it starts. They
+// must still be invited to join.
+func (g *Game) Expect(userIDs ...string) {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+	g.Participants = append(g.Participants, userIDs...)
+}
+
+// ParticipantsJoined reports whether every participant a private game
+// waits for has joined it.
+func (g *Game) ParticipantsJoined() bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	if !g.IsPrivate || len(g.Participants) == 0 {
+		return false
+	}
+	for _, id := range g.Participants {
+		joined := false
+		for _, p := range g.Players {
+			if p.UserID.String() == id {
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			return false
+		}
+	}
+	return true
+}
+
+// TryStart starts the game if it is still waiting and reports whether it
+// did, so that concurrent starts begin the race only once.
+func (g *Game) TryStart() bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	if g.Status != Waiting {
+		return false
+	}
+	g.start()
 	return true
 }
 
 func (g *Game) Start() {
 	g.Mu.Lock()
 	defer g.Mu.Unlock()
+	g.start()
+}
 
+func (g *Game) start() {
 	now := time.Now()
 	g.CreatedAt = now
+	g.StartedAt = now
 	g.Status = Playing
 }
@@ -5,11 +5,24 @@ import (
 )
 
 type GameResult struct {
-	ID        string    `json:"id" gorm:"primaryKey"`
-	GameID    string    `json:"game_id"`
-	UserID    string    `json:"user_id"`
-	WPM       int       `json:"wpm"`
-	Accuracy  float64   `json:"accuracy"`
-	Position  int       `json:"position"`
+	ID         string   `json:"id" gorm:"primaryKey"`
+	GameID     string   `json:"game_id"`
+	UserID     string   `json:"user_id"`
+	WPM        int      `json:"wpm"`
+	Accuracy   float64  `json:"accuracy"`
+	Position   int      `json:"position"`
+	Mode       GameMode `json:"mode"`
+	CorrectWPM float64  `json:"correct_wpm"`
+	Finished   bool     `json:"finished"`
+	// Category, Difficulty, Language and the passage are copied from the
+	// game so that leaderboards can be filtered without the game itself
+	// being stored.
+	Category    string `json:"category,omitempty"`
+	Difficulty  string `json:"difficulty,omitempty"`
+	Language    string `json:"language,omitempty"`
+	PassageHash string `json:"passage_hash,omitempty"`
+	PassageID   string `json:"passage_id,omitempty"`
+	// Record marks a result that set the fastest speed on its passage.
+	Record    bool      `json:"record"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending   InvitationStatus = "pending"
+	InvitationAccepted  InvitationStatus = "accepted"
+	InvitationDeclined  InvitationStatus = "declined"
+	InvitationCancelled InvitationStatus = "cancelled"
+	InvitationExpired   InvitationStatus = "expired"
+)
+
+// Invitation is a challenge from one user to another to race in a private
+// game set up for the two of them.
+type Invitation struct {
+	ID           string           `json:"id" gorm:"primaryKey"`
+	ChallengerID string           `json:"challengerId" gorm:"not null;index"`
+	OpponentID   string           `json:"opponentId" gorm:"not null;index"`
+	GameID       string           `json:"gameId"`
+	Mode         GameMode         `json:"mode" gorm:"type:varchar(20)"`
+	PassageID    string           `json:"passageId,omitempty"`
+	Status       InvitationStatus `json:"status" gorm:"type:varchar(16);not null"`
+	// A pending invitation expires at ExpiresAt if it is not answered.
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
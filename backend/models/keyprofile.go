@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// KeyStat is a user's cumulative latency and error statistics for one key,
+// collected across all of their races.
+type KeyStat struct {
+	UserID         string    `json:"-" gorm:"primaryKey"`
+	Key            string    `json:"key" gorm:"primaryKey"`
+	Presses        int       `json:"presses"`
+	Errors         int       `json:"errors"`
+	TotalLatencyMs int64     `json:"totalLatencyMs"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// BigramStat is a user's cumulative statistics for one pair of consecutive
+// keys.
+type BigramStat struct {
+	UserID         string    `json:"-" gorm:"primaryKey"`
+	Bigram         string    `json:"bigram" gorm:"primaryKey"`
+	Presses        int       `json:"presses"`
+	Errors         int       `json:"errors"`
+	TotalLatencyMs int64     `json:"totalLatencyMs"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"typerace/typing"
+)
+
+type GameMode string
+
+const (
+	// ModeStandard races over a fixed Game.Text and ranks by finish order.
+	ModeStandard GameMode = "standard"
+	// ModeTime races for a fixed duration over an endless word stream.
+	ModeTime GameMode = "time"
+	// ModeWords races over a fixed number of generated words.
+	ModeWords GameMode = "words"
+	// ModeElimination is a round of an elimination session; it is created
+	// through the session API rather than as a standalone game.
+	ModeElimination GameMode = "elimination"
+	// ModePractice is a solo drill generated from the player's typing
+	// profile; it is created through the practice API.
+	ModePractice GameMode = "practice"
+	// ModeDaily is a solo attempt at the daily challenge passage; it is
+	// created through the daily challenge API.
+	ModeDaily GameMode = "daily"
+)
+
+// TimeAttackDurations are the allowed race lengths, in seconds, for ModeTime.
+var TimeAttackDurations = []int{15, 30, 60, 120}
+
+const (
+	// initialStreamWords is how many words a generated race starts with.
+	initialStreamWords = 50
+	// chunkWords is how many words are appended each time the stream is extended.
+	chunkWords = 25
+	// chunkThreshold is how close, in characters, a player must get to the end
+	// of the text before another chunk is streamed.
+	chunkThreshold = 60
+	// maxWordCount bounds the length of a word-count race.
+	maxWordCount = 500
+)
+
+// Valid reports whether the mode can be used for a standalone game.
+func (m GameMode) Valid() bool {
+	switch m {
+	case ModeStandard, ModeTime, ModeWords:
+		return true
+	}
+	return false
+}
+
+// IsSolo reports whether games of the mode have a single player, who
+// always places first, so they never count as wins.
+func (m GameMode) IsSolo() bool {
+	return m == ModePractice || m == ModeDaily
+}
+
+// IsGenerated reports whether the mode races over a generated word stream
+// rather than a fixed passage.
+func (m GameMode) IsGenerated() bool {
+	return m == ModeTime || m == ModeWords
+}
+
+// NewModeGame creates a game for a generated-text mode. duration applies to
+// ModeTime and wordCount to ModeWords.
+func NewModeGame(id string, mode GameMode, duration, wordCount int) (*Game, error) {
+	var words int
+	switch mode {
+	case ModeTime:
+		valid := false
+		for _, d := range TimeAttackDurations {
+			if d == duration {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("duration must be one of %v seconds", TimeAttackDurations)
+		}
+		words = initialStreamWords
+	case ModeWords:
+		if wordCount <= 0 || wordCount > maxWordCount {
+			return nil, fmt.Errorf("word count must be between 1 and %d", maxWordCount)
+		}
+		words = min(wordCount, initialStreamWords)
+	default:
+		return nil, fmt.Errorf("mode %q does not use generated text", mode)
+	}
+
+	game := NewGame(id, GenerateText(words))
+	if game == nil {
+		return nil, fmt.Errorf("invalid game ID %s", id)
+	}
+	game.Mode = mode
+	game.Duration = duration
+	game.WordCount = wordCount
+	game.generatedWords = words
+	return game, nil
+}
+
+// NextChunk extends the text of a generated-mode game when a player has typed
+// up to within chunkThreshold characters of its end. position and the
+// returned offset, where the chunk starts, count grapheme clusters. It
+// returns the appended chunk, including its leading separator, and false
+// when nothing was added.
+func (g *Game) NextChunk(position int) (int, string, bool) {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	if !g.Mode.IsGenerated() || g.Status == Finished {
+		return 0, "", false
+	}
+	offset := typing.GraphemeCount(g.Text)
+	if offset-position > chunkThreshold {
+		return 0, "", false
+	}
+
+	words := chunkWords
+	if g.Mode == ModeWords {
+		words = min(words, g.WordCount-g.generatedWords)
+	}
+	if words <= 0 {
+		return 0, "", false
+	}
+
+	chunk := " " + GenerateText(words)
+	g.Text += chunk
+	g.generatedWords += words
+	return offset, chunk, true
+}
+
+// Elapsed returns how long the game has been running, capped at the race
+// duration for time-attack games.
+func (g *Game) Elapsed(now time.Time) time.Duration {
+	if g.StartedAt.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(g.StartedAt)
+	if g.Mode == ModeTime {
+		elapsed = min(elapsed, time.Duration(g.Duration)*time.Second)
+	}
+	return elapsed
+}
+
+// Standing is a player's final placement in a game.
+type Standing struct {
+	Position   int     `json:"position"`
+	UserID     string  `json:"userId"`
+	Name       string  `json:"name"`
+	WPM        int     `json:"wpm"`
+	CorrectWPM float64 `json:"correctWpm"`
+	Accuracy   float64 `json:"accuracy"`
+	Progress   float64 `json:"progress"`
+	Finished   bool    `json:"finished"`
+	// Measured is set if the speed was computed by the server.
+	Measured bool `json:"-"`
+}
+
+// CorrectWPM returns the player's correct words per minute over the race.
+func (g *Game) CorrectWPM(p *Player, now time.Time) float64 {
+	elapsed := g.Elapsed(now)
+	if !p.FinishedAt.IsZero() && g.Mode != ModeTime {
+		elapsed = p.FinishedAt.Sub(g.StartedAt)
+	}
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.CorrectWords) / elapsed.Minutes()
+}
+
+// Rank ranks the players of the game. Standard races are ranked by
+// finish order, generated-text races by correct words per minute.
+func (g *Game) Rank(now time.Time) []Standing {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	players := make([]*Player, len(g.Players))
+	for i := range g.Players {
+		players[i] = &g.Players[i]
+	}
+
+	if g.Mode.IsGenerated() {
+		sort.SliceStable(players, func(i, j int) bool {
+			return g.CorrectWPM(players[i], now) > g.CorrectWPM(players[j], now)
+		})
+	} else {
+		sort.SliceStable(players, func(i, j int) bool {
+			a, b := players[i], players[j]
+			if a.FinishedAt.IsZero() != b.FinishedAt.IsZero() {
+				return !a.FinishedAt.IsZero()
+			}
+			if !a.FinishedAt.IsZero() {
+				return a.FinishedAt.Before(b.FinishedAt)
+			}
+			if a.Progress != b.Progress {
+				return a.Progress > b.Progress
+			}
+			return a.WPM > b.WPM
+		})
+	}
+
+	standings := make([]Standing, len(players))
+	for i, p := range players {
+		standings[i] = Standing{
+			Position:   i + 1,
+			UserID:     p.UserID.String(),
+			Name:       p.Name,
+			WPM:        p.WPM,
+			CorrectWPM: g.CorrectWPM(p, now),
+			Accuracy:   p.Accuracy,
+			Progress:   p.Progress,
+			Finished:   !p.FinishedAt.IsZero() || g.Mode == ModeTime,
+			Measured:   p.Measured,
+		}
+	}
+	return standings
+}
+
+// PlayerFinished reports whether the player with the given user ID has
+// finished the race.
+func (g *Game) PlayerFinished(userID string) bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	for _, p := range g.Players {
+		if strings.EqualFold(p.UserID.String(), userID) {
+			return !p.FinishedAt.IsZero()
+		}
+	}
+	return false
+}
+
+// UpdatePlayer records a progress report for the player with the given user
+// ID and returns false if no such player has joined the game. measured
+// tells whether the figures were computed by the server.
+func (g *Game) UpdatePlayer(userID string, progress float64, wpm int, accuracy float64, correctWords int, measured bool) bool {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	for i := range g.Players {
+		p := &g.Players[i]
+		if !strings.EqualFold(p.UserID.String(), userID) {
+			continue
+		}
+		p.Progress = progress
+		p.WPM = wpm
+		p.Accuracy = accuracy
+		p.CorrectWords = correctWords
+		p.Measured = measured
+		if p.FinishedAt.IsZero() && g.playerDone(p) {
+			p.FinishedAt = time.Now()
+		}
+		return true
+	}
+	return false
+}
+
+// Unfinished counts the players who have not finished the race.
+func (g *Game) Unfinished() int {
+	g.Mu.Lock()
+	defer g.Mu.Unlock()
+
+	n := 0
+	for i := range g.Players {
+		if g.Players[i].FinishedAt.IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *Game) playerDone(p *Player) bool {
+	switch g.Mode {
+	case ModeTime:
+		return false
+	case ModeWords:
+		return p.CorrectWords >= g.WordCount || p.Progress >= 1
+	default:
+		return p.Progress >= 1
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationFriendRequest  NotificationType = "friend_request"
+	NotificationFriendAccepted NotificationType = "friend_accepted"
+	NotificationRaceInvitation NotificationType = "race_invitation"
+	NotificationAchievement    NotificationType = "achievement_unlocked"
+	NotificationRoundStart     NotificationType = "round_start"
+)
+
+// Notification is an event kept for a user in their notification center
+// until it is read or expires.
+type Notification struct {
+	ID     string           `json:"id" gorm:"primaryKey"`
+	UserID string           `json:"userId" gorm:"index:idx_notifications_user_created;not null"`
+	Type   NotificationType `json:"type" gorm:"type:varchar(32);not null"`
+	// Data is a JSON object describing the event.
+	Data      string     `json:"data,omitempty"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"index:idx_notifications_user_created"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+type PassageType string
+
+const (
+	PassageProse PassageType = "prose"
+	PassageCode  PassageType = "code"
+)
+
+// Passage is a stored race text. Language is the BCP 47 tag of the natural
+// language the text is written in; code passages additionally carry a
+// language tag that selects how whitespace and brackets are compared.
+type Passage struct {
+	ID           string      `json:"id" gorm:"primaryKey"`
+	Type         PassageType `json:"type" gorm:"type:varchar(20);not null;default:'prose';index"`
+	CodeLanguage string      `json:"codeLanguage,omitempty" gorm:"index"`
+	Language     string      `json:"language" gorm:"type:varchar(16);not null;default:'en';index"`
+	Title        string      `json:"title"`
+	Source       string      `json:"source,omitempty"`
+	Text         string      `json:"text" gorm:"not null"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+func (t PassageType) Valid() bool {
+	return t == PassageProse || t == PassageCode
+}
+
+// PassageHash identifies a race text, so results on the same text can be
+// compared whether it came from a stored passage or was typed in. Line
+// endings and surrounding whitespace are ignored.
+func PassageHash(text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
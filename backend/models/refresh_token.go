@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a stored, hashed refresh token. Tokens issued by rotating
+// one another share a FamilyID, which identifies a login session.
+type RefreshToken struct {
+	ID           string     `json:"id" gorm:"primaryKey"`
+	UserID       string     `json:"userId" gorm:"index;not null"`
+	FamilyID     string     `json:"familyId" gorm:"index;not null"`
+	TokenHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	UserAgent    string     `json:"userAgent"`
+	IP           string     `json:"ip"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+	ReplacedByID string     `json:"-"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// Active reports whether the token can still be exchanged.
+func (t *RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && t.ReplacedByID == "" && now.Before(t.ExpiresAt)
+}
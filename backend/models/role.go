@@ -0,0 +1,87 @@
+package models
+
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleOrganizer Role = "organizer"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action on the admin API that a role may be granted.
+type Permission string
+
+const (
+	PermViewUsers         Permission = "users:view"
+	PermBanUsers          Permission = "users:ban"
+	PermManageUsers       Permission = "users:manage"
+	PermManageGames       Permission = "games:manage"
+	PermManagePassages    Permission = "passages:manage"
+	PermManageTournaments Permission = "tournaments:manage"
+	PermManageSeasons     Permission = "seasons:manage"
+	PermModerateChat      Permission = "chat:moderate"
+	PermViewAudit         Permission = "audit:view"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RolePlayer: nil,
+	RoleOrganizer: {
+		PermManageGames,
+		PermManagePassages,
+		PermManageTournaments,
+		PermManageSeasons,
+	},
+	RoleModerator: {
+		PermViewUsers,
+		PermBanUsers,
+		PermManageGames,
+		PermModerateChat,
+	},
+	RoleAdmin: {
+		PermViewUsers,
+		PermBanUsers,
+		PermManageUsers,
+		PermManageGames,
+		PermManagePassages,
+		PermManageTournaments,
+		PermManageSeasons,
+		PermModerateChat,
+		PermViewAudit,
+	},
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission. Unknown roles grant
+// nothing.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Rank orders roles by privilege. Moderation actions only apply to users of
+// a lower rank.
+func (r Role) Rank() int {
+	switch r {
+	case RoleOrganizer:
+		return 1
+	case RoleModerator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Permissions lists what the role grants.
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
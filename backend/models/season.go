@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// Season is a competitive period. Ratings carry over between seasons with
+// a soft reset, and each season's final standings are archived when it
+// ends.
+type Season struct {
+	ID       string    `json:"id" gorm:"primaryKey"`
+	Name     string    `json:"name" gorm:"not null"`
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+	// ArchivedAt is set once the final standings are stored and ratings
+	// reset; the season can no longer be changed.
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// Running reports whether the season is in progress at the given time.
+func (s *Season) Running(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Overlaps reports whether the two seasons share any time.
+func (s *Season) Overlaps(other *Season) bool {
+	return s.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(s.EndsAt)
+}
+
+// SeasonStanding is a player's final place in an archived season, ranked
+// by rating.
+type SeasonStanding struct {
+	SeasonID  string    `json:"seasonId" gorm:"primaryKey"`
+	UserID    string    `json:"userId" gorm:"primaryKey"`
+	Username  string    `json:"username"`
+	Rank      int       `json:"rank"`
+	Rating    float64   `json:"rating"`
+	Races     int       `json:"races"`
+	Wins      int       `json:"wins"`
+	AvgWPM    float64   `json:"avgWpm" gorm:"column:avg_wpm"`
+	BestWPM   int       `json:"bestWpm" gorm:"column:best_wpm"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeasonSchedule(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	season := Season{StartsAt: day(10), EndsAt: day(20)}
+
+	running := []struct {
+		at   time.Time
+		want bool
+	}{
+		{day(9), false},
+		{day(10), true},
+		{day(15), true},
+		{day(20), false},
+	}
+	for _, tt := range running {
+		if got := season.Running(tt.at); got != tt.want {
+			t.Errorf("Running(%s) = %v, want %v", tt.at.Format("Jan 2"), got, tt.want)
+		}
+	}
+
+	overlaps := []struct {
+		name  string
+		other Season
+		want  bool
+	}{
+		{"before", Season{StartsAt: day(1), EndsAt: day(10)}, false},
+		{"after", Season{StartsAt: day(20), EndsAt: day(30)}, false},
+		{"straddling the start", Season{StartsAt: day(5), EndsAt: day(11)}, true},
+		{"inside", Season{StartsAt: day(12), EndsAt: day(13)}, true},
+		{"around", Season{StartsAt: day(1), EndsAt: day(30)}, true},
+	}
+	for _, tt := range overlaps {
+		if got := season.Overlaps(&tt.other); got != tt.want {
+			t.Errorf("%s: Overlaps = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
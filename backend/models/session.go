@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type SessionStatus string
+
+const (
+	SessionWaiting  SessionStatus = "waiting"
+	SessionActive   SessionStatus = "active"
+	SessionFinished SessionStatus = "finished"
+)
+
+// MaxSessionPlayers bounds the size of an elimination lobby.
+const MaxSessionPlayers = 16
+
+var (
+	ErrSessionFull    = errors.New("session is full")
+	ErrSessionStarted = errors.New("session has already started")
+	ErrSessionJoined  = errors.New("already joined this session")
+)
+
+// Session is a persistent lobby that plays a sequence of games. In an
+// elimination session the slowest player of each round is knocked out until
+// a single winner remains.
+type Session struct {
+	ID         string        `json:"id"`
+	Mode       GameMode      `json:"mode"`
+	Status     SessionStatus `json:"status"`
+	Round      int           `json:"round"`
+	GameID     string        `json:"gameId,omitempty"`
+	Players    []Player      `json:"players"`
+	Eliminated []Placement   `json:"eliminated"`
+	CreatedBy  string        `json:"createdBy"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Mu         sync.Mutex    `json:"-"`
+}
+
+// Placement is a player's final position in an elimination session.
+type Placement struct {
+	ID              string    `json:"id" gorm:"primaryKey"`
+	SessionID       string    `json:"sessionId" gorm:"index"`
+	UserID          string    `json:"userId" gorm:"index"`
+	Name            string    `json:"name"`
+	Placement       int       `json:"placement"`
+	EliminatedRound int       `json:"eliminatedRound"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func NewSession(id string, mode GameMode, createdBy string) *Session {
+	return &Session{
+		ID:         id,
+		Mode:       mode,
+		Status:     SessionWaiting,
+		Players:    make([]Player, 0),
+		Eliminated: make([]Placement, 0),
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// AddPlayer adds a player to a waiting session. Each user may join once.
+func (s *Session) AddPlayer(player *Player) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	if s.Status != SessionWaiting {
+		return ErrSessionStarted
+	}
+	for _, p := range s.Players {
+		if p.UserID == player.UserID {
+			return ErrSessionJoined
+		}
+	}
+	if len(s.Players) >= MaxSessionPlayers {
+		return ErrSessionFull
+	}
+
+	s.Players = append(s.Players, *player)
+	return nil
+}
+
+// Eliminate removes the slowest remaining player according to the round's
+// standings and returns their placement. It returns false when the standings
+// do not name any remaining player.
+func (s *Session) Eliminate(standings []Standing) (Placement, bool) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	for i := len(standings) - 1; i >= 0; i-- {
+		for j, p := range s.Players {
+			if p.UserID.String() != standings[i].UserID {
+				continue
+			}
+			placement := Placement{
+				SessionID:       s.ID,
+				UserID:          standings[i].UserID,
+				Name:            p.Name,
+				Placement:       len(s.Players),
+				EliminatedRound: s.Round,
+			}
+			s.Players = append(s.Players[:j], s.Players[j+1:]...)
+			s.Eliminated = append(s.Eliminated, placement)
+			return placement, true
+		}
+	}
+	return Placement{}, false
+}
+
+// Placements returns the final placements of a finished session, winner
+// first.
+func (s *Session) Placements() []Placement {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	placements := make([]Placement, 0, len(s.Players)+len(s.Eliminated))
+	for _, p := range s.Players {
+		placements = append(placements, Placement{
+			SessionID:       s.ID,
+			UserID:          p.UserID.String(),
+			Name:            p.Name,
+			Placement:       1,
+			EliminatedRound: s.Round,
+		})
+	}
+	for i := len(s.Eliminated) - 1; i >= 0; i-- {
+		placements = append(placements, s.Eliminated[i])
+	}
+	return placements
+}
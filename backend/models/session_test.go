@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionAddPlayer(t *testing.T) {
+	s := NewSession(uuid.New().String(), ModeElimination, "creator")
+	first := Player{ID: uuid.New(), UserID: uuid.New()}
+	if err := s.AddPlayer(&first); err != nil {
+		t.Fatal(err)
+	}
+
+	again := Player{ID: uuid.New(), UserID: first.UserID}
+	if err := s.AddPlayer(&again); !errors.Is(err, ErrSessionJoined) {
+		t.Errorf("second join of a user = %v, want ErrSessionJoined", err)
+	}
+	for len(s.Players) < MaxSessionPlayers {
+		s.Players = append(s.Players, Player{ID: uuid.New(), UserID: uuid.New()})
+	}
+	if err := s.AddPlayer(&Player{ID: uuid.New(), UserID: uuid.New()}); !errors.Is(err, ErrSessionFull) {
+		t.Errorf("join of a full session = %v, want ErrSessionFull", err)
+	}
+	s.Status = SessionActive
+	if err := s.AddPlayer(&Player{ID: uuid.New(), UserID: uuid.New()}); !errors.Is(err, ErrSessionStarted) {
+		t.Errorf("join of a running session = %v, want ErrSessionStarted", err)
+	}
+}
@@ -1,26 +1,41 @@
 package models
 
 import (
-    "time"
+	"time"
 )
 
+type TournamentStatus string
+
+const (
+	TournamentPending   TournamentStatus = "pending"
+	TournamentActive    TournamentStatus = "active"
+	TournamentCompleted TournamentStatus = "completed"
+)
+
+func (s TournamentStatus) Valid() bool {
+	return s == TournamentPending || s == TournamentActive || s == TournamentCompleted
+}
+
 type Tournament struct {
-    ID          string    `json:"id"`
-    Name        string    `json:"name"`
-    Description string    `json:"description"`
-    StartTime   time.Time `json:"startTime"`
-    EndTime     time.Time `json:"endTime"`
-    MaxPlayers  int       `json:"maxPlayers"`
-    Status      string    `json:"status"` // pending, active, completed
-    Rounds      []*Round  `json:"rounds"`
+	ID          string           `json:"id" gorm:"primaryKey"`
+	Name        string           `json:"name" gorm:"not null"`
+	Description string           `json:"description"`
+	StartTime   time.Time        `json:"startTime"`
+	EndTime     time.Time        `json:"endTime"`
+	MaxPlayers  int              `json:"maxPlayers"`
+	Status      TournamentStatus `json:"status" gorm:"type:varchar(20);default:'pending'"`
+	Rounds      []*Round         `json:"rounds" gorm:"-"`
+	CreatedBy   string           `json:"createdBy"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
 }
 
 type Round struct {
-    ID            string    `json:"id"`
-    TournamentID  string    `json:"tournamentId"`
-    RoundNumber   int       `json:"roundNumber"`
-    StartTime     time.Time `json:"startTime"`
-    EndTime       time.Time `json:"endTime"`
-    Participants  []*User   `json:"participants"`
-    Games         []*Game   `json:"games"`
-}
\ No newline at end of file
+	ID           string    `json:"id"`
+	TournamentID string    `json:"tournamentId"`
+	RoundNumber  int       `json:"roundNumber"`
+	StartTime    time.Time `json:"startTime"`
+	EndTime      time.Time `json:"endTime"`
+	Participants []*User   `json:"participants"`
+	Games        []*Game   `json:"games"`
+}
@@ -4,21 +4,57 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID           string    `json:"id" gorm:"primaryKey"`
-	Username     string    `json:"username" gorm:"unique"`
-	Email        string    `gorm:"unique;default:null"`
-	PasswordHash string    `json:"-"`
-	Avatar       string    `json:"avatar"`
-	TotalRaces   int       `json:"totalRaces" gorm:"default:0"`
-	AverageWPM   float64   `json:"averageWpm" gorm:"default:0"`
-	BestWPM      float64   `json:"bestWpm" gorm:"default:0"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              string     `json:"id" gorm:"primaryKey"`
+	Username        string     `json:"username" gorm:"unique"`
+	Email           string     `gorm:"unique;default:null"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	PasswordHash    string     `json:"-"`
+	Avatar          string     `json:"avatar"`
+	TotalRaces      int        `json:"totalRaces" gorm:"default:0"`
+	AverageWPM      float64    `json:"averageWpm" gorm:"default:0"`
+	BestWPM         float64    `json:"bestWpm" gorm:"default:0"`
+	Rating          float64    `json:"rating" gorm:"default:1500"`
+	Role            Role       `json:"role" gorm:"type:varchar(16);default:'player'"`
+	// A ban ends at BannedUntil, or never if it is nil.
+	BannedAt    *time.Time `json:"bannedAt,omitempty"`
+	BannedUntil *time.Time `json:"bannedUntil,omitempty"`
+	BanReason   string     `json:"banReason,omitempty"`
+	// ChatMutedUntil stops the user posting chat messages until then.
+	ChatMutedUntil *time.Time `json:"chatMutedUntil,omitempty"`
+	// TOTPSecret is set on enrollment; two-factor login is only required
+	// once TOTPEnabledAt is set by confirming a code.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totpEnabledAt,omitempty"`
+	// TOTPLastStep is the time step of the last accepted code, so a code
+	// cannot be used twice.
+	TOTPLastStep   int64      `json:"-"`
+	MFAFailures    int        `json:"-" gorm:"default:0"`
+	MFALockedUntil *time.Time `json:"-"`
+	// LoginFailures counts wrong passwords since the last successful login.
+	LoginFailures    int        `json:"-" gorm:"default:0"`
+	LoginLockedUntil *time.Time `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Banned reports whether the user is banned at the given time.
+func (u *User) Banned(now time.Time) bool {
+	return u.BannedAt != nil && (u.BannedUntil == nil || now.Before(*u.BannedUntil))
+}
+
+// Can reports whether the user's role grants the permission. Banned users
+// have no permissions.
+func (u *User) Can(p Permission) bool {
+	return !u.Banned(time.Now()) && u.Role.Can(p)
+}
+
+// TwoFactorEnabled reports whether logging in requires a TOTP code.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
@@ -39,10 +75,12 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Achievement is a badge unlocked by a user. Type names the rule that
+// awarded it; a user holds each type at most once.
 type Achievement struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;"`
-	UserID      uuid.UUID `gorm:"type:uuid;"`
-	Type        string    `json:"type"`
+	ID          string    `json:"id" gorm:"primaryKey"`
+	UserID      string    `json:"userId" gorm:"uniqueIndex:idx_achievements_user_type"`
+	Type        string    `json:"type" gorm:"uniqueIndex:idx_achievements_user_type"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	UnlockedAt  time.Time `json:"unlockedAt"`
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external login provider.
+type UserIdentity struct {
+	ID       string `json:"id" gorm:"primaryKey"`
+	UserID   string `json:"userId" gorm:"index;not null"`
+	Provider string `json:"provider" gorm:"type:varchar(32);not null;uniqueIndex:idx_identity_subject"`
+	// Subject is the provider's stable account ID.
+	Subject   string    `json:"-" gorm:"not null;uniqueIndex:idx_identity_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+type UserTokenPurpose string
+
+const (
+	PurposeVerifyEmail   UserTokenPurpose = "verify_email"
+	PurposePasswordReset UserTokenPurpose = "password_reset"
+)
+
+// UserToken is a hashed single-use token sent to a user by email.
+type UserToken struct {
+	ID        string           `json:"id" gorm:"primaryKey"`
+	UserID    string           `json:"userId" gorm:"index;not null"`
+	Purpose   UserTokenPurpose `json:"purpose" gorm:"type:varchar(32);not null;index"`
+	TokenHash string           `json:"-" gorm:"uniqueIndex;not null"`
+	// Email is the address the token was sent to.
+	Email     string     `json:"email"`
+	IP        string     `json:"ip" gorm:"index"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"index"`
+}
@@ -0,0 +1,168 @@
+// Package notifications keeps each user's notification center: friend
+// requests, race invitations, achievement unlocks and round starts. Every
+// notification is stored until it expires and pushed as it happens to the
+// user's websocket connections and event streams on this server.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"typerace/models"
+	"typerace/websocket"
+)
+
+// pruneInterval is how often expired notifications are deleted.
+const pruneInterval = time.Hour
+
+// streamBuffer is how many notifications an event stream may fall behind
+// by before further ones are dropped for it.
+const streamBuffer = 16
+
+var ErrNotFound = errors.New("notification not found")
+
+type Service struct {
+	db  *gorm.DB
+	hub *websocket.Hub
+
+	mu      sync.Mutex
+	streams map[string]map[chan models.Notification]bool
+}
+
+func New(db *gorm.DB, hub *websocket.Hub) *Service {
+	return &Service{
+		db:      db,
+		hub:     hub,
+		streams: make(map[string]map[chan models.Notification]bool),
+	}
+}
+
+// Notify stores a notification of the given type for userID, with data
+// describing the event, and delivers it to the user's open connections.
+func (s *Service) Notify(ctx context.Context, userID string, kind models.NotificationType, data interface{}) (*models.Notification, error) {
+	n := models.Notification{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Type:      kind,
+		CreatedAt: time.Now(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		n.Data = string(raw)
+	}
+	if err := s.db.WithContext(ctx).Create(&n).Error; err != nil {
+		return nil, err
+	}
+
+	s.hub.SendToUser(userID, websocket.Message{Type: "notification", Data: n})
+	s.mu.Lock()
+	for stream := range s.streams[userID] {
+		select {
+		case stream <- n:
+		default:
+		}
+	}
+	s.mu.Unlock()
+	return &n, nil
+}
+
+// List returns a page of a user's notifications, newest first, and how
+// many there are. Only unread notifications are listed if unread is set.
+func (s *Service) List(ctx context.Context, userID string, unread bool, limit, offset int) ([]models.Notification, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unread {
+		query = query.Where("read_at IS NULL")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	notifications := make([]models.Notification, 0, limit)
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&notifications).Error
+	return notifications, total, err
+}
+
+// Unread counts a user's unread notifications.
+func (s *Service) Unread(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks one of a user's notifications read, returning ErrNotFound
+// if they have no such notification.
+func (s *Service) MarkRead(ctx context.Context, userID, id string) (*models.Notification, error) {
+	var n models.Notification
+	db := s.db.WithContext(ctx)
+	if err := db.First(&n, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if n.ReadAt != nil {
+		return &n, nil
+	}
+	now := time.Now()
+	n.ReadAt = &now
+	err := db.Model(&n).Update("read_at", n.ReadAt).Error
+	return &n, err
+}
+
+// MarkAllRead marks all of a user's notifications read and returns how
+// many were unread.
+func (s *Service) MarkAllRead(ctx context.Context, userID string) (int64, error) {
+	res := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// Subscribe opens an event stream of a user's new notifications. The
+// returned function closes it.
+func (s *Service) Subscribe(userID string) (<-chan models.Notification, func()) {
+	stream := make(chan models.Notification, streamBuffer)
+	s.mu.Lock()
+	if s.streams[userID] == nil {
+		s.streams[userID] = make(map[chan models.Notification]bool)
+	}
+	s.streams[userID][stream] = true
+	s.mu.Unlock()
+
+	return stream, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.streams[userID], stream)
+		if len(s.streams[userID]) == 0 {
+			delete(s.streams, userID)
+		}
+	}
+}
+
+// Run deletes notifications older than retention until ctx is cancelled.
+func (s *Service) Run(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		err := s.db.WithContext(ctx).Where("created_at < ?", time.Now().Add(-retention)).
+			Delete(&models.Notification{}).Error
+		if err != nil {
+			log.Printf("Error pruning notifications: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
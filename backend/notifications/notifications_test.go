@@ -0,0 +1,119 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+	"typerace/websocket"
+)
+
+func TestSubscribe(t *testing.T) {
+	s := New(nil, websocket.NewHub())
+	_, closeFirst := s.Subscribe("user")
+	_, closeSecond := s.Subscribe("user")
+	if got := len(s.streams["user"]); got != 2 {
+		t.Fatalf("%d streams open, want 2", got)
+	}
+	closeFirst()
+	if got := len(s.streams["user"]); got != 1 {
+		t.Errorf("%d streams open after closing one, want 1", got)
+	}
+	closeSecond()
+	if _, ok := s.streams["user"]; ok {
+		t.Error("user still has streams after closing them all")
+	}
+}
+
+// TestReadState needs the Postgres database named by TEST_DATABASE_DSN.
+func TestReadState(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	users := make([]models.User, 2)
+	for i := range users {
+		users[i] = models.User{ID: uuid.New().String(), Username: "notify-" + uuid.New().String()[:8]}
+		if err := conn.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner, other := users[0].ID, users[1].ID
+	t.Cleanup(func() {
+		conn.Where("user_id IN ?", []string{owner, other}).Delete(&models.Notification{})
+		for _, u := range users {
+			conn.Delete(&u)
+		}
+	})
+
+	ctx := context.Background()
+	s := New(conn, websocket.NewHub())
+	stream, closeStream := s.Subscribe(owner)
+	defer closeStream()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		n, err := s.Notify(ctx, owner, models.NotificationFriendRequest, map[string]string{"from": other})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, n.ID)
+		if got := <-stream; got.ID != n.ID {
+			t.Errorf("stream delivered %s, want %s", got.ID, n.ID)
+		}
+	}
+	unread := func(want int64) {
+		t.Helper()
+		if got, err := s.Unread(ctx, owner); err != nil || got != want {
+			t.Errorf("Unread = %d, %v, want %d", got, err, want)
+		}
+	}
+	unread(3)
+
+	if _, err := s.MarkRead(ctx, other, ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MarkRead of another user's notification = %v, want ErrNotFound", err)
+	}
+	first, err := s.MarkRead(ctx, owner, ids[0])
+	if err != nil || first.ReadAt == nil {
+		t.Fatalf("MarkRead = %+v, %v", first, err)
+	}
+	again, err := s.MarkRead(ctx, owner, ids[0])
+	if err != nil || !again.ReadAt.Equal(*first.ReadAt) {
+		t.Errorf("MarkRead again moved read_at from %v to %v (%v)", first.ReadAt, again.ReadAt, err)
+	}
+	unread(2)
+
+	list, total, err := s.List(ctx, owner, true, 10, 0)
+	if err != nil || total != 2 || len(list) != 2 {
+		t.Fatalf("List unread = %d of %d, %v, want 2 of 2", len(list), total, err)
+	}
+	if list[0].ID != ids[2] {
+		t.Errorf("List starts with %s, want the newest %s", list[0].ID, ids[2])
+	}
+	if _, total, _ := s.List(ctx, owner, false, 10, 0); total != 3 {
+		t.Errorf("List all = %d, want 3", total)
+	}
+
+	if n, err := s.MarkAllRead(ctx, owner); err != nil || n != 2 {
+		t.Errorf("MarkAllRead = %d, %v, want 2", n, err)
+	}
+	if n, err := s.MarkAllRead(ctx, owner); err != nil || n != 0 {
+		t.Errorf("MarkAllRead again = %d, %v, want 0", n, err)
+	}
+	unread(0)
+}
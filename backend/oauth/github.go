@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// GitHub logs in with GitHub's OAuth apps, which do not support OpenID
+// Connect. The identity comes from the REST API instead of an ID token.
+type GitHub struct {
+	client       *http.Client
+	clientID     string
+	clientSecret string
+	redirectURL  string
+
+	// The endpoints default to github.com and can point at GitHub
+	// Enterprise or a test server.
+	AuthURL  string
+	TokenURL string
+	APIURL   string
+}
+
+func NewGitHub(client *http.Client, clientID, clientSecret, redirectURL string) *GitHub {
+	return &GitHub{
+		client:       client,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		APIURL:       "https://api.github.com",
+	}
+}
+
+func (p *GitHub) Name() string {
+	return "github"
+}
+
+func (p *GitHub) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	return authCodeURL(p.AuthURL, p.clientID, p.redirectURL, []string{"read:user", "user:email"},
+		state, codeChallenge, nil)
+}
+
+func (p *GitHub) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := exchangeCode(ctx, p.client, p.TokenURL, p.clientID, p.clientSecret, p.redirectURL, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := getJSON(ctx, p.client, p.APIURL+"/user", token.AccessToken, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("github user has no id")
+	}
+
+	identity := &Identity{
+		Provider: p.Name(),
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Username: user.Login,
+		Name:     user.Name,
+	}
+
+	// The profile email may be unverified, so use the verified primary
+	// address from the emails API
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client, p.APIURL+"/user/emails", token.AccessToken, &emails); err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			identity.Email = e.Email
+			identity.EmailVerified = true
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,224 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"typerace/auth"
+)
+
+// jwksRefreshInterval limits how often an unknown kid triggers a JWKS
+// refetch, so forged tokens cannot make us hammer the provider.
+const jwksRefreshInterval = time.Minute
+
+type OIDCOptions struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDC is a generic OpenID Connect provider. Its endpoints are found through
+// discovery on first use and ID tokens are verified against its JWKS.
+type OIDC struct {
+	client *http.Client
+	opts   OIDCOptions
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDC(client *http.Client, opts OIDCOptions) *OIDC {
+	return &OIDC{
+		client: client,
+		opts:   opts,
+	}
+}
+
+func (p *OIDC) Name() string {
+	return p.opts.Name
+}
+
+func (p *OIDC) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return authCodeURL(doc.AuthorizationEndpoint, p.opts.ClientID, p.opts.RedirectURL, p.opts.Scopes,
+		state, codeChallenge, url.Values{"nonce": {nonce}})
+}
+
+func (p *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := exchangeCode(ctx, p.client, doc.TokenEndpoint, p.opts.ClientID, p.opts.ClientSecret, p.opts.RedirectURL, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, doc, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	// Providers may leave profile claims out of the ID token
+	if claims.Email == "" && doc.UserinfoEndpoint != "" {
+		var info userinfoResponse
+		if err := getJSON(ctx, p.client, doc.UserinfoEndpoint, token.AccessToken, &info); err != nil {
+			return nil, err
+		}
+		if info.Subject != claims.Subject {
+			return nil, errors.New("userinfo subject does not match id_token")
+		}
+		claims.profileClaims = info.profileClaims
+	}
+
+	return &Identity{
+		Provider:      p.opts.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Username:      claims.PreferredUsername,
+		Name:          claims.Name,
+	}, nil
+}
+
+// profileClaims are the standard claims shared by ID tokens and the
+// userinfo endpoint.
+type profileClaims struct {
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+type idTokenClaims struct {
+	profileClaims
+	Nonce string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+type userinfoResponse struct {
+	Subject string `json:"sub"`
+	profileClaims
+}
+
+// flexBool accepts booleans sent as JSON strings, which some providers do
+// for email_verified.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	*b = flexBool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+func (p *OIDC) verifyIDToken(ctx context.Context, doc *discoveryDocument, raw string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, doc, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.opts.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid id_token: missing subject")
+	}
+	return claims, nil
+}
+
+// key returns the provider's verification key with the given kid, fetching
+// the JWKS again if the provider has rotated its keys.
+func (p *OIDC) key(ctx context.Context, doc *discoveryDocument, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	var set auth.JWKSet
+	if err := getJSON(ctx, p.client, doc.JWKSURI, "", &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip key types we cannot verify with
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// discover fetches and caches the provider metadata.
+func (p *OIDC) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	issuer := strings.TrimRight(p.opts.Issuer, "/")
+	var doc discoveryDocument
+	if err := getJSON(ctx, p.client, issuer+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, fmt.Errorf("%s discovery: %w", p.opts.Name, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%s discovery: issuer %q does not match %q", p.opts.Name, doc.Issuer, p.opts.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("%s discovery: missing endpoints", p.opts.Name)
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
@@ -0,0 +1,433 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"typerace/auth"
+)
+
+const (
+	testClientID     = "typerace"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://typerace.test/oauth/callback/test"
+)
+
+// mockOIDC is an OpenID Connect provider serving discovery, JWKS,
+// authorization code and userinfo endpoints.
+type mockOIDC struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu    sync.Mutex
+	kid   string
+	key   ed25519.PrivateKey
+	codes map[string]url.Values
+	// issuer, if set, is advertised by discovery instead of the server URL.
+	issuer string
+	// claims edits the claims of each ID token before it is signed.
+	claims func(jwt.MapClaims)
+	// signWith, if set, signs ID tokens instead of key, as kid.
+	signWith ed25519.PrivateKey
+	userinfo map[string]interface{}
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	m := &mockOIDC{t: t, codes: make(map[string]url.Values)}
+	m.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	mux.HandleFunc("/userinfo", m.userinfoEndpoint)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDC) provider() *OIDC {
+	return NewOIDC(m.server.Client(), OIDCOptions{
+		Name:         "test",
+		Issuer:       m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"openid", "email"},
+	})
+}
+
+// rotate replaces the signing key.
+func (m *mockOIDC) rotate(kid string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kid, m.key = kid, key
+}
+
+// approve stands in for the user consenting at authURL and returns the code
+// the provider redirects back with.
+func (m *mockOIDC) approve(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code := "code-" + u.Query().Get("state")
+	m.codes[code] = u.Query()
+	return code
+}
+
+func (m *mockOIDC) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := m.issuer
+	if issuer == "" {
+		issuer = m.server.URL
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": m.server.URL + "/authorize",
+		"token_endpoint":         m.server.URL + "/token",
+		"userinfo_endpoint":      m.server.URL + "/userinfo",
+		"jwks_uri":               m.server.URL + "/jwks",
+	})
+}
+
+func (m *mockOIDC) jwks(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	json.NewEncoder(w).Encode(auth.JWKSet{Keys: []auth.JWK{{
+		Kty: "OKP",
+		Kid: m.kid,
+		Use: "sig",
+		Alg: "EdDSA",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(m.key.Public().(ed25519.PublicKey)),
+	}}})
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ParseForm()
+	authorized, ok := m.codes[r.PostForm.Get("code")]
+	switch {
+	case !ok,
+		r.PostForm.Get("grant_type") != "authorization_code",
+		r.PostForm.Get("client_id") != testClientID,
+		r.PostForm.Get("client_secret") != testClientSecret,
+		r.PostForm.Get("redirect_uri") != authorized.Get("redirect_uri"),
+		Challenge(r.PostForm.Get("code_verifier")) != authorized.Get("code_challenge"):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	delete(m.codes, r.PostForm.Get("code"))
+
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          authorized.Get("nonce"),
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada",
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = m.kid
+	key := m.key
+	if m.signWith != nil {
+		key = m.signWith
+	}
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockOIDC) userinfoEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	json.NewEncoder(w).Encode(m.userinfo)
+}
+
+// login runs the authorization code flow against p and returns the
+// identity, using verifier at the token endpoint unless it is empty.
+func login(t *testing.T, m *mockOIDC, p *OIDC, verifier string) (*Identity, error) {
+	t.Helper()
+	ctx := context.Background()
+	realVerifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier == "" {
+		verifier = realVerifier
+	}
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", Challenge(realVerifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	return p.Exchange(ctx, m.approve(authURL), verifier, "nonce")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Errorf("AuthCodeURL = %s, want the discovered endpoint", authURL)
+	}
+	q, _ := url.Parse(authURL)
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if got := q.Query().Get(k); got != v {
+			t.Errorf("AuthCodeURL %s = %q, want %q", k, got, v)
+		}
+	}
+
+	identity, err := login(t, m, p, "")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	wantIdentity := Identity{
+		Provider:      "test",
+		Subject:       "user-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Name:          "Ada",
+	}
+	if *identity != wantIdentity {
+		t.Errorf("Exchange = %+v, want %+v", *identity, wantIdentity)
+	}
+}
+
+func TestOIDCPKCE(t *testing.T) {
+	m := newMockOIDC(t)
+	wrong, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := login(t, m, m.provider(), wrong); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Exchange with the wrong verifier = %v, want invalid_grant", err)
+	}
+}
+
+func TestOIDCNonce(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+	verifier, _ := NewVerifier()
+	authURL, err := p.AuthCodeURL(context.Background(), "state", "nonce", Challenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Exchange(context.Background(), m.approve(authURL), verifier, "other-nonce")
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("Exchange with another login's nonce = %v, want a nonce mismatch", err)
+	}
+}
+
+func TestOIDCRejectsIDToken(t *testing.T) {
+	_, foreign, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		claims   func(jwt.MapClaims)
+		signWith ed25519.PrivateKey
+	}{
+		{name: "issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }},
+		{name: "audience", claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "signature", signWith: foreign},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockOIDC(t)
+			m.claims, m.signWith = tt.claims, tt.signWith
+			if identity, err := login(t, m, m.provider(), ""); err == nil {
+				t.Errorf("Exchange = %+v, want an invalid id_token", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockOIDC(t)
+	m.issuer = "https://evil.test"
+	if _, err := m.provider().AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Error("AuthCodeURL succeeded with a discovery document for another issuer")
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	m := newMockOIDC(t)
+	p := m.provider()
+	if _, err := login(t, m, p, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new kid is only fetched once the refresh interval has passed
+	m.rotate("key-2")
+	if _, err := login(t, m, p, ""); err == nil {
+		t.Error("Exchange refetched the JWKS within the refresh interval")
+	}
+	p.mu.Lock()
+	p.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	p.mu.Unlock()
+	if _, err := login(t, m, p, ""); err != nil {
+		t.Errorf("Exchange after rotation: %v", err)
+	}
+}
+
+func TestOIDCUserinfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		userinfo map[string]interface{}
+		want     *Identity
+	}{
+		{
+			name:     "verified as string",
+			userinfo: map[string]interface{}{"sub": "user-1", "email": "ada@example.com", "email_verified": "true"},
+			want:     &Identity{Provider: "test", Subject: "user-1", Email: "ada@example.com", EmailVerified: true},
+		},
+		{
+			name:     "unverified",
+			userinfo: map[string]interface{}{"sub": "user-1", "email": "ada@example.com", "email_verified": false},
+			want:     &Identity{Provider: "test", Subject: "user-1", Email: "ada@example.com"},
+		},
+		{
+			name:     "other subject",
+			userinfo: map[string]interface{}{"sub": "user-2", "email": "ada@example.com", "email_verified": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockOIDC(t)
+			m.claims = func(c jwt.MapClaims) {
+				delete(c, "email")
+				delete(c, "email_verified")
+				delete(c, "name")
+			}
+			m.userinfo = tt.userinfo
+			identity, err := login(t, m, m.provider(), "")
+			switch {
+			case tt.want == nil && err == nil:
+				t.Errorf("Exchange = %+v, want a subject mismatch", identity)
+			case tt.want != nil && err != nil:
+				t.Errorf("Exchange: %v", err)
+			case tt.want != nil && *identity != *tt.want:
+				t.Errorf("Exchange = %+v, want %+v", *identity, *tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		emails string
+		want   Identity
+	}{
+		{
+			name:   "verified primary",
+			emails: `[{"email":"old@example.com","verified":true},{"email":"ada@example.com","primary":true,"verified":true}]`,
+			want:   Identity{Provider: "github", Subject: "42", Username: "ada", Email: "ada@example.com", EmailVerified: true},
+		},
+		{
+			name:   "unverified primary",
+			emails: `[{"email":"ada@example.com","primary":true},{"email":"old@example.com","verified":true}]`,
+			want:   Identity{Provider: "github", Subject: "42", Username: "ada"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var challenge string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				if Challenge(r.PostForm.Get("code_verifier")) != challenge {
+					json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]string{"access_token": "access-token"})
+			})
+			mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"id":42,"login":"ada","email":"unverified@example.com"}`))
+			})
+			mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.emails))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			p := NewGitHub(server.Client(), testClientID, testClientSecret, testRedirectURL)
+			p.TokenURL, p.APIURL = server.URL+"/token", server.URL
+			verifier, _ := NewVerifier()
+			authURL, err := p.AuthCodeURL(context.Background(), "state", "", Challenge(verifier))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := url.Parse(authURL)
+			challenge = u.Query().Get("code_challenge")
+
+			identity, err := p.Exchange(context.Background(), "code", verifier, "")
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if *identity != tt.want {
+				t.Errorf("Exchange = %+v, want %+v", *identity, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("Challenge = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+// Package oauth implements login through external OAuth2 and OpenID Connect
+// providers using the authorization code flow with PKCE.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"typerace/config"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrInvalidState    = errors.New("invalid or expired login state")
+)
+
+// Identity is the account a provider vouches for.
+type Identity struct {
+	Provider string
+	// Subject is the provider's stable ID for the account.
+	Subject string
+	Email   string
+	// EmailVerified is true only if the provider has verified Email.
+	EmailVerified bool
+	// Username is the provider's handle for the account, if it has one.
+	Username string
+	Name     string
+}
+
+// Provider is an external identity provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the provider URL the user is sent to for consent.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems an authorization code and returns the verified
+	// identity. nonce is checked against the ID token when there is one.
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry sets up every provider enabled in cfg. Callbacks are sent to
+// the frontend at <publicURL>/oauth/callback/<provider>, which passes the
+// code on to the API.
+func NewRegistry(cfg config.OAuthConfig, publicURL string, client *http.Client) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	callback := func(name string) string {
+		return strings.TrimRight(publicURL, "/") + "/oauth/callback/" + name
+	}
+
+	if cfg.GitHubClientID != "" {
+		r.Add(NewGitHub(client, cfg.GitHubClientID, cfg.GitHubClientSecret, callback("github")))
+	}
+	if cfg.GoogleClientID != "" {
+		r.Add(NewOIDC(client, OIDCOptions{
+			Name:         "google",
+			Issuer:       "https://accounts.google.com",
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  callback("google"),
+			Scopes:       []string{"openid", "email", "profile"},
+		}))
+	}
+	if cfg.OIDCClientID != "" {
+		r.Add(NewOIDC(client, OIDCOptions{
+			Name:         cfg.OIDCName,
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  callback(cfg.OIDCName),
+			Scopes:       cfg.OIDCScopes,
+		}))
+	}
+	return r
+}
+
+// Add registers a provider, replacing any with the same name.
+func (r *Registry) Add(p Provider) {
+	r.providers[p.Name()] = p
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names lists the configured providers in order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewVerifier returns a PKCE code verifier.
+func NewVerifier() (string, error) {
+	return randomString()
+}
+
+// Challenge returns the S256 PKCE challenge for a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// authCodeURL builds an authorization request URL.
+func authCodeURL(endpoint, clientID, redirectURL string, scopes []string, state, codeChallenge string, extra url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", clientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	for k, v := range extra {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint.
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL, clientID, clientSecret, redirectURL, code, verifier string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	status, err := doJSON(client, req, &token)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	// Some providers report errors with a 200 status
+	if token.Error != "" {
+		return nil, fmt.Errorf("token exchange: %s: %s", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange: unexpected status %d", status)
+	}
+	return &token, nil
+}
+
+// getJSON fetches a JSON document, authorized by accessToken if set.
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	status, err := doJSON(client, req, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", endpoint, err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %d", endpoint, status)
+	}
+	return nil
+}
+
+// maxResponseSize bounds provider responses read into memory.
+const maxResponseSize = 1 << 20
+
+func doJSON(client *http.Client, req *http.Request, v interface{}) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("invalid JSON response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
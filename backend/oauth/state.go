@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// stateTTL is how long a user has to complete the provider's consent screen.
+const stateTTL = 10 * time.Minute
+
+// Pending is a login that was sent to a provider and awaits its callback.
+type Pending struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	// LinkUserID is set when an existing user is linking the provider
+	// rather than logging in.
+	LinkUserID string `json:"linkUserId,omitempty"`
+}
+
+// StateStore keeps pending logins in Redis, keyed by the state parameter.
+type StateStore struct {
+	redis *redis.Client
+}
+
+func NewStateStore(client *redis.Client) *StateStore {
+	return &StateStore{
+		redis: client,
+	}
+}
+
+// Begin records a pending login with a fresh state, nonce and PKCE
+// verifier, and returns it with its state.
+func (s *StateStore) Begin(ctx context.Context, provider, linkUserID string) (string, *Pending, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	pending := &Pending{Provider: provider, LinkUserID: linkUserID}
+	if pending.Verifier, err = NewVerifier(); err != nil {
+		return "", nil, err
+	}
+	if pending.Nonce, err = randomString(); err != nil {
+		return "", nil, err
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.redis.Set(ctx, stateKey(state), data, stateTTL).Err(); err != nil {
+		return "", nil, err
+	}
+	return state, pending, nil
+}
+
+// Take returns and deletes the pending login for state, so each state can
+// complete only one login.
+func (s *StateStore) Take(ctx context.Context, state string) (*Pending, error) {
+	data, err := s.redis.GetDel(ctx, stateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending Pending
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+func stateKey(state string) string {
+	return "oauth:state:" + state
+}
@@ -0,0 +1,219 @@
+// Package presence tracks which users are online and which game they are
+// in, so friends can see who is racing and join or spectate. State lives in
+// Redis with expiring keys: replicas refresh the users connected to them,
+// and a replica that dies lets its users' presence lapse.
+package presence
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"typerace/social"
+	"typerace/websocket"
+)
+
+const (
+	// onlineTTL is how long a user stays online after their connection
+	// was last seen.
+	onlineTTL = 90 * time.Second
+	// refreshInterval is how often connected users are kept online.
+	refreshInterval = onlineTTL / 3
+	// gameTTL bounds how long a user shows as racing in a game that was
+	// abandoned without finishing.
+	gameTTL = 2 * time.Hour
+	// ticketTTL is how long a client has to open its user connection
+	// after asking for a ticket.
+	ticketTTL = 30 * time.Second
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired presence ticket")
+
+// Status is what a user is doing.
+type Status string
+
+const (
+	Offline Status = "offline"
+	Online  Status = "online"
+	Racing  Status = "racing"
+)
+
+// Presence is a user's status and, while racing, their game.
+type Presence struct {
+	UserID string `json:"userId"`
+	Status Status `json:"status"`
+	GameID string `json:"gameId,omitempty"`
+}
+
+type Tracker struct {
+	redis   *redis.Client
+	hub     *websocket.Hub
+	friends *social.Graph
+}
+
+// New creates a Tracker and subscribes it to the hub's user connections.
+func New(client *redis.Client, hub *websocket.Hub, friends *social.Graph) *Tracker {
+	t := &Tracker{
+		redis:   client,
+		hub:     hub,
+		friends: friends,
+	}
+	hub.UserPresence = t.connected
+	return t
+}
+
+// Issue returns a single-use ticket that opens a user connection for
+// userID. Browsers cannot send an access token on websocket upgrades, so
+// clients fetch a ticket over the API first.
+func (t *Tracker) Issue(ctx context.Context, userID string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(b)
+	if err := t.redis.Set(ctx, ticketKey(ticket), userID, ticketTTL).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// Redeem consumes a ticket and returns the user it was issued to.
+func (t *Tracker) Redeem(ctx context.Context, ticket string) (string, error) {
+	userID, err := t.redis.GetDel(ctx, ticketKey(ticket)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrInvalidTicket
+	}
+	return userID, err
+}
+
+// EnterGame shows userID as racing in gameID.
+func (t *Tracker) EnterGame(ctx context.Context, userID, gameID string) {
+	if err := t.redis.Set(ctx, gameKey(userID), gameID, gameTTL).Err(); err != nil {
+		log.Printf("Error setting presence of %s: %v", userID, err)
+		return
+	}
+	t.announce(ctx, userID)
+}
+
+// LeaveGame stops showing userID as racing in gameID. It leaves alone a
+// game the user has moved on to since.
+func (t *Tracker) LeaveGame(ctx context.Context, userID, gameID string) {
+	current, err := t.redis.Get(ctx, gameKey(userID)).Result()
+	if err != nil || current != gameID {
+		if err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("Error loading presence of %s: %v", userID, err)
+		}
+		return
+	}
+	if err := t.redis.Del(ctx, gameKey(userID)).Err(); err != nil {
+		log.Printf("Error clearing presence of %s: %v", userID, err)
+		return
+	}
+	t.announce(ctx, userID)
+}
+
+// Get returns the presence of each user, in order.
+func (t *Tracker) Get(ctx context.Context, userIDs []string) ([]Presence, error) {
+	if len(userIDs) == 0 {
+		return []Presence{}, nil
+	}
+	pipe := t.redis.Pipeline()
+	online := make([]*redis.IntCmd, len(userIDs))
+	games := make([]*redis.StringCmd, len(userIDs))
+	for i, id := range userIDs {
+		online[i] = pipe.Exists(ctx, onlineKey(id))
+		games[i] = pipe.Get(ctx, gameKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	presences := make([]Presence, len(userIDs))
+	for i, id := range userIDs {
+		p := Presence{UserID: id, Status: Offline}
+		if gameID, err := games[i].Result(); err == nil {
+			p.Status, p.GameID = Racing, gameID
+		} else if online[i].Val() > 0 {
+			p.Status = Online
+		}
+		presences[i] = p
+	}
+	return presences, nil
+}
+
+// Run keeps the users connected to this replica online until ctx is done.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pipe := t.redis.Pipeline()
+		for _, id := range t.hub.OnlineUsers() {
+			pipe.Set(ctx, onlineKey(id), 1, onlineTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Error refreshing presence: %v", err)
+		}
+	}
+}
+
+// connected records a user's first connection opening or last one closing.
+func (t *Tracker) connected(userID string, online bool) {
+	ctx := context.Background()
+	var err error
+	if online {
+		err = t.redis.Set(ctx, onlineKey(userID), 1, onlineTTL).Err()
+	} else if !t.hub.Online(userID) {
+		// The user may have reconnected while this was scheduled
+		err = t.redis.Del(ctx, onlineKey(userID)).Err()
+	}
+	if err != nil {
+		log.Printf("Error setting presence of %s: %v", userID, err)
+		return
+	}
+	t.announce(ctx, userID)
+}
+
+// announce sends userID's presence to their friends who are connected to
+// this replica.
+func (t *Tracker) announce(ctx context.Context, userID string) {
+	friends, err := t.friends.FriendIDs(ctx, userID)
+	if err != nil {
+		log.Printf("Error loading friends of %s: %v", userID, err)
+		return
+	}
+	if len(friends) == 0 {
+		return
+	}
+	presences, err := t.Get(ctx, []string{userID})
+	if err != nil {
+		log.Printf("Error loading presence of %s: %v", userID, err)
+		return
+	}
+	message := websocket.Message{Type: "presence", Data: presences[0]}
+	for _, id := range friends {
+		t.hub.SendToUser(id, message)
+	}
+}
+
+func onlineKey(userID string) string {
+	return "presence:online:" + userID
+}
+
+func gameKey(userID string) string {
+	return "presence:game:" + userID
+}
+
+func ticketKey(ticket string) string {
+	return "presence:ticket:" + ticket
+}
@@ -0,0 +1,115 @@
+// Package ratelimit implements token-bucket rate limiting, shared between
+// server instances through Redis with an in-memory fallback.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n events a minute, all of which may come at once.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until a token is available when Allowed is
+	// false.
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from named buckets.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Bucket is a single token bucket for limiting one local stream, such as
+// the messages of one websocket connection. It is not safe for concurrent
+// use.
+type Bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(limit Limit) *Bucket {
+	return &Bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+	}
+}
+
+// Allow takes a token if one is available at now.
+func (b *Bucket) Allow(now time.Time) bool {
+	return b.take(now).Allowed
+}
+
+func (b *Bucket) take(now time.Time) Result {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Remaining: int(b.tokens)}
+	}
+	wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+	return Result{RetryAfter: wait}
+}
+
+// idleTimeout is how long an untouched in-memory bucket is kept. A full
+// bucket is indistinguishable from a missing one, so this only needs to
+// cover the longest refill time in use.
+const idleTimeout = time.Hour
+
+// Memory is a Limiter for a single server instance.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > idleTimeout {
+		for k, b := range m.buckets {
+			if now.Sub(b.last) > idleTimeout {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok || b.limit != limit {
+		b = NewBucket(limit)
+		m.buckets[key] = b
+	}
+	return b.take(now), nil
+}
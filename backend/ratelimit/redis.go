@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucket refills and takes from a bucket stored as a hash, atomically.
+// It returns whether a token was taken, the tokens left and the
+// milliseconds until the next token.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), wait}
+`)
+
+// Redis shares buckets between server instances. While Redis is
+// unreachable it falls back to per-instance buckets rather than failing
+// requests.
+type Redis struct {
+	client   *redis.Client
+	fallback *Memory
+
+	mu         sync.Mutex
+	lastWarned time.Time
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{
+		client:   client,
+		fallback: NewMemory(),
+	}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := tokenBucket.Run(ctx, r.client, []string{"ratelimit:" + key},
+		limit.Rate, limit.Burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil || len(values) != 3 {
+		r.warn(err)
+		return r.fallback.Allow(ctx, key, limit)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(math.Max(0, float64(values[1]))),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// warn logs a Redis failure at most once a minute.
+func (r *Redis) warn(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastWarned) < time.Minute {
+		return
+	}
+	r.lastWarned = time.Now()
+	log.Printf("Rate limiter falling back to in-memory buckets: %v", err)
+}
@@ -0,0 +1,48 @@
+// Package rating implements multi-player Elo ratings computed from race
+// placements.
+package rating
+
+import "math"
+
+const (
+	// Initial is the rating given to players who have not raced yet.
+	Initial = 1500.0
+	// kFactor is the maximum rating change against a single opponent.
+	kFactor = 32.0
+)
+
+// Expected returns the probability that a player rated a beats a player
+// rated b.
+func Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Update computes new ratings for players listed in finishing order, best
+// first. Each race is scored as a round robin of pairwise results, with the
+// K-factor divided across opponents so that race size does not inflate the
+// rating swing.
+func Update(ratings []float64) []float64 {
+	n := len(ratings)
+	updated := make([]float64, n)
+	copy(updated, ratings)
+	if n < 2 {
+		return updated
+	}
+
+	k := kFactor / float64(n-1)
+	for i := 0; i < n; i++ {
+		delta := 0.0
+		for j := 0; j < n; j++ {
+			if i == j {
+				continue
+			}
+			score := 0.0
+			if i < j {
+				score = 1
+			}
+			delta += k * (score - Expected(ratings[i], ratings[j]))
+		}
+		updated[i] = ratings[i] + delta
+	}
+	return updated
+}
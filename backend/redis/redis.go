@@ -2,12 +2,14 @@ package redis
 
 import (
 	"github.com/go-redis/redis/v8"
+
+	"typerace/config"
 )
 
-func InitRedis() *redis.Client {
+func InitRedis(cfg config.RedisConfig) *redis.Client {
 	return redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "", // no password set
-		DB:       0,  // use default DB
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
 }
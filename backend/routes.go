@@ -0,0 +1,173 @@
+package main
+
+import (
+	"typerace/config"
+	"typerace/handlers"
+	"typerace/middleware"
+	"typerace/models"
+	"typerace/ratelimit"
+)
+
+// apiHandlers are the handlers served under /api.
+type apiHandlers struct {
+	auth         *handlers.AuthHandler
+	account      *handlers.AccountHandler
+	mfa          *handlers.MFAHandler
+	oauth        *handlers.OAuthHandler
+	admin        *handlers.AdminHandler
+	game         *handlers.GameHandler
+	practice     *handlers.PracticeHandler
+	user         *handlers.UserHandler
+	leaderboard  *handlers.LeaderboardHandler
+	daily        *handlers.DailyHandler
+	friend       *handlers.FriendHandler
+	invitation   *handlers.InvitationHandler
+	chat         *handlers.ChatHandler
+	notification *handlers.NotificationHandler
+}
+
+// apiRoutes is the route table of the /api router. Every route states who
+// may call it; handlers read the caller from the request context, never
+// from client-supplied headers.
+func apiRoutes(h apiHandlers, limits config.RateLimitConfig) []middleware.Route {
+	const (
+		public        = middleware.Public
+		optional      = middleware.Optional
+		authenticated = middleware.Authenticated
+		authorized    = middleware.Authorized
+	)
+	login := ratelimit.PerMinute(limits.Login)
+	chat := ratelimit.PerMinute(limits.Chat)
+
+	return []middleware.Route{
+		// Auth
+		{Method: "POST", Path: "/auth/login", Access: public, RateLimit: "login", Limit: login, Handler: h.auth.Login},
+		{Method: "POST", Path: "/auth/login/2fa", Access: public, RateLimit: "login", Limit: login, Handler: h.auth.LoginTwoFactor},
+		{Method: "POST", Path: "/auth/register", Access: public, RateLimit: "register", Limit: ratelimit.PerMinute(limits.Register), Handler: h.auth.Register},
+		{Method: "POST", Path: "/auth/refresh", Access: public, Handler: h.auth.RefreshToken},
+		{Method: "POST", Path: "/auth/logout", Access: public, Handler: h.auth.Logout},
+		{Method: "POST", Path: "/auth/logout-all", Access: authenticated, Handler: h.auth.LogoutAll},
+		{Method: "GET", Path: "/auth/sessions", Access: authenticated, Handler: h.auth.ListSessions},
+		{Method: "DELETE", Path: "/auth/sessions/{id}", Access: authenticated, Handler: h.auth.RevokeSession},
+		{Method: "GET", Path: "/auth/me", Access: authenticated, Handler: h.auth.GetMe},
+		{Method: "GET", Path: "/auth/check-username/{username}", Access: public, RateLimit: "check-username", Limit: ratelimit.PerMinute(limits.CheckUsername), Handler: h.auth.CheckUsername},
+		{Method: "POST", Path: "/auth/email/verify", Access: authenticated, RateLimit: "verify-email", Limit: ratelimit.PerMinute(limits.VerifyEmail), PerUser: true, Handler: h.account.RequestEmailVerification},
+		{Method: "POST", Path: "/auth/email/confirm", Access: public, Handler: h.account.ConfirmEmail},
+		{Method: "POST", Path: "/auth/password/forgot", Access: public, RateLimit: "login", Limit: login, Handler: h.account.ForgotPassword},
+		{Method: "POST", Path: "/auth/password/reset", Access: public, Handler: h.account.ResetPassword},
+		{Method: "GET", Path: "/auth/oauth/providers", Access: public, Handler: h.oauth.ListProviders},
+		{Method: "POST", Path: "/auth/oauth/{provider}/start", Access: public, Handler: h.oauth.StartLogin},
+		{Method: "POST", Path: "/auth/oauth/{provider}/link", Access: authenticated, Handler: h.oauth.StartLink},
+		{Method: "POST", Path: "/auth/oauth/{provider}/callback", Access: public, Handler: h.oauth.Callback},
+		{Method: "GET", Path: "/auth/identities", Access: authenticated, Handler: h.oauth.ListIdentities},
+		{Method: "DELETE", Path: "/auth/identities/{provider}", Access: authenticated, Handler: h.oauth.Unlink},
+		{Method: "GET", Path: "/auth/2fa", Access: authenticated, Handler: h.mfa.GetStatus},
+		{Method: "POST", Path: "/auth/2fa/enroll", Access: authenticated, Handler: h.mfa.Enroll},
+		{Method: "POST", Path: "/auth/2fa/enable", Access: authenticated, Handler: h.mfa.Enable},
+		{Method: "POST", Path: "/auth/2fa/disable", Access: authenticated, Handler: h.mfa.Disable},
+		{Method: "POST", Path: "/auth/2fa/recovery-codes", Access: authenticated, Handler: h.mfa.RegenerateRecoveryCodes},
+
+		// Admin
+		{Method: "GET", Path: "/admin/users", Access: authorized, Permission: models.PermViewUsers, Handler: h.admin.ListUsers},
+		{Method: "POST", Path: "/admin/users/{id}/ban", Access: authorized, Permission: models.PermBanUsers, Handler: h.admin.BanUser},
+		{Method: "DELETE", Path: "/admin/users/{id}/ban", Access: authorized, Permission: models.PermBanUsers, Handler: h.admin.UnbanUser},
+		{Method: "PUT", Path: "/admin/users/{id}/role", Access: authorized, Permission: models.PermManageUsers, Handler: h.admin.SetRole},
+		{Method: "DELETE", Path: "/admin/users/{id}/2fa", Access: authorized, Permission: models.PermManageUsers, Handler: h.admin.ResetTwoFactor},
+		{Method: "POST", Path: "/admin/games/{id}/end", Access: authorized, Permission: models.PermManageGames, Handler: h.admin.EndGame},
+		{Method: "DELETE", Path: "/admin/results/{id}", Access: authorized, Permission: models.PermManageGames, Handler: h.admin.DeleteResult},
+		{Method: "GET", Path: "/admin/passages", Access: authorized, Permission: models.PermManagePassages, Handler: h.admin.ListPassages},
+		{Method: "POST", Path: "/admin/passages", Access: authorized, Permission: models.PermManagePassages, Handler: h.admin.CreatePassage},
+		{Method: "PUT", Path: "/admin/passages/{id}", Access: authorized, Permission: models.PermManagePassages, Handler: h.admin.UpdatePassage},
+		{Method: "DELETE", Path: "/admin/passages/{id}", Access: authorized, Permission: models.PermManagePassages, Handler: h.admin.DeletePassage},
+		{Method: "GET", Path: "/admin/tournaments", Access: authorized, Permission: models.PermManageTournaments, Handler: h.admin.ListTournaments},
+		{Method: "POST", Path: "/admin/tournaments", Access: authorized, Permission: models.PermManageTournaments, Handler: h.admin.CreateTournament},
+		{Method: "PUT", Path: "/admin/tournaments/{id}", Access: authorized, Permission: models.PermManageTournaments, Handler: h.admin.UpdateTournament},
+		{Method: "DELETE", Path: "/admin/tournaments/{id}", Access: authorized, Permission: models.PermManageTournaments, Handler: h.admin.DeleteTournament},
+		{Method: "POST", Path: "/admin/seasons", Access: authorized, Permission: models.PermManageSeasons, Handler: h.admin.CreateSeason},
+		{Method: "PUT", Path: "/admin/seasons/{id}", Access: authorized, Permission: models.PermManageSeasons, Handler: h.admin.UpdateSeason},
+		{Method: "DELETE", Path: "/admin/seasons/{id}", Access: authorized, Permission: models.PermManageSeasons, Handler: h.admin.DeleteSeason},
+		{Method: "PUT", Path: "/admin/daily/{date}", Access: authorized, Permission: models.PermManagePassages, Handler: h.admin.CurateDaily},
+		{Method: "DELETE", Path: "/admin/chat/rooms/{room}/messages/{id}", Access: authorized, Permission: models.PermModerateChat, Handler: h.admin.DeleteChatMessage},
+		{Method: "GET", Path: "/admin/chat/reports", Access: authorized, Permission: models.PermModerateChat, Handler: h.admin.ListChatReports},
+		{Method: "POST", Path: "/admin/chat/reports/{id}/resolve", Access: authorized, Permission: models.PermModerateChat, Handler: h.admin.ResolveChatReport},
+		{Method: "PUT", Path: "/admin/users/{id}/chat-mute", Access: authorized, Permission: models.PermModerateChat, Handler: h.admin.MuteUser},
+		{Method: "DELETE", Path: "/admin/users/{id}/chat-mute", Access: authorized, Permission: models.PermModerateChat, Handler: h.admin.UnmuteUser},
+		{Method: "GET", Path: "/admin/audit", Access: authorized, Permission: models.PermViewAudit, Handler: h.admin.ListAuditLog},
+
+		// Games
+		{Method: "POST", Path: "/games", Access: authenticated, Handler: h.game.CreateGame},
+		{Method: "GET", Path: "/games/{id}", Access: public, Handler: h.game.GetGame},
+		{Method: "POST", Path: "/games/{id}/join", Access: authenticated, Handler: h.game.JoinGame},
+		{Method: "POST", Path: "/games/{id}/progress", Access: authenticated, RateLimit: "progress", Limit: ratelimit.PerMinute(limits.Progress), PerUser: true, Handler: h.game.UpdateProgress},
+		{Method: "POST", Path: "/games/{id}/start", Access: authenticated, Handler: h.game.StartGame},
+		{Method: "POST", Path: "/games/{id}/end", Access: authenticated, Handler: h.game.EndGame},
+		{Method: "POST", Path: "/games/{id}/keystrokes", Access: authenticated, RateLimit: "keystrokes", Limit: ratelimit.PerMinute(limits.Keystrokes), PerUser: true, Handler: h.practice.RecordKeystrokes},
+		// Browsers cannot set headers on websocket upgrades. The user
+		// connection is authenticated by a ticket from /presence/ticket and
+		// must be matched before game connections.
+		{Path: "/ws/user", Access: public, Handler: h.friend.HandleUserSocket},
+		{Path: "/ws/{gameId}", Access: public, Handler: h.game.HandleWebSocket},
+
+		// Sessions
+		{Method: "POST", Path: "/sessions", Access: authenticated, Handler: h.game.CreateSession},
+		{Method: "GET", Path: "/sessions/{id}", Access: public, Handler: h.game.GetSession},
+		{Method: "POST", Path: "/sessions/{id}/join", Access: authenticated, Handler: h.game.JoinSession},
+		{Method: "POST", Path: "/sessions/{id}/start", Access: authenticated, Handler: h.game.StartSession},
+
+		// Practice
+		{Method: "POST", Path: "/practice", Access: authenticated, Handler: h.practice.StartPractice},
+
+		// Daily challenge
+		{Method: "GET", Path: "/daily", Access: optional, Handler: h.daily.GetChallenge},
+		{Method: "GET", Path: "/daily/{date}", Access: optional, Handler: h.daily.GetChallenge},
+		{Method: "POST", Path: "/daily/{date}/play", Access: authenticated, Handler: h.daily.Play},
+		{Method: "GET", Path: "/daily/{date}/leaderboard", Access: optional, Handler: h.daily.GetLeaderboard},
+
+		// Friends and presence
+		{Method: "GET", Path: "/friends", Access: authenticated, Handler: h.friend.ListFriends},
+		{Method: "DELETE", Path: "/friends/{id}", Access: authenticated, Handler: h.friend.RemoveFriend},
+		{Method: "GET", Path: "/friends/requests", Access: authenticated, Handler: h.friend.ListRequests},
+		{Method: "POST", Path: "/friends/requests", Access: authenticated, RateLimit: "friend-requests", Limit: ratelimit.PerMinute(limits.FriendRequests), PerUser: true, Handler: h.friend.SendRequest},
+		{Method: "DELETE", Path: "/friends/requests/{id}", Access: authenticated, Handler: h.friend.CancelRequest},
+		{Method: "POST", Path: "/friends/requests/{id}/accept", Access: authenticated, Handler: h.friend.AcceptRequest},
+		{Method: "POST", Path: "/friends/requests/{id}/decline", Access: authenticated, Handler: h.friend.DeclineRequest},
+		{Method: "GET", Path: "/blocks", Access: authenticated, Handler: h.friend.ListBlocked},
+		{Method: "PUT", Path: "/blocks/{id}", Access: authenticated, Handler: h.friend.Block},
+		{Method: "DELETE", Path: "/blocks/{id}", Access: authenticated, Handler: h.friend.Unblock},
+		{Method: "POST", Path: "/presence/ticket", Access: authenticated, Handler: h.friend.IssueTicket},
+
+		// Invitations
+		{Method: "GET", Path: "/invitations", Access: authenticated, Handler: h.invitation.ListInvitations},
+		{Method: "POST", Path: "/invitations", Access: authenticated, RateLimit: "invitations", Limit: ratelimit.PerMinute(limits.Invitations), PerUser: true, Handler: h.invitation.CreateInvitation},
+		{Method: "GET", Path: "/invitations/{id}", Access: authenticated, Handler: h.invitation.GetInvitation},
+		{Method: "DELETE", Path: "/invitations/{id}", Access: authenticated, Handler: h.invitation.CancelInvitation},
+		{Method: "POST", Path: "/invitations/{id}/accept", Access: authenticated, Handler: h.invitation.AcceptInvitation},
+		{Method: "POST", Path: "/invitations/{id}/decline", Access: authenticated, Handler: h.invitation.DeclineInvitation},
+
+		// Notifications. The event stream, like the user websocket, is
+		// authenticated by a ticket from /presence/ticket.
+		{Method: "GET", Path: "/notifications", Access: authenticated, Handler: h.notification.ListNotifications},
+		{Method: "GET", Path: "/notifications/stream", Access: public, Handler: h.notification.StreamNotifications},
+		{Method: "POST", Path: "/notifications/read-all", Access: authenticated, Handler: h.notification.MarkAllRead},
+		{Method: "POST", Path: "/notifications/{id}/read", Access: authenticated, Handler: h.notification.MarkRead},
+
+		// Chat
+		{Method: "GET", Path: "/chat/lobby/messages", Access: optional, Handler: h.chat.GetLobbyMessages},
+		{Method: "POST", Path: "/chat/lobby/messages", Access: authenticated, RateLimit: "chat", Limit: chat, PerUser: true, Handler: h.chat.PostLobbyMessage},
+		{Method: "GET", Path: "/games/{id}/chat", Access: optional, Handler: h.chat.GetGameMessages},
+		{Method: "POST", Path: "/games/{id}/chat", Access: authenticated, RateLimit: "chat", Limit: chat, PerUser: true, Handler: h.chat.PostGameMessage},
+		{Method: "POST", Path: "/chat/reports", Access: authenticated, Handler: h.chat.ReportMessage},
+
+		// Users and rankings
+		{Method: "GET", Path: "/leaderboard", Access: optional, Handler: h.leaderboard.GetLeaderboard},
+		{Method: "GET", Path: "/seasons", Access: public, Handler: h.leaderboard.ListSeasons},
+		{Method: "GET", Path: "/seasons/{id}", Access: public, Handler: h.leaderboard.GetSeason},
+		{Method: "GET", Path: "/seasons/{id}/standings", Access: public, Handler: h.leaderboard.GetSeasonStandings},
+		{Method: "GET", Path: "/passages/{id}/leaderboard", Access: public, Handler: h.leaderboard.GetPassageLeaderboard},
+		{Method: "GET", Path: "/users/{id}", Access: public, Handler: h.user.GetUser},
+		{Method: "GET", Path: "/users/{id}/achievements", Access: public, Handler: h.user.GetAchievements},
+		{Method: "GET", Path: "/users/{id}/head-to-head/{otherId}", Access: public, Handler: h.invitation.GetHeadToHead},
+		{Method: "GET", Path: "/users/{id}/daily-streak", Access: public, Handler: h.daily.GetStreak},
+		{Method: "GET", Path: "/users/{id}/keyprofile", Access: authenticated, Handler: h.practice.GetKeyProfile},
+	}
+}
@@ -0,0 +1,190 @@
+// Package seasons runs the competitive calendar. When a season ends its
+// final standings are archived, ratings are soft reset towards the initial
+// rating and the best players are rewarded with achievements.
+package seasons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/achievements"
+	"typerace/leaderboard"
+	"typerace/models"
+	"typerace/rating"
+)
+
+// rewards are the achievements given for a season's final rank. A player
+// receives only the best tier they reached.
+var rewards = []struct {
+	rank  int
+	key   string
+	title string
+}{
+	{1, "champion", "Champion"},
+	{10, "top10", "Top 10"},
+	{100, "top100", "Top 100"},
+}
+
+type Manager struct {
+	db     *gorm.DB
+	boards *leaderboard.Leaderboard
+	awards *achievements.Engine
+	// carryover is the share of a rating's distance from rating.Initial
+	// kept at a reset.
+	carryover float64
+}
+
+// New creates a Manager that keeps carryover percent of each rating's
+// distance from the initial rating when a season ends.
+func New(db *gorm.DB, boards *leaderboard.Leaderboard, awards *achievements.Engine, carryover int) *Manager {
+	return &Manager{
+		db:        db,
+		boards:    boards,
+		awards:    awards,
+		carryover: float64(carryover) / 100,
+	}
+}
+
+// Current returns the season running at now, or nil between seasons.
+func (m *Manager) Current(ctx context.Context, now time.Time) (*models.Season, error) {
+	var season models.Season
+	err := m.db.WithContext(ctx).Where("starts_at <= ? AND ends_at > ?", now, now).First(&season).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &season, nil
+}
+
+// Standings returns a page of an archived season's final standings and
+// how many players it ranked.
+func (m *Manager) Standings(ctx context.Context, seasonID string, limit, offset int) ([]models.SeasonStanding, int64, error) {
+	query := m.db.WithContext(ctx).Model(&models.SeasonStanding{}).Where("season_id = ?", seasonID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	standings := make([]models.SeasonStanding, 0, limit)
+	err := query.Order("rank, user_id").Limit(limit).Offset(offset).Find(&standings).Error
+	return standings, total, err
+}
+
+// Run archives seasons as they end, checking at startup and then every
+// interval until ctx is done.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.rollover(ctx, time.Now()); err != nil {
+			log.Printf("Error rolling over seasons: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rollover archives every season that has ended, oldest first.
+func (m *Manager) rollover(ctx context.Context, now time.Time) error {
+	var ended []models.Season
+	err := m.db.WithContext(ctx).Where("ends_at <= ? AND archived_at IS NULL", now).Order("ends_at").Find(&ended).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range ended {
+		archived, err := m.archive(ctx, ended[i].ID, now)
+		if err != nil {
+			return fmt.Errorf("season %s: %w", ended[i].ID, err)
+		}
+		if !archived {
+			continue
+		}
+		log.Printf("Archived season %s (%s)", ended[i].Name, ended[i].ID)
+		m.boards.RefreshRatings(ctx)
+		m.reward(ctx, &ended[i])
+	}
+	return nil
+}
+
+// archive stores a season's final standings and soft resets ratings in one
+// transaction. It reports false if the season was already archived, or is
+// being archived by another replica.
+func (m *Manager) archive(ctx context.Context, seasonID string, now time.Time) (bool, error) {
+	archived := false
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var season models.Season
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND archived_at IS NULL", seasonID).Limit(1).Find(&season)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		ranked := m.boards.Ranked(tx, leaderboard.Query{
+			Window:   leaderboard.WindowSeason,
+			Season:   &season,
+			Sort:     "rating",
+			MinRaces: 1,
+		})
+		err := tx.Exec(`INSERT INTO season_standings
+			(season_id, user_id, username, rank, rating, races, wins, avg_wpm, best_wpm, created_at)
+			SELECT ?, user_id, username, rank, rating, races, wins, avg_wpm, best_wpm, ?
+			FROM (?) AS final`, season.ID, now, ranked).Error
+		if err != nil {
+			return err
+		}
+
+		// Keep part of each rating's distance from the initial rating, so
+		// strong players start ahead but everyone has to prove themselves
+		err = tx.Model(&models.User{}).Where("rating <> ?", rating.Initial).
+			Update("rating", gorm.Expr("? + (rating - ?) * ?", rating.Initial, rating.Initial, m.carryover)).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&season).Update("archived_at", now).Error; err != nil {
+			return err
+		}
+		archived = true
+		return nil
+	})
+	return archived, err
+}
+
+// reward grants the season's achievements to its best finishers. Errors
+// are logged; rewards that fail are not retried.
+func (m *Manager) reward(ctx context.Context, season *models.Season) {
+	last := rewards[len(rewards)-1].rank
+	var standings []models.SeasonStanding
+	err := m.db.WithContext(ctx).Where("season_id = ? AND rank <= ?", season.ID, last).Order("rank").Find(&standings).Error
+	if err != nil {
+		log.Printf("Error loading standings of season %s: %v", season.ID, err)
+		return
+	}
+
+	for _, s := range standings {
+		for _, tier := range rewards {
+			if s.Rank > tier.rank {
+				continue
+			}
+			_, err := m.awards.Grant(ctx, s.UserID,
+				"season:"+season.ID+":"+tier.key,
+				season.Name+" "+tier.title,
+				fmt.Sprintf("Finished %s ranked #%d", season.Name, s.Rank))
+			if err != nil {
+				log.Printf("Error rewarding %s for season %s: %v", s.UserID, season.ID, err)
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package seasons
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/achievements"
+	"typerace/db"
+	"typerace/leaderboard"
+	"typerace/models"
+)
+
+// testTx connects to the Postgres database named by TEST_DATABASE_DSN, or
+// skips the test if the variable is not set, and returns a transaction
+// rolled back when the test ends. Archiving resets every rating, so it must
+// not outlive the test.
+func testTx(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	tx := conn.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func TestArchive(t *testing.T) {
+	tx := testTx(t)
+	ctx := context.Background()
+	m := New(tx, leaderboard.New(tx, nil), achievements.New(tx, nil), 50)
+
+	// A season long ago holds only the results made here
+	season := models.Season{
+		ID: uuid.New().String(), Name: "Season Test",
+		StartsAt: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:   time.Date(2001, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := tx.Create(&season).Error; err != nil {
+		t.Fatal(err)
+	}
+	ratings := []float64{1700, 1500, 1300}
+	users := make([]models.User, len(ratings))
+	for i, r := range ratings {
+		users[i] = models.User{ID: uuid.New().String(), Username: "season-" + uuid.New().String()[:8], Rating: r}
+		if err := tx.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The weakest player did not race this season and is not ranked
+	for _, u := range users[:2] {
+		result := models.GameResult{
+			ID: uuid.New().String(), GameID: uuid.New().String(), UserID: u.ID, WPM: 60,
+			Mode: models.ModeStandard, Finished: true, CreatedAt: season.StartsAt.Add(time.Hour),
+		}
+		if err := tx.Create(&result).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := season.EndsAt.Add(time.Minute)
+	archived, err := m.archive(ctx, season.ID, now)
+	if err != nil || !archived {
+		t.Fatalf("archive = %v, %v", archived, err)
+	}
+	if again, err := m.archive(ctx, season.ID, now); err != nil || again {
+		t.Errorf("second archive = %v, %v, want nothing done", again, err)
+	}
+
+	standings, total, err := m.Standings(ctx, season.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(standings) != 2 ||
+		standings[0].UserID != users[0].ID || standings[0].Rank != 1 || standings[0].Rating != 1700 ||
+		standings[1].UserID != users[1].ID || standings[1].Rank != 2 {
+		t.Errorf("standings = %+v, want the two players who raced by their final rating", standings)
+	}
+
+	// Half of each rating's distance from 1500 is kept
+	for i, want := range []float64{1600, 1500, 1400} {
+		var u models.User
+		tx.Select("rating").First(&u, "id = ?", users[i].ID)
+		if u.Rating != want {
+			t.Errorf("rating %v after the reset = %v, want %v", ratings[i], u.Rating, want)
+		}
+	}
+
+	m.reward(ctx, &season)
+	for i, want := range []string{"season:" + season.ID + ":champion", "season:" + season.ID + ":top10"} {
+		var held []string
+		tx.Model(&models.Achievement{}).Where("user_id = ?", users[i].ID).Pluck("type", &held)
+		if len(held) != 1 || held[0] != want {
+			t.Errorf("rank %d rewarded with %v, want only %s", i+1, held, want)
+		}
+	}
+}
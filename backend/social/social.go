@@ -0,0 +1,273 @@
+// Package social keeps the friend graph. Each user's view of another is a
+// directed edge: a pending request, an accepted friendship (stored in both
+// directions) or a block (stored only for the user who blocked).
+package social
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"typerace/models"
+)
+
+var (
+	ErrSelf             = errors.New("users cannot befriend themselves")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrNotFound         = errors.New("no such friend request or friendship")
+	ErrBlocked          = errors.New("one of the users blocked the other")
+	ErrAlreadyFriends   = errors.New("users are already friends")
+	ErrAlreadyRequested = errors.New("friend request already sent")
+)
+
+// Entry is another user as listed in a friends, requests or block list.
+type Entry struct {
+	UserID   string  `json:"userId"`
+	Username string  `json:"username"`
+	Avatar   string  `json:"avatar"`
+	Rating   float64 `json:"rating"`
+	// Since is when the edge reached its current state.
+	Since time.Time `json:"since"`
+}
+
+type Graph struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Graph {
+	return &Graph{
+		db: db,
+	}
+}
+
+// Request sends a friend request from userID to friendID. If friendID had
+// already asked userID, the friendship is accepted instead and Request
+// reports true.
+func (g *Graph) Request(ctx context.Context, userID, friendID string) (bool, error) {
+	if userID == friendID {
+		return false, ErrSelf
+	}
+	accepted := false
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, friendID); err != nil {
+			return err
+		}
+		edges, err := lockEdges(tx, userID, friendID)
+		if err != nil {
+			return err
+		}
+
+		out, in := edges[userID], edges[friendID]
+		switch {
+		case out == models.FriendBlocked || in == models.FriendBlocked:
+			return ErrBlocked
+		case out == models.FriendAccepted:
+			return ErrAlreadyFriends
+		case out == models.FriendPending:
+			return ErrAlreadyRequested
+		case in == models.FriendPending:
+			accepted = true
+			return befriend(tx, friendID, userID)
+		}
+		return setEdge(tx, userID, friendID, models.FriendPending)
+	})
+	return accepted, err
+}
+
+// Accept accepts the pending request requesterID sent to userID.
+func (g *Graph) Accept(ctx context.Context, userID, requesterID string) error {
+	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		edges, err := lockEdges(tx, requesterID, userID)
+		if err != nil {
+			return err
+		}
+		if edges[requesterID] != models.FriendPending {
+			return ErrNotFound
+		}
+		return befriend(tx, requesterID, userID)
+	})
+}
+
+// Decline drops the pending request requesterID sent to userID. The
+// requester is not told.
+func (g *Graph) Decline(ctx context.Context, userID, requesterID string) error {
+	return g.deleteEdges(ctx, models.FriendPending, [2]string{requesterID, userID})
+}
+
+// Cancel withdraws the pending request userID sent to friendID.
+func (g *Graph) Cancel(ctx context.Context, userID, friendID string) error {
+	return g.deleteEdges(ctx, models.FriendPending, [2]string{userID, friendID})
+}
+
+// Remove ends a friendship for both users.
+func (g *Graph) Remove(ctx context.Context, userID, friendID string) error {
+	return g.deleteEdges(ctx, models.FriendAccepted, [2]string{userID, friendID}, [2]string{friendID, userID})
+}
+
+// Block stops blockedID from befriending or contacting userID, ending any
+// friendship or request between them. A block blockedID placed on userID
+// is kept.
+func (g *Graph) Block(ctx context.Context, userID, blockedID string) error {
+	if userID == blockedID {
+		return ErrSelf
+	}
+	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, blockedID); err != nil {
+			return err
+		}
+		err := tx.Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status <> ?",
+			userID, blockedID, blockedID, userID, models.FriendBlocked).
+			Delete(&models.Friendship{}).Error
+		if err != nil {
+			return err
+		}
+		return setEdge(tx, userID, blockedID, models.FriendBlocked)
+	})
+}
+
+// Unblock lifts userID's block on blockedID.
+func (g *Graph) Unblock(ctx context.Context, userID, blockedID string) error {
+	return g.deleteEdges(ctx, models.FriendBlocked, [2]string{userID, blockedID})
+}
+
+// Friends lists userID's friends by username.
+func (g *Graph) Friends(ctx context.Context, userID string) ([]Entry, error) {
+	return g.list(ctx, "f.user_id = ?", "f.friend_id", userID, models.FriendAccepted)
+}
+
+// FriendIDs returns the IDs of userID's friends.
+func (g *Graph) FriendIDs(ctx context.Context, userID string) ([]string, error) {
+	var ids []string
+	err := g.db.WithContext(ctx).Model(&models.Friendship{}).
+		Where("user_id = ? AND status = ?", userID, models.FriendAccepted).
+		Pluck("friend_id", &ids).Error
+	return ids, err
+}
+
+// Requests lists the pending requests sent to and by userID.
+func (g *Graph) Requests(ctx context.Context, userID string) (incoming, outgoing []Entry, err error) {
+	if incoming, err = g.list(ctx, "f.friend_id = ?", "f.user_id", userID, models.FriendPending); err != nil {
+		return nil, nil, err
+	}
+	if outgoing, err = g.list(ctx, "f.user_id = ?", "f.friend_id", userID, models.FriendPending); err != nil {
+		return nil, nil, err
+	}
+	return incoming, outgoing, nil
+}
+
+// Blocked lists the users userID blocked.
+func (g *Graph) Blocked(ctx context.Context, userID string) ([]Entry, error) {
+	return g.list(ctx, "f.user_id = ?", "f.friend_id", userID, models.FriendBlocked)
+}
+
+// BlockedBy returns the IDs of the users who blocked userID.
+func (g *Graph) BlockedBy(ctx context.Context, userID string) ([]string, error) {
+	var ids []string
+	err := g.db.WithContext(ctx).Model(&models.Friendship{}).
+		Where("friend_id = ? AND status = ?", userID, models.FriendBlocked).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+// AreFriends reports whether two users are friends.
+func (g *Graph) AreFriends(ctx context.Context, userID, otherID string) (bool, error) {
+	var n int64
+	err := g.db.WithContext(ctx).Model(&models.Friendship{}).
+		Where("user_id = ? AND friend_id = ? AND status = ?", userID, otherID, models.FriendAccepted).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// Blocking reports whether either user blocked the other.
+func (g *Graph) Blocking(ctx context.Context, userID, otherID string) (bool, error) {
+	var n int64
+	err := g.db.WithContext(ctx).Model(&models.Friendship{}).
+		Where("((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)) AND status = ?",
+			userID, otherID, otherID, userID, models.FriendBlocked).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// list returns the users at the other end of userID's edges with status.
+// where matches userID's end and other names the column of the other.
+func (g *Graph) list(ctx context.Context, where, other, userID string, status models.FriendStatus) ([]Entry, error) {
+	entries := []Entry{}
+	err := g.db.WithContext(ctx).Table("friendships f").
+		Select("u.id AS user_id, u.username, u.avatar, u.rating, f.updated_at AS since").
+		Joins("JOIN users u ON u.id = "+other).
+		Where(where+" AND f.status = ?", userID, status).
+		Order("u.username").
+		Scan(&entries).Error
+	return entries, err
+}
+
+// deleteEdges deletes the given edges with status, returning ErrNotFound
+// if there were none.
+func (g *Graph) deleteEdges(ctx context.Context, status models.FriendStatus, edges ...[2]string) error {
+	query := g.db.WithContext(ctx).Where("status = ?", status)
+	match := g.db
+	for _, e := range edges {
+		match = match.Or("user_id = ? AND friend_id = ?", e[0], e[1])
+	}
+	res := query.Where(match).Delete(&models.Friendship{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func exists(tx *gorm.DB, userID string) error {
+	var n int64
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// lockEdges locks and returns the edges between two users, keyed by the
+// user each starts from.
+func lockEdges(tx *gorm.DB, userID, otherID string) (map[string]models.FriendStatus, error) {
+	var rows []models.Friendship
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", userID, otherID, otherID, userID).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	edges := make(map[string]models.FriendStatus, len(rows))
+	for _, row := range rows {
+		edges[row.UserID] = row.Status
+	}
+	return edges, nil
+}
+
+// befriend accepts requesterID's request to userID.
+func befriend(tx *gorm.DB, requesterID, userID string) error {
+	if err := setEdge(tx, requesterID, userID, models.FriendAccepted); err != nil {
+		return err
+	}
+	return setEdge(tx, userID, requesterID, models.FriendAccepted)
+}
+
+func setEdge(tx *gorm.DB, userID, friendID string, status models.FriendStatus) error {
+	now := time.Now()
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "friend_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "updated_at"}),
+	}).Create(&models.Friendship{
+		UserID:    userID,
+		FriendID:  friendID,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}).Error
+}
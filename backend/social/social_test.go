@@ -0,0 +1,130 @@
+package social
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"typerace/db"
+	"typerace/models"
+)
+
+func TestSelf(t *testing.T) {
+	g := New(nil)
+	if _, err := g.Request(context.Background(), "a", "a"); !errors.Is(err, ErrSelf) {
+		t.Errorf("Request to oneself = %v, want ErrSelf", err)
+	}
+	if err := g.Block(context.Background(), "a", "a"); !errors.Is(err, ErrSelf) {
+		t.Errorf("Block of oneself = %v, want ErrSelf", err)
+	}
+}
+
+// TestEdges needs the Postgres database named by TEST_DATABASE_DSN.
+func TestEdges(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(conn); err != nil {
+		t.Fatal(err)
+	}
+	users := make([]models.User, 2)
+	for i := range users {
+		users[i] = models.User{ID: uuid.New().String(), Username: "social-" + uuid.New().String()[:8]}
+		if err := conn.Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := users[0].ID, users[1].ID
+	t.Cleanup(func() {
+		conn.Where("user_id IN ? OR friend_id IN ?", []string{a, b}, []string{a, b}).Delete(&models.Friendship{})
+		for _, u := range users {
+			conn.Delete(&u)
+		}
+	})
+
+	ctx := context.Background()
+	g := New(conn)
+	check := func(step string, err, want error) {
+		t.Helper()
+		if !errors.Is(err, want) {
+			t.Errorf("%s = %v, want %v", step, err, want)
+		}
+	}
+	friends := func(want bool) {
+		t.Helper()
+		for _, pair := range [][2]string{{a, b}, {b, a}} {
+			if got, err := g.AreFriends(ctx, pair[0], pair[1]); err != nil || got != want {
+				t.Errorf("AreFriends = %v, %v, want %v", got, err, want)
+			}
+		}
+	}
+
+	_, err = g.Request(ctx, a, uuid.New().String())
+	check("Request to an unknown user", err, ErrUserNotFound)
+
+	accepted, err := g.Request(ctx, a, b)
+	check("Request", err, nil)
+	_, err = g.Request(ctx, a, b)
+	check("repeated Request", err, ErrAlreadyRequested)
+	if incoming, outgoing, _ := g.Requests(ctx, b); len(incoming) != 1 || incoming[0].UserID != a || len(outgoing) != 0 {
+		t.Errorf("requests of the recipient = %+v, %+v", incoming, outgoing)
+	}
+	// A request back accepts the pending one
+	if accepted, err = g.Request(ctx, b, a); err != nil || !accepted {
+		t.Errorf("Request back = %v, %v, want the friendship accepted", accepted, err)
+	}
+	friends(true)
+	_, err = g.Request(ctx, a, b)
+	check("Request to a friend", err, ErrAlreadyFriends)
+	if ids, _ := g.FriendIDs(ctx, b); !reflect.DeepEqual(ids, []string{a}) {
+		t.Errorf("FriendIDs = %v, want %v", ids, []string{a})
+	}
+
+	check("Remove", g.Remove(ctx, b, a), nil)
+	friends(false)
+	check("repeated Remove", g.Remove(ctx, a, b), ErrNotFound)
+
+	g.Request(ctx, a, b)
+	check("Decline by the sender", g.Decline(ctx, a, b), ErrNotFound)
+	check("Cancel", g.Cancel(ctx, a, b), nil)
+	check("Accept of a cancelled request", g.Accept(ctx, b, a), ErrNotFound)
+	g.Request(ctx, a, b)
+	check("Decline", g.Decline(ctx, b, a), nil)
+	g.Request(ctx, a, b)
+	check("Accept", g.Accept(ctx, b, a), nil)
+	friends(true)
+
+	// A block ends the friendship and stops requests both ways
+	check("Block", g.Block(ctx, b, a), nil)
+	friends(false)
+	_, err = g.Request(ctx, a, b)
+	check("Request to a blocker", err, ErrBlocked)
+	_, err = g.Request(ctx, b, a)
+	check("Request to the blocked", err, ErrBlocked)
+	if ids, _ := g.BlockedBy(ctx, a); !reflect.DeepEqual(ids, []string{b}) {
+		t.Errorf("BlockedBy = %v, want %v", ids, []string{b})
+	}
+
+	// Blocking back keeps the first block
+	check("Block back", g.Block(ctx, a, b), nil)
+	check("Unblock", g.Unblock(ctx, a, b), nil)
+	if blocking, _ := g.Blocking(ctx, a, b); !blocking {
+		t.Error("the first block was lifted with the second")
+	}
+	check("Unblock of the first block", g.Unblock(ctx, b, a), nil)
+	if blocking, _ := g.Blocking(ctx, a, b); blocking {
+		t.Error("users still block each other")
+	}
+}
@@ -0,0 +1,218 @@
+// Package typing compares what a player has typed against a race passage on
+// the server, so progress and accuracy do not depend on client reports.
+package typing
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rules control how typed input is matched against a passage.
+type Rules struct {
+	// TabWidth expands tabs to this many spaces in both the passage and the
+	// input. Zero leaves tabs untouched.
+	TabWidth int
+	// AutoIndent treats the leading indentation of every passage line as
+	// inserted by the editor: it is skipped in the passage and any
+	// indentation the player types is ignored.
+	AutoIndent bool
+	// AutoCloseBrackets treats closing brackets as inserted by the editor
+	// once their opening bracket has been typed, so skipping them is not an
+	// error.
+	AutoCloseBrackets bool
+}
+
+// Result summarises typed input compared against a passage.
+type Result struct {
+	// Position is the offset, in grapheme clusters of the normalized
+	// passage, up to which the input has been matched.
+	Position int     `json:"position"`
+	Correct  int     `json:"correct"`
+	Errors   int     `json:"errors"`
+	Progress float64 `json:"progress"`
+	Accuracy float64 `json:"accuracy"`
+	Complete bool    `json:"complete"`
+	// Words counts the passage words typed without a mistake up to
+	// Position.
+	Words int `json:"words"`
+}
+
+var bracketPairs = map[string]string{
+	")": "(",
+	"]": "[",
+	"}": "{",
+}
+
+// Normalize converts text to Unicode NFC, converts line endings to \n,
+// expands tabs according to the rules and strips trailing whitespace from
+// every line and from the end of the text.
+func Normalize(text string, rules Rules) string {
+	text = norm.NFC.String(text)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if rules.TabWidth > 0 {
+		text = strings.ReplaceAll(text, "\t", strings.Repeat(" ", rules.TabWidth))
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// Compare matches input against target under the given rules. Both are
+// normalized first and compared grapheme by grapheme, so a character built
+// from several code points counts once. Each mismatched character counts as
+// one error and still advances the cursor, mirroring how a player's caret
+// moves.
+func Compare(target, input string, rules Rules) Result {
+	t := Graphemes(Normalize(target, rules))
+	in := Graphemes(normalizeInput(input, rules))
+
+	var res Result
+	var open []string
+	i, j := 0, 0
+	lineStart := true
+	inWord, wordErr := false, false
+
+	skipIndent := func() {
+		if !rules.AutoIndent || (i > 0 && t[i-1] != "\n") {
+			return
+		}
+		for i < len(t) && isIndent(t[i]) {
+			i++
+		}
+	}
+	skipClosers := func() {
+		for rules.AutoCloseBrackets && i < len(t) && len(open) > 0 && bracketPairs[t[i]] == open[len(open)-1] {
+			open = open[:len(open)-1]
+			i++
+		}
+	}
+
+	for j < len(in) {
+		skipIndent()
+		if i >= len(t) {
+			break
+		}
+
+		// Indentation typed by the player is ignored under auto-indent
+		if rules.AutoIndent && lineStart && isIndent(in[j]) {
+			j++
+			continue
+		}
+		lineStart = in[j] == "\n"
+
+		// An auto-inserted closing bracket the player did not type
+		if rules.AutoCloseBrackets && in[j] != t[i] && isCloser(t[i]) && len(open) > 0 && bracketPairs[t[i]] == open[len(open)-1] {
+			open = open[:len(open)-1]
+			i++
+			continue
+		}
+
+		if isSpace(t[i]) {
+			if inWord && !wordErr && in[j] == t[i] {
+				res.Words++
+			}
+			inWord, wordErr = false, false
+		} else {
+			inWord = true
+			wordErr = wordErr || in[j] != t[i]
+		}
+
+		if in[j] == t[i] {
+			res.Correct++
+			switch {
+			case isOpener(t[i]):
+				open = append(open, t[i])
+			case isCloser(t[i]) && len(open) > 0 && bracketPairs[t[i]] == open[len(open)-1]:
+				open = open[:len(open)-1]
+			}
+		} else {
+			res.Errors++
+		}
+		i++
+		j++
+	}
+
+	// Trailing editor-supplied characters do not hold back completion
+	if res.Errors == 0 {
+		for {
+			before := i
+			skipClosers()
+			if i < len(t) && t[i] == "\n" && rules.AutoIndent && onlyClosersAhead(t[i:], open, rules) {
+				i++
+				skipIndent()
+			}
+			if i == before {
+				break
+			}
+		}
+	}
+
+	if i >= len(t) && inWord && !wordErr {
+		res.Words++
+	}
+
+	res.Position = i
+	if len(t) > 0 {
+		res.Progress = float64(i) / float64(len(t))
+	}
+	if typed := res.Correct + res.Errors; typed > 0 {
+		res.Accuracy = float64(res.Correct) / float64(typed) * 100
+	}
+	res.Complete = i >= len(t) && res.Errors == 0
+	return res
+}
+
+// normalizeInput applies the passage normalization to input without
+// trimming a trailing newline the player has just typed.
+func normalizeInput(input string, rules Rules) string {
+	input = norm.NFC.String(input)
+	input = strings.ReplaceAll(input, "\r\n", "\n")
+	input = strings.ReplaceAll(input, "\r", "\n")
+	if rules.TabWidth > 0 {
+		input = strings.ReplaceAll(input, "\t", strings.Repeat(" ", rules.TabWidth))
+	}
+	return input
+}
+
+// onlyClosersAhead reports whether the rest of the passage consists solely
+// of whitespace and closing brackets that the editor would insert.
+func onlyClosersAhead(rest []string, open []string, rules Rules) bool {
+	if !rules.AutoCloseBrackets {
+		return false
+	}
+	stack := append([]string(nil), open...)
+	for _, r := range rest {
+		switch {
+		case isSpace(r):
+		case isCloser(r) && len(stack) > 0 && bracketPairs[r] == stack[len(stack)-1]:
+			stack = stack[:len(stack)-1]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isSpace(r string) bool {
+	return isIndent(r) || r == "\n"
+}
+
+// isIndent reports whether r can make up indentation. Tabs survive
+// normalization when the rules do not expand them.
+func isIndent(r string) bool {
+	return r == " " || r == "\t"
+}
+
+func isOpener(r string) bool {
+	return r == "(" || r == "[" || r == "{"
+}
+
+func isCloser(r string) bool {
+	_, ok := bracketPairs[r]
+	return ok
+}
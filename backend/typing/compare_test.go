@@ -0,0 +1,191 @@
+package typing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	goRules := RulesFor("code", "go")
+	tests := []struct {
+		name   string
+		target string
+		input  string
+		rules  Rules
+		want   Result
+	}{
+		{
+			name:   "exact",
+			target: "hello world",
+			input:  "hello world",
+			want:   Result{Position: 11, Correct: 11, Complete: true, Words: 2},
+		},
+		{
+			name:   "partial",
+			target: "hello world",
+			input:  "hello",
+			want:   Result{Position: 5, Correct: 5},
+		},
+		{
+			name:   "separator typed",
+			target: "hello world",
+			input:  "hello ",
+			want:   Result{Position: 6, Correct: 6, Words: 1},
+		},
+		{
+			name:   "typo",
+			target: "the cat",
+			input:  "thx cat",
+			want:   Result{Position: 7, Correct: 6, Errors: 1, Words: 1},
+		},
+		{
+			name:   "mistyped separator",
+			target: "ab cd",
+			input:  "abxcd",
+			want:   Result{Position: 5, Correct: 4, Errors: 1, Words: 1},
+		},
+		{
+			name:   "nfd input against nfc passage",
+			target: "caf\u00e9 ok",
+			input:  "cafe\u0301 ok",
+			want:   Result{Position: 7, Correct: 7, Complete: true, Words: 2},
+		},
+		{
+			name:   "nfc input against nfd passage",
+			target: "cafe\u0301",
+			input:  "caf\u00e9",
+			want:   Result{Position: 4, Correct: 4, Complete: true, Words: 1},
+		},
+		{
+			name:   "zwj emoji is one character",
+			target: "hi \U0001f468\u200d\U0001f469\u200d\U0001f467",
+			input:  "hi \U0001f468\u200d\U0001f469\u200d\U0001f467",
+			want:   Result{Position: 4, Correct: 4, Complete: true, Words: 2},
+		},
+		{
+			name:   "partial zwj emoji is an error",
+			target: "\U0001f468\u200d\U0001f469",
+			input:  "\U0001f468",
+			want:   Result{Position: 1, Errors: 1},
+		},
+		{
+			name:   "flag is one character",
+			target: "\U0001f1fa\U0001f1f8!",
+			input:  "\U0001f1fa\U0001f1f8!",
+			want:   Result{Position: 2, Correct: 2, Complete: true, Words: 1},
+		},
+		{
+			name:   "line endings",
+			target: "a\r\nb\r\n",
+			input:  "a\nb",
+			want:   Result{Position: 3, Correct: 3, Complete: true, Words: 2},
+		},
+		{
+			name:   "go auto-indent and closing brackets",
+			target: "func f() {\n\treturn\n}",
+			input:  "func f() {\nreturn",
+			rules:  goRules,
+			want:   Result{Position: 23, Correct: 17, Complete: true, Words: 4},
+		},
+		{
+			name:   "go typed indentation is ignored",
+			target: "if x {\n\ty()\n}",
+			input:  "if x {\n    y()\n}",
+			rules:  goRules,
+			want:   Result{Position: 16, Correct: 12, Complete: true, Words: 5},
+		},
+		{
+			name:   "go skipped closing bracket",
+			target: "f(x) + 1",
+			input:  "f(x + 1",
+			rules:  goRules,
+			want:   Result{Position: 8, Correct: 7, Complete: true, Words: 3},
+		},
+		{
+			name:   "python indentation must be typed",
+			target: "if x:\n    y",
+			input:  "if x:\ny",
+			rules:  RulesFor("code", "python"),
+			want:   Result{Position: 7, Correct: 6, Errors: 1, Words: 2},
+		},
+		{
+			name:   "makefile tab indentation",
+			target: "all:\n\tgo build",
+			input:  "all:\ngo build",
+			rules:  RulesFor("code", "makefile"),
+			want:   Result{Position: 14, Correct: 13, Complete: true, Words: 3},
+		},
+		{
+			name:   "makefile typed tab is ignored",
+			target: "all:\n\tgo build",
+			input:  "all:\n\tgo build",
+			rules:  RulesFor("code", "makefile"),
+			want:   Result{Position: 14, Correct: 13, Complete: true, Words: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(tt.target, tt.input, tt.rules)
+			got.Progress, got.Accuracy = 0, 0
+			if got != tt.want {
+				t.Errorf("Compare(%q, %q) = %+v, want %+v", tt.target, tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareRatios(t *testing.T) {
+	res := Compare("abcd", "abx", ProseRules)
+	if math.Abs(res.Progress-0.75) > 1e-9 {
+		t.Errorf("Progress = %v, want 0.75", res.Progress)
+	}
+	if want := 200.0 / 3; math.Abs(res.Accuracy-want) > 1e-9 {
+		t.Errorf("Accuracy = %v, want %v", res.Accuracy, want)
+	}
+
+	res = Compare("abcd", "", ProseRules)
+	if res.Progress != 0 || res.Accuracy != 0 || res.Complete {
+		t.Errorf("empty input = %+v, want nothing typed", res)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		rules Rules
+		want  string
+	}{
+		{"nfc", "cafe\u0301", ProseRules, "caf\u00e9"},
+		{"line endings", "a\r\nb\rc", ProseRules, "a\nb\nc"},
+		{"trailing whitespace", "a  \nb\t\n\n", ProseRules, "a\nb"},
+		{"tabs kept", "\tx", ProseRules, "\tx"},
+		{"tabs expanded", "\tx", Rules{TabWidth: 2}, "  x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.text, tt.rules); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesFor(t *testing.T) {
+	tests := []struct {
+		passageType, language string
+		want                  Rules
+	}{
+		{"prose", "", ProseRules},
+		{"quote", "go", ProseRules},
+		{"code", "Go", codeRules["go"]},
+		{"code", "python", Rules{TabWidth: 4, AutoCloseBrackets: true}},
+		{"code", "makefile", Rules{AutoIndent: true}},
+		{"code", "cobol", defaultCodeRules},
+	}
+	for _, tt := range tests {
+		if got := RulesFor(tt.passageType, tt.language); got != tt.want {
+			t.Errorf("RulesFor(%q, %q) = %+v, want %+v", tt.passageType, tt.language, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package typing
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// drillPoolSize is how many of the best-matching words a drill is drawn from,
+// so drills vary between sessions.
+const drillPoolSize = 40
+
+// Drill builds a practice passage of n words from vocabulary, favouring
+// words that contain the given weak bigrams and, to a lesser degree, weak
+// keys. With no weak spots it falls back to random words.
+func Drill(vocabulary []string, weakKeys, weakBigrams []string, n int) string {
+	if len(vocabulary) == 0 || n <= 0 {
+		return ""
+	}
+
+	type scored struct {
+		word  string
+		score int
+	}
+	candidates := make([]scored, 0, len(vocabulary))
+	for _, word := range vocabulary {
+		score := 0
+		for _, b := range weakBigrams {
+			score += 2 * strings.Count(word, b)
+		}
+		for _, k := range weakKeys {
+			score += strings.Count(word, k)
+		}
+		if score > 0 {
+			candidates = append(candidates, scored{word, score})
+		}
+	}
+
+	pool := vocabulary
+	if len(candidates) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+		if len(candidates) > drillPoolSize {
+			candidates = candidates[:drillPoolSize]
+		}
+		pool = make([]string, len(candidates))
+		for i, c := range candidates {
+			pool[i] = c.word
+		}
+	}
+
+	words := make([]string, n)
+	for i := range words {
+		words[i] = pool[rand.Intn(len(pool))]
+	}
+	return strings.Join(words, " ")
+}
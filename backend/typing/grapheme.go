@@ -0,0 +1,113 @@
+package typing
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	zwj             = '\u200d'
+	viramaCCC uint8 = 9
+)
+
+// Graphemes splits s into user-perceived characters. It follows the core
+// extended grapheme cluster rules of UAX #29 that matter for race passages:
+// CR LF pairs, combining and spacing marks, variation selectors, emoji
+// modifiers and ZWJ sequences, regional indicator flag pairs, Hangul jamo
+// sequences and Indic conjuncts joined by a virama.
+func Graphemes(s string) []string {
+	clusters := make([]string, 0, len(s))
+	start := 0
+	var prev rune = -1
+	riCount := 0
+
+	for i, r := range s {
+		if prev != -1 && !joins(prev, r, riCount) {
+			clusters = append(clusters, s[start:i])
+			start = i
+			riCount = 0
+		}
+		if isRegionalIndicator(r) {
+			riCount++
+		} else {
+			riCount = 0
+		}
+		prev = r
+	}
+	if start < len(s) {
+		clusters = append(clusters, s[start:])
+	}
+	return clusters
+}
+
+// GraphemeCount returns the number of user-perceived characters in s.
+func GraphemeCount(s string) int {
+	return len(Graphemes(s))
+}
+
+// joins reports whether r continues the cluster ending in prev. riCount is
+// the length of the run of regional indicators ending at prev.
+func joins(prev, r rune, riCount int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case prev == '\r' || prev == '\n' || r == '\r' || r == '\n':
+		return false
+	case r == zwj || isExtend(r):
+		return true
+	case prev == zwj:
+		return isPictographic(r)
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		return riCount%2 == 1
+	case isHangulJoin(prev, r):
+		return true
+	case isVirama(prev) && unicode.IsLetter(r):
+		return true
+	}
+	return false
+}
+
+func isExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		(r >= 0xfe00 && r <= 0xfe0f) ||
+		(r >= 0x1f3fb && r <= 0x1f3ff) ||
+		(r >= 0xe0020 && r <= 0xe007f)
+}
+
+func isVirama(r rune) bool {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return norm.NFC.Properties(buf[:n]).CCC() == viramaCCC
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// isPictographic approximates Extended_Pictographic with the emoji blocks
+// that appear in ZWJ sequences.
+func isPictographic(r rune) bool {
+	return (r >= 0x1f300 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf)
+}
+
+// isHangulJoin implements the Hangul syllable sequence rules (L, V, T, LV
+// and LVT jamo).
+func isHangulJoin(prev, r rune) bool {
+	isL := func(c rune) bool { return c >= 0x1100 && c <= 0x115f }
+	isV := func(c rune) bool { return c >= 0x1160 && c <= 0x11a7 }
+	isT := func(c rune) bool { return c >= 0x11a8 && c <= 0x11ff }
+	isSyllable := func(c rune) bool { return c >= 0xac00 && c <= 0xd7a3 }
+	isLV := func(c rune) bool { return isSyllable(c) && (c-0xac00)%28 == 0 }
+
+	switch {
+	case isL(prev):
+		return isL(r) || isV(r) || isSyllable(r)
+	case isV(prev) || isLV(prev):
+		return isV(r) || isT(r)
+	case isT(prev) || isSyllable(prev):
+		return isT(r)
+	}
+	return false
+}
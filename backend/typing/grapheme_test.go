@@ -0,0 +1,39 @@
+package typing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"ascii", "abc", []string{"a", "b", "c"}},
+		{"empty", "", []string{}},
+		{"crlf", "a\r\nb", []string{"a", "\r\n", "b"}},
+		{"combining mark", "e\u0301x", []string{"e\u0301", "x"}},
+		{"stacked marks", "a\u0308\u0301", []string{"a\u0308\u0301"}},
+		{"variation selector", "\u2764\ufe0f!", []string{"\u2764\ufe0f", "!"}},
+		{"skin tone", "\U0001f44d\U0001f3fd", []string{"\U0001f44d\U0001f3fd"}},
+		{"zwj family", "\U0001f468\u200d\U0001f469\u200d\U0001f467\u200d\U0001f466", []string{"\U0001f468\u200d\U0001f469\u200d\U0001f467\u200d\U0001f466"}},
+		{"zwj before letter", "\U0001f468\u200da", []string{"\U0001f468\u200d", "a"}},
+		{"flags", "\U0001f1fa\U0001f1f8\U0001f1eb\U0001f1f7", []string{"\U0001f1fa\U0001f1f8", "\U0001f1eb\U0001f1f7"}},
+		{"odd regional indicator", "\U0001f1fa\U0001f1f8\U0001f1eb", []string{"\U0001f1fa\U0001f1f8", "\U0001f1eb"}},
+		{"hangul jamo", "\u1100\u1161\u11a8\u1100", []string{"\u1100\u1161\u11a8", "\u1100"}},
+		{"hangul syllable", "\ud55c\uae00", []string{"\ud55c", "\uae00"}},
+		{"devanagari conjunct", "\u0915\u094d\u0937\u093e", []string{"\u0915\u094d\u0937\u093e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Graphemes(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Graphemes(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if got := GraphemeCount(tt.in); got != len(tt.want) {
+				t.Errorf("GraphemeCount(%q) = %d, want %d", tt.in, got, len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package typing
+
+import (
+	"sort"
+)
+
+// minSamples is how often a key or bigram must have been typed before it is
+// considered when picking weak spots.
+const minSamples = 5
+
+// Keystroke is a single key press reported by the client during a race.
+type Keystroke struct {
+	// Expected is the passage character the player had to type.
+	Expected string `json:"expected"`
+	// Typed is the character the player actually typed.
+	Typed string `json:"typed"`
+	// LatencyMs is the time since the previous key press.
+	LatencyMs int `json:"latencyMs"`
+}
+
+// KeyStat aggregates presses of one key or bigram.
+type KeyStat struct {
+	Presses        int   `json:"presses"`
+	Errors         int   `json:"errors"`
+	TotalLatencyMs int64 `json:"totalLatencyMs"`
+}
+
+// ErrorRate is the fraction of presses that were wrong.
+func (s KeyStat) ErrorRate() float64 {
+	if s.Presses == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Presses)
+}
+
+// AvgLatencyMs is the mean time taken to reach the key.
+func (s KeyStat) AvgLatencyMs() float64 {
+	if s.Presses == 0 {
+		return 0
+	}
+	return float64(s.TotalLatencyMs) / float64(s.Presses)
+}
+
+// weakness scores a stat so that slow and error-prone keys rank highest.
+// Every error is weighted as if it cost a full second.
+func (s KeyStat) weakness() float64 {
+	return s.AvgLatencyMs() + s.ErrorRate()*1000
+}
+
+// Analysis is the per-key and per-bigram breakdown of a keystroke log.
+type Analysis struct {
+	Keys    map[string]KeyStat
+	Bigrams map[string]KeyStat
+}
+
+// Analyze aggregates a keystroke log. A bigram is keyed by the expected
+// characters of two consecutive presses and timed by the second press.
+func Analyze(strokes []Keystroke) Analysis {
+	a := Analysis{
+		Keys:    make(map[string]KeyStat),
+		Bigrams: make(map[string]KeyStat),
+	}
+
+	prev := ""
+	for _, k := range strokes {
+		if k.Expected == "" {
+			continue
+		}
+		missed := k.Typed != k.Expected
+
+		stat := a.Keys[k.Expected]
+		add(&stat, missed, k.LatencyMs)
+		a.Keys[k.Expected] = stat
+
+		if prev != "" {
+			bigram := prev + k.Expected
+			stat := a.Bigrams[bigram]
+			add(&stat, missed, k.LatencyMs)
+			a.Bigrams[bigram] = stat
+		}
+		prev = k.Expected
+	}
+	return a
+}
+
+func add(s *KeyStat, missed bool, latencyMs int) {
+	s.Presses++
+	if missed {
+		s.Errors++
+	}
+	if latencyMs > 0 {
+		s.TotalLatencyMs += int64(latencyMs)
+	}
+}
+
+// Weakest returns up to n keys from stats ordered from weakest to strongest,
+// skipping whitespace and keys with too few samples.
+func Weakest(stats map[string]KeyStat, n int) []string {
+	keys := make([]string, 0, len(stats))
+	for k, s := range stats {
+		if s.Presses < minSamples || isBlank(k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		wi, wj := stats[keys[i]].weakness(), stats[keys[j]].weakness()
+		if wi != wj {
+			return wi > wj
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func isBlank(s string) bool {
+	for _, r := range s {
+		if r != ' ' && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
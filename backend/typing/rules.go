@@ -0,0 +1,32 @@
+package typing
+
+import "strings"
+
+// ProseRules are the comparison rules for ordinary text passages.
+var ProseRules = Rules{}
+
+// codeRules holds per-language overrides for code passages. Languages where
+// indentation is significant must have it typed, so auto-indent is off.
+var codeRules = map[string]Rules{
+	"go":         {TabWidth: 4, AutoIndent: true, AutoCloseBrackets: true},
+	"javascript": {TabWidth: 2, AutoIndent: true, AutoCloseBrackets: true},
+	"typescript": {TabWidth: 2, AutoIndent: true, AutoCloseBrackets: true},
+	"python":     {TabWidth: 4, AutoCloseBrackets: true},
+	"yaml":       {TabWidth: 2},
+	"makefile":   {AutoIndent: true},
+}
+
+// defaultCodeRules apply to code passages in languages without an override.
+var defaultCodeRules = Rules{TabWidth: 4, AutoIndent: true, AutoCloseBrackets: true}
+
+// RulesFor returns the comparison rules for a passage of the given type and,
+// for code passages, language tag.
+func RulesFor(passageType, codeLanguage string) Rules {
+	if passageType != "code" {
+		return ProseRules
+	}
+	if rules, ok := codeRules[strings.ToLower(codeLanguage)]; ok {
+		return rules
+	}
+	return defaultCodeRules
+}
@@ -0,0 +1,71 @@
+package typing
+
+import (
+	"strings"
+	"time"
+)
+
+// standardWordLength is the conventional number of characters in a "word"
+// when measuring typing speed.
+const standardWordLength = 5.0
+
+// languageProfile describes how typing speed is measured for a language.
+type languageProfile struct {
+	// charsPerWord is the average number of grapheme clusters per word used
+	// to convert character counts to WPM.
+	charsPerWord float64
+	// perCharacter reports speed primarily as characters per minute, for
+	// scripts that do not separate words with spaces.
+	perCharacter bool
+}
+
+var languageProfiles = map[string]languageProfile{
+	"zh": {charsPerWord: 1.5, perCharacter: true},
+	"ja": {charsPerWord: 2.0, perCharacter: true},
+	"ko": {charsPerWord: 2.5, perCharacter: true},
+	"th": {charsPerWord: 4.0, perCharacter: true},
+	"hi": {charsPerWord: 3.5},
+}
+
+// Speed is a typing speed measured in a language-aware way.
+type Speed struct {
+	// WPM is words per minute, normalized so that speeds are comparable
+	// across languages.
+	WPM float64 `json:"wpm"`
+	// CPM is grapheme clusters per minute.
+	CPM float64 `json:"cpm"`
+	// Unit is the unit the language is conventionally ranked by, "wpm" or
+	// "cpm".
+	Unit string `json:"unit"`
+}
+
+// BaseLanguage returns the primary subtag of a BCP 47 language tag, so that
+// "zh-Hant" and "pt_BR" map to "zh" and "pt".
+func BaseLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// MeasureSpeed computes the speed of typing chars grapheme clusters in the
+// given language over elapsed.
+func MeasureSpeed(language string, chars int, elapsed time.Duration) Speed {
+	profile, ok := languageProfiles[BaseLanguage(language)]
+	if !ok {
+		profile = languageProfile{charsPerWord: standardWordLength}
+	}
+
+	speed := Speed{Unit: "wpm"}
+	if profile.perCharacter {
+		speed.Unit = "cpm"
+	}
+	if elapsed <= 0 {
+		return speed
+	}
+
+	speed.CPM = float64(chars) / elapsed.Minutes()
+	speed.WPM = speed.CPM / profile.charsPerWord
+	return speed
+}
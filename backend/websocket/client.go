@@ -1,12 +1,12 @@
 package websocket
 
 import (
-	"bytes"
-	"encoding/json"
 	"log"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"typerace/ratelimit"
 )
 
 const (
@@ -14,6 +14,9 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
+	// maxDropped is how many rate-limited messages in a row a client may
+	// send before it is disconnected
+	maxDropped = 50
 )
 
 type Client struct {
@@ -21,6 +24,9 @@ type Client struct {
 	Conn   *websocket.Conn
 	Send   chan []byte
 	GameID string
+	// UserID is set if the connection was opened with a presence ticket;
+	// spectators may connect anonymously.
+	UserID string
 }
 
 func (c *Client) ReadPump() {
@@ -36,25 +42,37 @@ func (c *Client) ReadPump() {
 		return nil
 	})
 
+	var limiter *ratelimit.Bucket
+	if c.Hub.MessageLimit.Enabled() {
+		limiter = ratelimit.NewBucket(c.Hub.MessageLimit)
+	}
+	dropped := 0
+
 	for {
-		_, message, err := c.Conn.ReadMessage()
+		_, _, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
 
-		// Parse incoming message
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("error parsing message: %v", err)
+		// Drop messages over the rate limit, and disconnect clients that
+		// keep flooding
+		if limiter != nil && !limiter.Allow(time.Now()) {
+			dropped++
+			if dropped > maxDropped {
+				log.Printf("Closing connection to game %s: message rate limit exceeded", c.GameID)
+				c.Conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+					time.Now().Add(writeWait))
+				break
+			}
 			continue
 		}
-
-		// Broadcast the message to the game
-		c.Hub.BroadcastToGame(c.GameID, msg)
+		// Clients have nothing to say over the game connection; chat is
+		// posted through the API so it can be moderated
+		dropped = 0
 	}
 }
 
@@ -96,8 +114,3 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 }
-
-var (
-	newline = []byte{'\n'}
-	space   = []byte{' '}
-)
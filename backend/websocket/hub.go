@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"sync"
+
+	"typerace/ratelimit"
 )
 
 type Hub struct {
@@ -20,6 +22,22 @@ type Hub struct {
 	// Broadcast channel for messages
 	Broadcast chan Message
 
+	// users maps user IDs to their user-level connections
+	users map[string]map[*UserClient]bool
+
+	// RegisterUser and UnregisterUser add and remove user-level
+	// connections
+	RegisterUser   chan *UserClient
+	UnregisterUser chan *UserClient
+
+	// UserPresence, if set, is called when a user's first connection opens
+	// and when their last one closes. It runs on its own goroutine.
+	UserPresence func(userID string, online bool)
+
+	// MessageLimit caps the messages each client may send; a zero limit
+	// allows any rate
+	MessageLimit ratelimit.Limit
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
 }
@@ -31,16 +49,111 @@ func NewHub() *Hub {
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Broadcast:  make(chan Message),
+
+		users:          make(map[string]map[*UserClient]bool),
+		RegisterUser:   make(chan *UserClient),
+		UnregisterUser: make(chan *UserClient),
 	}
 }
 
-func (h *Hub) BroadcastToGame(gameID string, message Message) {
+// SendToUser delivers a message to every connection of a user. It reports
+// whether the user had any.
+func (h *Hub) SendToUser(userID string, message Message) bool {
+	h.mu.Lock()
+	conns, ok := h.users[userID]
+	if ok && h.sendToConns(userID, conns, message.ToBytes()) {
+		h.mu.Unlock()
+		return true
+	}
+	h.mu.Unlock()
+
+	if ok {
+		h.announce(userID, false)
+	}
+	return false
+}
+
+// BroadcastToUsers delivers a message to every user-level connection.
+func (h *Hub) BroadcastToUsers(message Message) {
+	h.BroadcastToUsersExcept(message, nil)
+}
+
+// BroadcastToUsersExcept delivers a message to the user-level connections
+// of every user not in skip.
+func (h *Hub) BroadcastToUsersExcept(message Message, skip map[string]bool) {
+	h.mu.Lock()
+	var offline []string
+	messageBytes := message.ToBytes()
+	for userID, conns := range h.users {
+		if skip[userID] {
+			continue
+		}
+		if !h.sendToConns(userID, conns, messageBytes) {
+			offline = append(offline, userID)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, userID := range offline {
+		h.announce(userID, false)
+	}
+}
+
+// sendToConns delivers a message to a user's connections, dropping any
+// that are not keeping up. If that leaves none the user is removed and it
+// returns false; the caller must then announce them offline. h.mu must be
+// held.
+func (h *Hub) sendToConns(userID string, conns map[*UserClient]bool, message []byte) bool {
+	for client := range conns {
+		select {
+		case client.Send <- message:
+		default:
+			close(client.Send)
+			delete(conns, client)
+		}
+	}
+	if len(conns) == 0 {
+		delete(h.users, userID)
+		return false
+	}
+	return true
+}
+
+// Online reports whether a user has a user-level connection.
+func (h *Hub) Online(userID string) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	return len(h.users[userID]) > 0
+}
+
+// OnlineUsers returns the IDs of users with a user-level connection.
+func (h *Hub) OnlineUsers() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.users))
+	for id := range h.users {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (h *Hub) BroadcastToGame(gameID string, message Message) {
+	h.BroadcastToGameExcept(gameID, message, nil)
+}
+
+// BroadcastToGameExcept delivers a message to a game's connections, leaving
+// out those opened by users in skip. Anonymous connections always get it.
+func (h *Hub) BroadcastToGameExcept(gameID string, message Message, skip map[string]bool) {
+	// Slow clients are dropped from the map, so this needs the write lock
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	if clients, ok := h.Games[gameID]; ok {
 		messageBytes := message.ToBytes()
 		for client := range clients {
+			if client.UserID != "" && skip[client.UserID] {
+				continue
+			}
 			select {
 			case client.Send <- messageBytes:
 			default:
@@ -77,6 +190,37 @@ func (h *Hub) Run() {
 			}
 			h.mu.Unlock()
 
+		case client := <-h.RegisterUser:
+			h.mu.Lock()
+			conns, ok := h.users[client.UserID]
+			if !ok {
+				conns = make(map[*UserClient]bool)
+				h.users[client.UserID] = conns
+			}
+			conns[client] = true
+			h.mu.Unlock()
+			if !ok {
+				h.announce(client.UserID, true)
+			}
+
+		case client := <-h.UnregisterUser:
+			h.mu.Lock()
+			offline := false
+			if conns, ok := h.users[client.UserID]; ok {
+				if _, ok := conns[client]; ok {
+					delete(conns, client)
+					close(client.Send)
+					if len(conns) == 0 {
+						delete(h.users, client.UserID)
+						offline = true
+					}
+				}
+			}
+			h.mu.Unlock()
+			if offline {
+				h.announce(client.UserID, false)
+			}
+
 		case message := <-h.Broadcast:
 			h.mu.RLock()
 			messageBytes := message.ToBytes()
@@ -92,3 +236,9 @@ func (h *Hub) Run() {
 		}
 	}
 }
+
+func (h *Hub) announce(userID string, online bool) {
+	if h.UserPresence != nil {
+		go h.UserPresence(userID, online)
+	}
+}
@@ -19,3 +19,26 @@ var Upgrader = websocket.Upgrader{
 func UpgradeConnection(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
 	return Upgrader.Upgrade(w, r, nil)
 }
+
+// OriginUpgrader upgrades connections whose Origin header is allowed. It is
+// built once and is safe for concurrent use.
+type OriginUpgrader struct {
+	upgrader websocket.Upgrader
+}
+
+// NewOriginUpgrader returns an upgrader accepting the origins allowed
+// reports true for.
+func NewOriginUpgrader(allowed func(origin string) bool) *OriginUpgrader {
+	return &OriginUpgrader{upgrader: websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			return allowed(r.Header.Get("Origin"))
+		},
+	}}
+}
+
+// Upgrade upgrades an HTTP connection to a WebSocket connection.
+func (u *OriginUpgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	return u.upgrader.Upgrade(w, r, nil)
+}